@@ -1,21 +1,87 @@
 package cmd
 
 import (
+	"time"
+
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+var (
+	backupTimeout      time.Duration
+	backupRetries      int
+	backupRetryBackoff time.Duration
+	backupJob          string
 )
 
 // backupCmd represents the backup command
 var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Backup a PostgreSQL database",
-	Long:  `Backup a PostgreSQL database one and now`,
+	Long: `Backup a PostgreSQL database one and now.
+
+Without --job the databases, storages and compression come from the top level
+of the configuration file. With --job the named job block is backed up instead.
+
+Timeout and retry settings default to the job, then to the scheduler block of the configuration file.`,
 	Run: func(cmd *cobra.Command, _ []string) {
-		internal.Backup(cmd.Context())
+		logger := log.Logger.With().Str("caller", "backup_cmd").Logger()
+
+		name := "backup"
+		job := internal.DefaultBackupJob()
+		policy := config.Loaded.GetRetryPolicy(nil, nil, nil)
+		ping := config.Loaded.Ping
+
+		if backupJob != "" {
+			jobConfig, ok := config.Loaded.GetJob(backupJob)
+			if !ok {
+				logger.Fatal().Str("job", backupJob).Msg("no backup job with this name is configured")
+			}
+
+			name = jobConfig.Name
+			job = internal.NewBackupJob(jobConfig)
+			policy = config.Loaded.GetRetryPolicy(jobConfig.Timeout, jobConfig.Retries, jobConfig.RetryBackoff)
+			ping = jobConfig.Ping
+		}
+
+		if cmd.Flags().Changed("timeout") {
+			policy.Timeout = backupTimeout
+		}
+		if cmd.Flags().Changed("retries") {
+			policy.Retries = backupRetries
+		}
+		if cmd.Flags().Changed("retry-backoff") {
+			policy.Backoff = backupRetryBackoff
+		}
+
+		if job.S3 {
+			if err := s3.CheckBucket(cmd.Context()); err != nil {
+				logger.Fatal().Err(err).Msg("S3 storage check failed")
+			}
+		}
+
+		run := notify.StartPing(name, ping)
+		backupRun := internal.NewBackupRun(job)
+		err := internal.Retry(cmd.Context(), name, policy, backupRun.Attempt)
+		backupRun.Finish()
+		run.Finish(err)
+		if err != nil {
+			logger.Error().Err(err).Msg("backup failed")
+			notify.Exit(1)
+		}
 	},
 }
 
 func init() {
+	backupCmd.Flags().StringVar(&backupJob, "job", "", "name of the job block to back up (default the top-level configuration)")
+	backupCmd.Flags().DurationVar(&backupTimeout, "timeout", 0, "limit for a single backup attempt (default none)")
+	backupCmd.Flags().IntVar(&backupRetries, "retries", 0, "number of retries after a failed attempt")
+	backupCmd.Flags().DurationVar(&backupRetryBackoff, "retry-backoff", config.DefaultRetryBackoff, "delay before the first retry, doubled for each further retry")
+
 	RootCmd.AddCommand(backupCmd)
 }
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+)
+
+var rotateDryRun bool
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage encryption keys",
+	Long:  `Manage the master keys of envelope encrypted backups.`,
+}
+
+// rotateCmd represents the rotate command
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rewrap the data keys of existing backups with the current master keys",
+	Long: `Rewrap the data keys of every envelope encrypted backup with the master keys
+in encrypt.envelope.master_key_files. Data keys are unwrapped with any master or
+retired key, so move the old key to retired_key_files and the new one to
+master_key_files before running this command. Only the keys sidecars are
+rewritten, the backups themselves are not touched. Once the command succeeds,
+the retired keys are no longer needed. With S3 Object Lock the previous keys
+sidecars stay in the bucket until their retention ends, so they can still be
+read with the retired keys until then.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := log.Logger.With().Str("caller", "keys_rotate_cmd").Logger()
+
+		if config.Loaded.Storage.S3 == nil && config.Loaded.Storage.Local == nil {
+			logger.Fatal().Msg("no storage backends configured - cannot rotate keys")
+		}
+
+		if err := internal.RotateKeys(cmd.Context(), internal.RotateOptions{DryRun: rotateDryRun}); err != nil {
+			logger.Error().Err(err).Msg("key rotation failed")
+			notify.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rotateCmd.Flags().BoolVar(&rotateDryRun, "dry-run", false, "report backups that would be rewrapped without changing them")
+
+	keysCmd.AddCommand(rotateCmd)
+	RootCmd.AddCommand(keysCmd)
+}
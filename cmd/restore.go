@@ -15,6 +15,8 @@ import (
 
 	"github.com/DeltaLaboratory/postgres-backup/internal"
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
 )
@@ -134,7 +136,8 @@ Examples:
 
 		// Perform the restore
 		if err := performRestore(cmd.Context(), selectedBackup, targetDb); err != nil {
-			logger.Fatal().Err(err).Msg("restore operation failed")
+			logger.Error().Err(err).Msg("restore operation failed")
+			notify.Exit(1)
 		}
 
 		logger.Info().
@@ -185,7 +188,7 @@ func listS3Backups(ctx context.Context, logger zerolog.Logger) []BackupEntry {
 
 	for _, backup := range s3Backups {
 		backups = append(backups, BackupEntry{
-			Name:         backup.Key,
+			Name:         backup.Name,
 			LastModified: backup.LastModified,
 			Size:         backup.Size,
 			Source:       "s3",
@@ -205,17 +208,8 @@ func listLocalBackups(logger zerolog.Logger) []BackupEntry {
 	}
 
 	for _, backup := range localBackups {
-		// Extract filename from full path for display
-		filename := backup.Path
-		if idx := strings.LastIndex(backup.Path, "/"); idx >= 0 {
-			filename = backup.Path[idx+1:]
-		}
-		if idx := strings.LastIndex(filename, "\\"); idx >= 0 {
-			filename = filename[idx+1:]
-		}
-
 		backups = append(backups, BackupEntry{
-			Name:         filename,
+			Name:         backup.Name,
 			LastModified: backup.LastModified,
 			Size:         backup.Size,
 			Source:       "local",
@@ -304,7 +298,7 @@ func getAllBackups(ctx context.Context, includeS3, includeLocal bool) ([]BackupE
 
 		for _, backup := range s3Backups {
 			allBackups = append(allBackups, BackupEntry{
-				Name:         backup.Key,
+				Name:         backup.Name,
 				LastModified: backup.LastModified,
 				Size:         backup.Size,
 				Source:       "s3",
@@ -321,17 +315,8 @@ func getAllBackups(ctx context.Context, includeS3, includeLocal bool) ([]BackupE
 		}
 
 		for _, backup := range localBackups {
-			// Extract filename from full path for display
-			filename := backup.Path
-			if idx := strings.LastIndex(backup.Path, "/"); idx >= 0 {
-				filename = backup.Path[idx+1:]
-			}
-			if idx := strings.LastIndex(filename, "\\"); idx >= 0 {
-				filename = filename[idx+1:]
-			}
-
 			allBackups = append(allBackups, BackupEntry{
-				Name:         filename,
+				Name:         backup.Name,
 				LastModified: backup.LastModified,
 				Size:         backup.Size,
 				Source:       "local",
@@ -395,6 +380,7 @@ func performRestore(ctx context.Context, backup *BackupEntry, targetDatabase str
 	logger.Info().Msg("starting restore operation")
 
 	var backupReader io.ReadCloser
+	var sidecars storage.SidecarReader
 	var err error
 
 	// Get backup data based on source
@@ -404,11 +390,13 @@ func performRestore(ctx context.Context, backup *BackupEntry, targetDatabase str
 		if err != nil {
 			return fmt.Errorf("failed to download S3 backup: %w", err)
 		}
+		sidecars = s3.SidecarReader(backup.Key)
 	case "local":
 		backupReader, err = local.OpenBackup(backup.Key)
 		if err != nil {
 			return fmt.Errorf("failed to open local backup: %w", err)
 		}
+		sidecars = local.SidecarReader(backup.Key)
 	default:
 		return fmt.Errorf("unsupported backup source: %s", backup.Source)
 	}
@@ -417,7 +405,7 @@ func performRestore(ctx context.Context, backup *BackupEntry, targetDatabase str
 	logger.Info().Msg("backup data retrieved, starting restore process")
 
 	// Perform the restore
-	err = internal.Restore(backupReader, targetDatabase, backup.Name)
+	err = internal.Restore(ctx, backupReader, targetDatabase, backup.Name, sidecars)
 	if err != nil {
 		return fmt.Errorf("restore process failed: %w", err)
 	}
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
+	"github.com/DeltaLaboratory/postgres-backup/internal"
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
-	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
-	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+var (
+	gcDryRun bool
+	gcMinAge time.Duration
 )
 
 // retentionCmd represents the retention command
@@ -22,7 +30,8 @@ var cleanupCmd = &cobra.Command{
 	Short: "Clean up old backups based on retention policy",
 	Long: `Clean up old backups based on the configured retention policy.
 This command will remove backups that exceed the retention limits defined
-in the configuration file (retention_days and/or retention_count).`,
+in the configuration file (retention_period and/or retention_count), and the
+retention block of every backup job.`,
 	Run: func(cmd *cobra.Command, _ []string) {
 		logger := log.Logger.With().Str("caller", "retention_cleanup_cmd").Logger()
 
@@ -43,44 +52,43 @@ in the configuration file (retention_days and/or retention_count).`,
 			Strs("storage_backends", backends).
 			Msg("starting manual retention cleanup")
 
-		successCount := 0
-
-		// Run S3 retention cleanup if configured
-		if config.Loaded.Storage.S3 != nil {
-			if err := s3.CleanupRetention(cmd.Context()); err != nil {
-				logger.Error().Err(err).
-					Str("bucket", config.Loaded.Storage.S3.Bucket).
-					Msg("S3 retention cleanup failed")
-			} else {
-				logger.Info().
-					Str("bucket", config.Loaded.Storage.S3.Bucket).
-					Msg("S3 retention cleanup completed successfully")
-				successCount++
-			}
+		if err := internal.CleanupRetention(cmd.Context()); err != nil {
+			logger.Error().Err(err).Msg("retention cleanup failed")
+			notify.Exit(1)
 		}
+	},
+}
 
-		// Run local retention cleanup if configured
-		if config.Loaded.Storage.Local != nil {
-			if err := local.CleanupRetention(cmd.Context()); err != nil {
-				logger.Error().Err(err).
-					Str("directory", config.Loaded.Storage.Local.Directory).
-					Msg("local retention cleanup failed")
-			} else {
-				logger.Info().
-					Str("directory", config.Loaded.Storage.Local.Directory).
-					Msg("local retention cleanup completed successfully")
-				successCount++
-			}
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove incomplete and orphaned backup artifacts",
+	Long: `Remove incomplete and orphaned backup artifacts left behind by interrupted runs.
+This command finds zero-byte backups, incomplete S3 multipart uploads, temporary
+files of interrupted local writes, sidecar files without a backup and backups
+that were cut short in every configured storage backend. A backup counts as cut
+short when it has no manifest but the backups before and after it in the same
+directory have one. Artifacts younger than --min-age are never touched since
+they may belong to a backup that is still running.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := log.Logger.With().Str("caller", "retention_gc_cmd").Logger()
+
+		if config.Loaded.Storage.S3 == nil && config.Loaded.Storage.Local == nil {
+			logger.Fatal().Msg("no storage backends configured - cannot perform garbage collection")
 		}
 
-		logger.Info().
-			Int("successful_backends", successCount).
-			Int("total_backends", len(backends)).
-			Msg("retention cleanup operation finished")
+		if err := internal.GarbageCollect(cmd.Context(), storage.GCOptions{MinAge: gcMinAge, DryRun: gcDryRun}); err != nil {
+			logger.Error().Err(err).Msg("garbage collection failed")
+			notify.Exit(1)
+		}
 	},
 }
 
 func init() {
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "report artifacts that would be removed without removing them")
+	gcCmd.Flags().DurationVar(&gcMinAge, "min-age", config.DefaultGCMinAge, "only remove artifacts older than this duration")
+
 	retentionCmd.AddCommand(cleanupCmd)
+	retentionCmd.AddCommand(gcCmd)
 	RootCmd.AddCommand(retentionCmd)
 }
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
 )
 
 var configFile string
@@ -29,23 +33,26 @@ example:
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the RootCmd.
+// The command context is cancelled when the process receives SIGINT or SIGTERM.
 func Execute() {
-	err := RootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	err := RootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
-		os.Exit(1)
+		notify.Exit(1)
 	}
+
+	notify.Wait()
 }
 
 func init() {
 	cobra.OnInitialize(func() {
-		if configFile != "" {
-			if err := config.LoadConfig(configFile); err != nil {
-				panic(err)
-			}
-			return
+		if err := config.LoadConfig(configFile); err != nil {
+			panic(err)
 		}
 
-		if err := config.LoadConfig(""); err != nil {
+		if err := notify.Setup(config.Loaded); err != nil {
 			panic(err)
 		}
 	})
@@ -0,0 +1,184 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/scheduler"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+// newScheduler creates a scheduler with the leader lock and state file from the configuration
+func newScheduler(ctx context.Context) *scheduler.Scheduler {
+	logger := log.Logger.With().Str("caller", "schedule_runner").Logger()
+
+	s := scheduler.New(ctx)
+
+	if config.Loaded.Scheduler != nil && config.Loaded.Scheduler.LeaderLock != nil {
+		lockConfig := config.Loaded.Scheduler.LeaderLock
+		identity := lockConfig.GetIdentity()
+
+		switch lockConfig.Backend {
+		case config.LeaderLockPostgres:
+			s.UseLocker(scheduler.NewPostgresLocker(identity))
+		case config.LeaderLockS3:
+			s.UseLocker(scheduler.NewS3Locker(identity, lockConfig.GetTTL()))
+		}
+
+		logger.Info().
+			Str("backend", lockConfig.Backend).
+			Str("identity", identity).
+			Msg("leader lock enabled, jobs only run on the replica holding their lock")
+	}
+
+	if config.Loaded.Scheduler != nil && config.Loaded.Scheduler.StateFile != nil {
+		state, err := scheduler.LoadState(*config.Loaded.Scheduler.StateFile)
+		if err != nil {
+			logger.Fatal().Err(err).
+				Str("state_file", *config.Loaded.Scheduler.StateFile).
+				Msg("failed to load scheduler state")
+		}
+		s.UseState(state)
+
+		logger.Info().
+			Str("state_file", *config.Loaded.Scheduler.StateFile).
+			Msg("persisting scheduler state")
+	}
+
+	return s
+}
+
+// jobs builds the scheduler jobs for every schedule in the configuration, including disabled ones
+func jobs() []scheduler.Job {
+	var result []scheduler.Job
+
+	// Backup schedules of the default job
+	for i, schedule := range config.Loaded.Schedule {
+		result = append(result, scheduler.Job{
+			Name:      config.BackupScheduleName(i),
+			Type:      scheduler.TypeBackup,
+			Cron:      schedule,
+			Enabled:   true,
+			Overlap:   config.Loaded.GetOverlap(nil),
+			Location:  config.Loaded.GetLocation(nil),
+			Jitter:    config.Loaded.GetJitter(nil),
+			Retry:     config.Loaded.GetRetryPolicy(nil, nil, nil),
+			Databases: []string{config.Loaded.Postgres.GetDatabase()},
+			Ping:      config.Loaded.Ping,
+			NewRun: func() scheduler.Run {
+				return internal.NewBackupRun(internal.DefaultBackupJob())
+			},
+		})
+	}
+
+	// Backup jobs
+	for _, jobConfig := range config.Loaded.Jobs {
+		backupJob := internal.NewBackupJob(jobConfig)
+
+		result = append(result, scheduler.Job{
+			Name:      jobConfig.Name,
+			Type:      scheduler.TypeBackup,
+			Cron:      jobConfig.Cron,
+			Enabled:   jobConfig.IsEnabled(),
+			Overlap:   config.Loaded.GetOverlap(jobConfig.Overlap),
+			Location:  config.Loaded.GetLocation(jobConfig.Timezone),
+			Jitter:    config.Loaded.GetJitter(jobConfig.Jitter),
+			Retry:     config.Loaded.GetRetryPolicy(jobConfig.Timeout, jobConfig.Retries, jobConfig.RetryBackoff),
+			Databases: backupJob.Databases,
+			Ping:      jobConfig.Ping,
+			NewRun: func() scheduler.Run {
+				return internal.NewBackupRun(backupJob)
+			},
+		})
+	}
+
+	// Restore schedules
+	for i, restoreSchedule := range config.Loaded.RestoreSchedule {
+		result = append(result, scheduler.Job{
+			Name:      restoreSchedule.GetName(i),
+			Type:      scheduler.TypeRestore,
+			Cron:      restoreSchedule.Cron,
+			Enabled:   restoreSchedule.IsEnabled(),
+			Overlap:   config.Loaded.GetOverlap(restoreSchedule.Overlap),
+			Location:  config.Loaded.GetLocation(restoreSchedule.Timezone),
+			Jitter:    config.Loaded.GetJitter(restoreSchedule.Jitter),
+			Retry:     config.Loaded.GetRetryPolicy(restoreSchedule.Timeout, restoreSchedule.Retries, restoreSchedule.RetryBackoff),
+			Databases: []string{restoreSchedule.TargetDatabase},
+			Ping:      restoreSchedule.Ping,
+			Run: func(ctx context.Context) error {
+				return internal.ScheduledRestore(ctx, restoreSchedule)
+			},
+		})
+	}
+
+	// Garbage collection schedules
+	for i, gcSchedule := range config.Loaded.GCSchedule {
+		// Validated on load, so the minimum age always parses here
+		minAge, _ := gcSchedule.GetMinAge()
+		opts := storage.GCOptions{MinAge: minAge, DryRun: gcSchedule.IsDryRun()}
+
+		result = append(result, scheduler.Job{
+			Name:     gcSchedule.GetName(i),
+			Type:     scheduler.TypeGC,
+			Cron:     gcSchedule.Cron,
+			Enabled:  gcSchedule.IsEnabled(),
+			Overlap:  config.Loaded.GetOverlap(gcSchedule.Overlap),
+			Location: config.Loaded.GetLocation(gcSchedule.Timezone),
+			Jitter:   config.Loaded.GetJitter(gcSchedule.Jitter),
+			Retry:    config.Loaded.GetRetryPolicy(gcSchedule.Timeout, gcSchedule.Retries, gcSchedule.RetryBackoff),
+			Run: func(ctx context.Context) error {
+				return internal.GarbageCollect(ctx, opts)
+			},
+		})
+	}
+
+	// Retention schedules
+	for i, retentionSchedule := range config.Loaded.RetentionSchedule {
+		result = append(result, scheduler.Job{
+			Name:     retentionSchedule.GetName(i),
+			Type:     scheduler.TypeRetention,
+			Cron:     retentionSchedule.Cron,
+			Enabled:  retentionSchedule.IsEnabled(),
+			Overlap:  config.Loaded.GetOverlap(retentionSchedule.Overlap),
+			Location: config.Loaded.GetLocation(retentionSchedule.Timezone),
+			Jitter:   config.Loaded.GetJitter(retentionSchedule.Jitter),
+			Retry:    config.Loaded.GetRetryPolicy(retentionSchedule.Timeout, retentionSchedule.Retries, retentionSchedule.RetryBackoff),
+			Run:      internal.CleanupRetention,
+		})
+	}
+
+	// Verify schedules
+	for i, verifySchedule := range config.Loaded.VerifySchedule {
+		opts := internal.VerifyOptions{Count: verifySchedule.GetCount()}
+
+		result = append(result, scheduler.Job{
+			Name:     verifySchedule.GetName(i),
+			Type:     scheduler.TypeVerify,
+			Cron:     verifySchedule.Cron,
+			Enabled:  verifySchedule.IsEnabled(),
+			Overlap:  config.Loaded.GetOverlap(verifySchedule.Overlap),
+			Location: config.Loaded.GetLocation(verifySchedule.Timezone),
+			Jitter:   config.Loaded.GetJitter(verifySchedule.Jitter),
+			Retry:    config.Loaded.GetRetryPolicy(verifySchedule.Timeout, verifySchedule.Retries, verifySchedule.RetryBackoff),
+			Run: func(ctx context.Context) error {
+				return internal.Verify(ctx, opts)
+			},
+		})
+	}
+
+	return result
+}
+
+// jobByName finds a configured job by name
+func jobByName(name string) (scheduler.Job, bool) {
+	for _, job := range jobs() {
+		if job.Name == name {
+			return job, true
+		}
+	}
+
+	return scheduler.Job{}, false
+}
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/scheduler"
+)
+
+var listCount int
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured schedules and their next runs",
+	Long: `List every backup, restore and maintenance schedule defined in the configuration file
+with its cron expression, time zone, enabled state and next fire times.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		logger := log.Logger.With().Str("caller", "schedule_list").Logger()
+
+		all := jobs()
+		if len(all) == 0 {
+			fmt.Fprintln(os.Stdout, "No schedules configured.")
+			return
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tTYPE\tCRON\tTIMEZONE\tENABLED\tNEXT RUNS")
+
+		now := time.Now()
+		for _, job := range all {
+			schedule, err := scheduler.Parse(job)
+			if err != nil {
+				logger.Error().Err(err).Str("job", job.Name).Msg("failed to parse schedule")
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%t\t%s\n", job.Name, job.Type, job.Cron, "-", job.Enabled, "invalid cron expression")
+				continue
+			}
+
+			location := job.Location
+			if spec, ok := schedule.(*cron.SpecSchedule); ok {
+				location = spec.Location
+			}
+
+			next := nextRuns(schedule, location, now, listCount)
+			first := "-"
+			if len(next) > 0 {
+				first = next[0]
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%t\t%s\n", job.Name, job.Type, job.Cron, location, job.Enabled, first)
+			for _, run := range next[min(1, len(next)):] {
+				fmt.Fprintf(writer, "\t\t\t\t\t%s\n", run)
+			}
+		}
+
+		writer.Flush()
+		fmt.Fprintf(os.Stdout, "\nTotal: %d schedules\n", len(all))
+	},
+}
+
+func init() {
+	listCmd.Flags().IntVarP(&listCount, "count", "n", 3, "number of upcoming runs to show per schedule")
+
+	scheduleCmd.AddCommand(listCmd)
+}
+
+// nextRuns formats the next count fire times of a schedule after now in the schedule's time zone
+func nextRuns(schedule cron.Schedule, location *time.Location, now time.Time, count int) []string {
+	runs := make([]string, 0, count)
+
+	next := now
+	for range count {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next.In(location).Format("2006-01-02 15:04 MST"))
+	}
+
+	return runs
+}
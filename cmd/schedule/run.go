@@ -1,25 +1,40 @@
 package schedule
 
 import (
-	"github.com/robfig/cron/v3"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
-	"github.com/DeltaLaboratory/postgres-backup/internal"
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/freshness"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+	"github.com/DeltaLaboratory/postgres-backup/internal/server"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
 )
 
+// httpShutdownTimeout bounds how long shutdown waits for in-flight HTTP requests
+const httpShutdownTimeout = 5 * time.Second
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
-	Short: "Run the backup and restore schedules",
-	Long:  `Run the backup and restore schedules defined in the configuration file.`,
+	Short: "Run the backup, restore and maintenance schedules",
+	Long:  `Run the backup, restore, garbage collection, retention and verify schedules defined in the configuration file.`,
 	Run: func(cmd *cobra.Command, _ []string) {
 		logger := log.Logger.With().Str("caller", "schedule_runner").Logger()
 
 		backupCount := len(config.Loaded.Schedule)
+		jobCount := len(config.Loaded.Jobs)
 		restoreCount := len(config.Loaded.RestoreSchedule)
-		totalSchedules := backupCount + restoreCount
+		gcCount := len(config.Loaded.GCSchedule)
+		retentionCount := len(config.Loaded.RetentionSchedule)
+		verifyCount := len(config.Loaded.VerifySchedule)
+		totalSchedules := backupCount + jobCount + restoreCount + gcCount + retentionCount + verifyCount
 
 		if totalSchedules == 0 {
 			logger.Fatal().Msg("no schedules configured - cannot start scheduler")
@@ -27,63 +42,118 @@ var runCmd = &cobra.Command{
 
 		logger.Info().
 			Int("backup_schedules", backupCount).
+			Int("backup_jobs", jobCount).
 			Int("restore_schedules", restoreCount).
+			Int("gc_schedules", gcCount).
+			Int("retention_schedules", retentionCount).
+			Int("verify_schedules", verifyCount).
 			Int("total_schedules", totalSchedules).
 			Msg("initializing scheduler")
 
-		c := cron.New()
-
-		// Register backup schedules
-		for _, schedule := range config.Loaded.Schedule {
-			if _, err := c.AddFunc(schedule, func() { internal.Backup(cmd.Context()) }); err != nil {
-				logger.Fatal().Err(err).
-					Str("cron_expression", schedule).
-					Msg("failed to register backup schedule - invalid cron expression")
-			} else {
-				logger.Info().
-					Str("type", "backup").
-					Str("cron_expression", schedule).
-					Msg("schedule registered successfully")
+		// Fail now rather than at the first upload when the bucket rejects the encryption or object lock settings
+		if config.Loaded.Storage.S3 != nil {
+			if err := s3.CheckBucket(cmd.Context()); err != nil {
+				logger.Fatal().Err(err).Msg("S3 storage check failed")
 			}
 		}
 
-		// Register restore schedules
-		for _, restoreSchedule := range config.Loaded.RestoreSchedule {
-			if !restoreSchedule.IsEnabled() {
+		s := newScheduler(cmd.Context())
+
+		for _, job := range jobs() {
+			if !job.Enabled {
 				logger.Info().
-					Str("type", "restore").
-					Str("cron_expression", restoreSchedule.Cron).
-					Str("target_database", restoreSchedule.TargetDatabase).
-					Msg("restore schedule disabled, skipping")
+					Str("job", job.Name).
+					Str("type", job.Type).
+					Str("cron_expression", job.Cron).
+					Msg("schedule disabled, skipping")
 				continue
 			}
 
-			// Create a closure to capture the restore schedule config
-			scheduleConfig := restoreSchedule // Important: capture the value, not the reference
-			if _, err := c.AddFunc(restoreSchedule.Cron, func() {
-				if err := internal.ScheduledRestore(cmd.Context(), scheduleConfig); err != nil {
-					log.Error().Err(err).
-						Str("cron_expression", scheduleConfig.Cron).
-						Str("target_database", scheduleConfig.TargetDatabase).
-						Msg("scheduled restore failed")
-				}
-			}); err != nil {
+			if err := s.Add(job); err != nil {
 				logger.Fatal().Err(err).
-					Str("cron_expression", restoreSchedule.Cron).
-					Str("target_database", restoreSchedule.TargetDatabase).
-					Msg("failed to register restore schedule - invalid cron expression")
-			} else {
-				logger.Info().
-					Str("type", "restore").
-					Str("cron_expression", restoreSchedule.Cron).
-					Str("target_database", restoreSchedule.TargetDatabase).
-					Str("backup_selection", restoreSchedule.BackupSelection).
-					Msg("schedule registered successfully")
+					Str("job", job.Name).
+					Str("type", job.Type).
+					Str("cron_expression", job.Cron).
+					Msg("failed to register schedule - invalid cron expression")
 			}
+
+			logger.Info().
+				Str("job", job.Name).
+				Str("type", job.Type).
+				Str("cron_expression", job.Cron).
+				Str("overlap", job.Overlap).
+				Str("timezone", job.Location.String()).
+				Dur("jitter", job.Jitter).
+				Dur("timeout", job.Retry.Timeout).
+				Int("retries", job.Retry.Retries).
+				Msg("schedule registered successfully")
+		}
+
+		// The newest backups are tracked for /readyz and stale notifications, both judge the same backups
+		var tracker *freshness.Tracker
+		if config.Loaded.HTTP != nil || notify.WatchesStale() {
+			tracker = freshness.NewTracker()
+			go tracker.Seed(cmd.Context())
+		}
+
+		var httpServer *server.Server
+		if config.Loaded.HTTP != nil {
+			var err error
+			httpServer, err = server.Start(config.Loaded.HTTP, s, tracker)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to start HTTP server")
+			}
+		}
+
+		if notify.WatchesStale() {
+			go notify.WatchStale(cmd.Context(), tracker)
 		}
 
 		logger.Info().Msg("starting scheduler - waiting for scheduled jobs")
-		c.Run()
+		s.Start()
+
+		if config.Loaded.Scheduler != nil && config.Loaded.Scheduler.IsCatchUpEnabled() {
+			window := config.Loaded.Scheduler.GetCatchUpWindow()
+			started := s.CatchUp(window)
+
+			logger.Info().
+				Int("catch_up_runs", started).
+				Dur("catch_up_window", window).
+				Msg("checked schedules for missed runs")
+		}
+
+		// The command context is cancelled on SIGINT or SIGTERM
+		<-cmd.Context().Done()
+
+		grace := config.Loaded.GetShutdownGracePeriod()
+		logger.Info().Dur("grace_period", grace).Msg("shutdown signal received, no longer accepting new jobs")
+
+		// A second signal skips the rest of the grace period
+		force, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+		result := s.Shutdown(force, grace)
+
+		event := logger.Info()
+		if result.ExitCode() != 0 {
+			event = logger.Warn()
+		}
+		event.
+			Int("in_flight", result.InFlight).
+			Int("failed", result.Failed).
+			Int("cancelled", result.Cancelled).
+			Int("abandoned", result.Abandoned).
+			Msg("scheduler stopped")
+
+		if httpServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+			if err := httpServer.Shutdown(ctx); err != nil {
+				logger.Warn().Err(err).Msg("failed to stop HTTP server cleanly")
+			}
+			cancel()
+		}
+
+		stop()
+		notify.Exit(result.ExitCode())
 	},
 }
 
@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+)
+
+// triggerCmd represents the trigger command
+var triggerCmd = &cobra.Command{
+	Use:   "trigger <name>",
+	Short: "Run a scheduled job right away",
+	Long: `Run a scheduled job right away, with the same leader lock, timeout and retries as the
+scheduler, but without jitter. The job runs in this process, so the overlap protection and database
+locking of a running "schedule run" do not apply to it; configure a leader lock to keep the two
+from running the job at the same time. Use "schedule list" to see job names.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.Logger.With().Str("caller", "schedule_trigger").Logger()
+
+		job, ok := jobByName(args[0])
+		if !ok {
+			logger.Fatal().Str("job", args[0]).Msg("no schedule with this name, see `schedule list`")
+		}
+
+		if !job.Enabled {
+			logger.Warn().Str("job", job.Name).Msg("schedule is disabled, running it anyway since it was triggered explicitly")
+		}
+
+		s := newScheduler(cmd.Context())
+
+		// Cancel the job like the scheduler does when SIGINT or SIGTERM arrives
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-cmd.Context().Done():
+				s.Shutdown(context.Background(), config.Loaded.GetShutdownGracePeriod())
+			case <-done:
+			}
+		}()
+
+		logger.Info().
+			Str("job", job.Name).
+			Str("type", job.Type).
+			Msg("triggering job")
+
+		ran, err := s.Trigger(job)
+		close(done)
+
+		switch {
+		case !ran:
+			logger.Fatal().Str("job", job.Name).Msg("job did not run, see the log above for the reason")
+		case err != nil:
+			logger.Error().Err(err).Str("job", job.Name).Msg("triggered job failed")
+			notify.Exit(1)
+		}
+
+		logger.Info().Str("job", job.Name).Msg("triggered job completed successfully")
+	},
+}
+
+func init() {
+	scheduleCmd.AddCommand(triggerCmd)
+}
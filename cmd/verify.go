@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+)
+
+var verifyCount int
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the newest backups of every backup job",
+	Long: `Verify the newest backups of every backup job in every configured storage backend.
+Each backup is read end to end: when manifest.public_key_files is set, its
+manifest signature, size and checksum are checked first, then the backup is
+decrypted and decompressed and must hold a pg_dump custom format archive.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := log.Logger.With().Str("caller", "verify_cmd").Logger()
+
+		if config.Loaded.Storage.S3 == nil && config.Loaded.Storage.Local == nil {
+			logger.Fatal().Msg("no storage backends configured - cannot verify backups")
+		}
+
+		if err := internal.Verify(cmd.Context(), internal.VerifyOptions{Count: verifyCount}); err != nil {
+			logger.Error().Err(err).Msg("backup verification failed")
+			notify.Exit(1)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().IntVar(&verifyCount, "count", config.DefaultVerifyCount, "number of newest backups verified per job, database and storage backend")
+
+	RootCmd.AddCommand(verifyCmd)
+}
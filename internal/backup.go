@@ -3,51 +3,293 @@ package internal
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
 )
 
-func Backup(ctx context.Context) {
+// Backup dumps every database of the job and uploads each dump to the job's storage backends.
+// Cancelling ctx stops pg_dump and aborts any upload in progress.
+func Backup(ctx context.Context, job BackupJob) error {
+	run := NewBackupRun(job)
+	err := run.Attempt(ctx)
+	run.Finish()
+
+	return err
+}
+
+// BackupRun is a single run of a backup job that may take several attempts. Each attempt only takes
+// the backups earlier attempts failed to store, so a retry never stores a database twice in a backend
+// and never pushes good backups out of the retention count with duplicates.
+// Finish publishes the outcome of every database once the last attempt is done, so that notifiers
+// and metrics never report a failure that a later attempt recovered from.
+type BackupRun struct {
+	job BackupJob
+	// results holds the outcome of each database over every attempt so far, keyed by database
+	results map[string]*event.BackupFinished
+	// stored holds the backends each database was stored in by earlier attempts, keyed by database and backend
+	stored map[string]map[string]bool
+	// manifests stores the manifests that failed to store after their backup was stored, keyed by database and backend
+	manifests map[string]map[string]func(ctx context.Context) error
+}
+
+// NewBackupRun starts a run of the job, its attempts are made with Attempt
+func NewBackupRun(job BackupJob) *BackupRun {
+	return &BackupRun{
+		job:       job,
+		results:   make(map[string]*event.BackupFinished),
+		stored:    make(map[string]map[string]bool),
+		manifests: make(map[string]map[string]func(ctx context.Context) error),
+	}
+}
+
+// Attempt backs up the databases that are not yet stored in every backend of the job
+func (r *BackupRun) Attempt(ctx context.Context) error {
+	databases := r.job.databases()
+
+	var errs []error
+	for _, database := range databases {
+		err := r.attemptDatabase(ctx, database)
+		if err != nil && len(databases) > 1 {
+			err = fmt.Errorf("database %s: %w", database, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	publishInventory(ctx, r.job.S3, r.job.Local)
+
+	return errors.Join(errs...)
+}
+
+// Finish publishes the outcome of every database the attempts of the run took, it is called after the last attempt
+func (r *BackupRun) Finish() {
+	for _, database := range r.job.databases() {
+		if result, ok := r.results[database]; ok {
+			event.Publish(*result)
+		}
+	}
+}
+
+// merge adds the outcome of an attempt at the database to the outcome of the run. err is everything
+// that failed for the database in the attempt, the attempt's result is nil when no backup was taken.
+func (r *BackupRun) merge(database string, attempt *event.BackupFinished, err error) {
+	result, ok := r.results[database]
+	if !ok {
+		if attempt == nil {
+			return
+		}
+		result = &event.BackupFinished{Job: attempt.Job, Database: attempt.Database, Started: attempt.Started}
+		r.results[database] = result
+	}
+
+	if attempt != nil {
+		result.Backup = attempt.Backup
+		result.Stage = attempt.Stage
+		result.DumpedBytes = attempt.DumpedBytes
+		result.CompressedBytes = attempt.CompressedBytes
+
+		// Uploads to backends the attempt did not take keep the outcome of an earlier attempt
+		for _, upload := range attempt.Uploads {
+			result.Uploads = slices.DeleteFunc(result.Uploads, func(previous event.Upload) bool {
+				return previous.Backend == upload.Backend
+			})
+			result.Uploads = append(result.Uploads, upload)
+		}
+	}
+
+	result.Finished = time.Now()
+	result.Err = err
+	if err == nil {
+		result.Stage = ""
+	}
+}
+
+// attemptDatabase stores the missing manifests of the database, then backs it up to the backends it is not stored in yet
+func (r *BackupRun) attemptDatabase(ctx context.Context, database string) error {
 	logger := log.Logger.With().Str("caller", "backup").Logger()
 
+	if r.stored[database] == nil {
+		r.stored[database] = make(map[string]bool)
+	}
+	stored := r.stored[database]
+
+	// A database every backend already holds is left as an earlier attempt recorded it
+	var errs []error
+	var result *event.BackupFinished
+	retried := len(r.manifests[database]) > 0
+	defer func() {
+		if result != nil || retried {
+			r.merge(database, result, errors.Join(errs...))
+		}
+	}()
+
+	for backend, storeManifest := range r.manifests[database] {
+		if err := storeManifest(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to store manifest in %s storage: %w", backend, err))
+			continue
+		}
+
+		logger.Info().Str("database", databaseLabel(database)).Str("backend", backend).Msg("stored manifest of the backup stored by an earlier attempt")
+		delete(r.manifests[database], backend)
+		stored[backend] = true
+	}
+
+	// Backends whose backup is stored but whose manifest is missing are not backed up again
+	pending := r.manifests[database]
+	job := r.job
+	job.S3 = job.S3 && !stored[event.BackendS3] && pending[event.BackendS3] == nil
+	job.Local = job.Local && !stored[event.BackendLocal] && pending[event.BackendLocal] == nil
+	if !job.S3 && !job.Local {
+		return errors.Join(errs...)
+	}
+
+	result = &event.BackupFinished{
+		Job:      job.label(),
+		Database: databaseLabel(database),
+		Started:  time.Now(),
+	}
+
+	manifests := make(map[string]func(ctx context.Context) error)
+	err := backupDatabase(ctx, job, database, result, manifests)
+
+	result.Finished = time.Now()
+	result.Err = err
+
+	// A failed dump, compression or encryption leaves nothing worth keeping, the next attempt takes it again
+	if result.Stage == "" || result.Stage == event.StageUpload {
+		for _, upload := range result.Uploads {
+			if upload.Err == nil {
+				stored[upload.Backend] = true
+			}
+		}
+		if len(manifests) > 0 {
+			r.manifests[database] = manifests
+		}
+	}
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// backupDatabase dumps a single database and uploads it to the job's storage backends.
+// It records the failed stage and the number of bytes passing through each step in result. When a backup was stored
+// but its manifest was not, the function storing the manifest is added to manifests under the backend.
+func backupDatabase(ctx context.Context, job BackupJob, database string, result *event.BackupFinished, manifests map[string]func(ctx context.Context) error) error {
+	loggerContext := log.Logger.With().Str("caller", "backup")
+	if job.Name != "" {
+		loggerContext = loggerContext.Str("job", job.Name)
+	}
+	logger := loggerContext.Logger()
+
 	// Get database name for logging context
-	dbName := "unknown"
-	if config.Loaded.Postgres.Database != nil {
-		dbName = *config.Loaded.Postgres.Database
+	dbName := database
+	if dbName == "" {
+		dbName = "unknown"
+		if config.Loaded.Postgres.Database != nil {
+			dbName = *config.Loaded.Postgres.Database
+		}
 	}
 
 	logger.Info().Str("database", dbName).Msg("starting database backup")
 
-	process, err := Dump(ctx)
+	// Named before dumping, so that failures report the backup they were taking
+	target := job.Target(database)
+	result.Backup = target.Name(time.Now().Format(storage.BackupTimeFormat))
+
+	// Stops pg_dump if an upload fails, so it doesn't block writing to a pipe nobody reads
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	process, err := Dump(ctx, database)
 	if err != nil {
 		logger.Error().Err(err).Str("database", dbName).Msg("failed to create database dump")
-		return
+		result.Stage = event.StageDump
+		return fmt.Errorf("failed to create database dump: %w", err)
 	}
 
 	if err := process.Start(); err != nil {
 		logger.Error().Err(err).Str("database", dbName).Msg("failed to start pg_dump process")
-		return
+		result.Stage = event.StageDump
+		return fmt.Errorf("failed to start pg_dump process: %w", err)
 	}
 
-	var reader io.Reader = process
+	// Errors of every step surface at the end of the chain, failed tells which step they came from
+	failed := &failedStage{}
 
-	if config.Loaded.Compress != nil {
-		logger.Info().Str("algorithm", config.Loaded.Compress.Algorithm).Int("compress_level", *config.Loaded.Compress.CompressLevel).Str("database", dbName).Msg("starting compression stream")
-		reader, err = Compress(reader)
+	dumped := &countingReader{reader: &stageReader{reader: process, stage: event.StageDump, failed: failed}}
+	var reader io.Reader = dumped
+
+	if job.Compress != nil {
+		logger.Info().Str("algorithm", job.Compress.Algorithm).Int("compress_level", *job.Compress.CompressLevel).Str("database", dbName).Msg("starting compression stream")
+		reader, err = Compress(reader, job.Compress)
 		if err != nil {
-			logger.Error().Err(err).Str("database", dbName).Str("algorithm", config.Loaded.Compress.Algorithm).Msg("failed to compress database dump")
-			return
+			logger.Error().Err(err).Str("database", dbName).Str("algorithm", job.Compress.Algorithm).Msg("failed to compress database dump")
+			cancel()
+			_ = process.Wait()
+			result.Stage = event.StageCompress
+			return fmt.Errorf("failed to compress database dump: %w", err)
+		}
+	}
+
+	if job.Compress != nil {
+		reader = &stageReader{reader: reader, stage: event.StageCompress, failed: failed}
+	}
+
+	compressed := &countingReader{reader: reader}
+	reader = compressed
+
+	// Sidecars the encryption needs to be stored next to the backup, keyed by suffix
+	var sidecars map[string][]byte
+
+	if job.Encrypt != nil {
+		logger.Info().Str("method", job.Encrypt.GetMethod()).Str("database", dbName).Msg("starting encryption stream")
+		reader, sidecars, err = Encrypt(reader, job.Encrypt)
+		if err != nil {
+			logger.Error().Err(err).Str("database", dbName).Msg("failed to encrypt database dump")
+			if closer, ok := compressed.reader.(io.Closer); ok {
+				closer.Close()
+			}
+			cancel()
+			_ = process.Wait()
+			result.Stage = event.StageEncrypt
+			return fmt.Errorf("failed to encrypt database dump: %w", err)
 		}
+		reader = &stageReader{reader: reader, stage: event.StageEncrypt, failed: failed}
+	}
+
+	// Hashes the backup as it is stored, for its manifest
+	var checksum *checksumReader
+	if config.Loaded.Manifest.IsSigning() {
+		checksum = newChecksumReader(reader)
+		reader = checksum
 	}
 
+	var errs []error
+
 	// Buffer the data if we need to upload to multiple storage backends
 	var buffer *bytes.Buffer
-	bothConfigured := config.Loaded.Storage.S3 != nil && config.Loaded.Storage.Local != nil
+	bothConfigured := job.S3 && job.Local
 
 	if bothConfigured {
 		// Read all data into buffer for multiple uploads
@@ -56,12 +298,16 @@ func Backup(ctx context.Context) {
 		_, err = io.Copy(buffer, reader)
 		if err != nil {
 			logger.Error().Err(err).Str("database", dbName).Msg("failed to buffer backup data for storage")
-			return
+			errs = append(errs, fmt.Errorf("failed to buffer backup data: %w", err))
+			result.Stage = failed.get(event.StageDump)
 		}
 	}
 
-	// Upload to S3 if configured
-	if config.Loaded.Storage.S3 != nil {
+	// Nothing to upload if buffering failed
+	buffered := len(errs) == 0
+
+	// Upload to S3 if the job uses it
+	if job.S3 && buffered {
 		var s3Reader io.Reader
 		if bothConfigured {
 			s3Reader = bytes.NewReader(buffer.Bytes())
@@ -69,15 +315,37 @@ func Backup(ctx context.Context) {
 			s3Reader = reader
 		}
 
-		if err := s3.Upload(context.Background(), s3Reader); err != nil {
+		uploaded := &countingReader{reader: s3Reader}
+		err := storeS3Sidecars(ctx, result.Backup, sidecars)
+		if err == nil {
+			err = s3.Upload(ctx, uploaded, target, result.Backup)
+			if err != nil {
+				removeS3Sidecars(ctx, result.Backup, sidecars)
+			}
+		}
+		if err == nil && checksum != nil {
+			store := func(ctx context.Context) error {
+				return storeManifest(job, database, result, checksum, func(sidecars map[string][]byte) error {
+					return storeS3Sidecars(ctx, result.Backup, sidecars)
+				})
+			}
+			if err = store(ctx); err != nil {
+				manifests[event.BackendS3] = store
+			}
+		}
+		result.Uploads = append(result.Uploads, event.Upload{Backend: event.BackendS3, Bytes: uploaded.Count(), Err: err})
+
+		if err != nil {
+			result.Stage = failed.get(event.StageUpload)
 			logger.Error().Err(err).Str("database", dbName).Str("bucket", config.Loaded.Storage.S3.Bucket).Msg("failed to upload backup to S3")
+			errs = append(errs, err)
 		} else {
 			logger.Info().Str("database", dbName).Str("bucket", config.Loaded.Storage.S3.Bucket).Msg("successfully uploaded backup to S3")
 		}
 	}
 
-	// Upload to local storage if configured
-	if config.Loaded.Storage.Local != nil {
+	// Upload to local storage if the job uses it
+	if job.Local && buffered {
 		var localReader io.Reader
 		if bothConfigured {
 			localReader = bytes.NewReader(buffer.Bytes())
@@ -85,16 +353,213 @@ func Backup(ctx context.Context) {
 			localReader = reader
 		}
 
-		if err := local.Upload(context.Background(), localReader); err != nil {
+		uploaded := &countingReader{reader: localReader}
+		err := storeLocalSidecars(result.Backup, sidecars)
+		if err == nil {
+			err = local.Upload(ctx, uploaded, target, result.Backup)
+			if err != nil {
+				removeLocalSidecars(result.Backup, sidecars)
+			}
+		}
+		if err == nil && checksum != nil {
+			store := func(context.Context) error {
+				return storeManifest(job, database, result, checksum, func(sidecars map[string][]byte) error {
+					return storeLocalSidecars(result.Backup, sidecars)
+				})
+			}
+			if err = store(ctx); err != nil {
+				manifests[event.BackendLocal] = store
+			}
+		}
+		result.Uploads = append(result.Uploads, event.Upload{Backend: event.BackendLocal, Bytes: uploaded.Count(), Err: err})
+
+		if err != nil {
+			result.Stage = failed.get(event.StageUpload)
 			logger.Error().Err(err).Str("database", dbName).Str("directory", config.Loaded.Storage.Local.Directory).Msg("failed to upload backup to local storage")
+			errs = append(errs, err)
 		} else {
 			logger.Info().Str("database", dbName).Str("directory", config.Loaded.Storage.Local.Directory).Msg("successfully uploaded backup to local storage")
 		}
 	}
 
+	if len(errs) > 0 {
+		// Unblock the compression goroutine and pg_dump, nothing reads their output anymore
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		cancel()
+	}
+
 	if err := process.Wait(); err != nil {
 		logger.Error().Err(err).Str("database", dbName).Msg("pg_dump process finished with error")
+		if len(errs) == 0 {
+			errs = append(errs, fmt.Errorf("pg_dump process finished with error: %w", err))
+			result.Stage = event.StageDump
+		}
+	}
+
+	result.DumpedBytes = dumped.Count()
+	result.CompressedBytes = compressed.Count()
+
+	if err := errors.Join(errs...); err != nil {
+		logger.Error().Err(err).Str("database", dbName).Msg("database backup failed")
+		return err
 	}
 
 	logger.Info().Str("database", dbName).Msg("database backup completed successfully")
+	return nil
+}
+
+// storeManifest signs the manifest of a backup that was stored completely and stores it with store
+func storeManifest(job BackupJob, database string, result *event.BackupFinished, checksum *checksumReader, store func(map[string][]byte) error) error {
+	manifest, err := newManifest(job, database, result.Backup, result.Started, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+
+	return store(map[string][]byte{storage.ManifestSuffix: manifest})
+}
+
+// storeS3Sidecars stores the sidecars of the backup in S3. They are stored before the backup,
+// so that a backup is never stored without them.
+func storeS3Sidecars(ctx context.Context, name string, sidecars map[string][]byte) error {
+	if len(sidecars) == 0 {
+		return nil
+	}
+
+	client, err := s3.CreateClient()
+	if err != nil {
+		return err
+	}
+
+	for suffix, data := range sidecars {
+		if err := s3.WriteSidecar(ctx, client, s3.ObjectKey(name), suffix, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeLocalSidecars stores the sidecars of the backup in local storage before the backup
+func storeLocalSidecars(name string, sidecars map[string][]byte) error {
+	for suffix, data := range sidecars {
+		if err := local.WriteSidecar(local.BackupPath(name), suffix, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sidecarCleanupTimeout bounds removing the sidecars of a failed upload, which also happens after the attempt timed out
+const sidecarCleanupTimeout = time.Minute
+
+// removeS3Sidecars removes the sidecars stored for a backup whose upload failed, so that the next attempt
+// doesn't leave them behind. Sidecars under an Object Lock retention stay until garbage collection.
+func removeS3Sidecars(ctx context.Context, name string, sidecars map[string][]byte) {
+	if len(sidecars) == 0 {
+		return
+	}
+
+	logger := log.Logger.With().Str("caller", "backup").Logger()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sidecarCleanupTimeout)
+	defer cancel()
+
+	client, err := s3.CreateClient()
+	if err != nil {
+		logger.Warn().Err(err).Str("backup", name).Msg("failed to remove sidecars of the failed S3 upload")
+		return
+	}
+
+	for suffix := range sidecars {
+		if err := s3.RemoveSidecar(ctx, client, s3.ObjectKey(name), suffix); err != nil {
+			logger.Warn().Err(err).Str("backup", name).Msg("failed to remove sidecar of the failed S3 upload")
+		}
+	}
+}
+
+// removeLocalSidecars removes the sidecars stored for a backup whose local upload failed
+func removeLocalSidecars(name string, sidecars map[string][]byte) {
+	logger := log.Logger.With().Str("caller", "backup").Logger()
+
+	for suffix := range sidecars {
+		if err := local.RemoveSidecar(local.BackupPath(name), suffix); err != nil {
+			logger.Warn().Err(err).Str("backup", name).Msg("failed to remove sidecar of the failed local upload")
+		}
+	}
+}
+
+// failedStage is the step of a backup whose reader failed first, steps run in their own goroutines
+type failedStage struct {
+	mu    sync.Mutex
+	stage event.Stage
+}
+
+func (f *failedStage) set(stage event.Stage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stage == "" {
+		f.stage = stage
+	}
+}
+
+// get returns the step that failed, or fallback when no reader of the chain failed
+func (f *failedStage) get(fallback event.Stage) event.Stage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stage == "" {
+		return fallback
+	}
+	return f.stage
+}
+
+// stageReader records its step in failed when reading from it fails
+type stageReader struct {
+	reader io.Reader
+	stage  event.Stage
+	failed *failedStage
+}
+
+func (r *stageReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.failed.set(r.stage)
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it can be closed, like countingReader
+func (r *stageReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it, it may be read and counted from different goroutines
+type countingReader struct {
+	reader io.Reader
+	count  atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
+
+// Close closes the underlying reader if it can be closed, so that closing the chain unblocks its writer
+func (r *countingReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *countingReader) Count() int64 {
+	return r.count.Load()
 }
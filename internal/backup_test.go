@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+)
+
+func TestBackupRunFinish(t *testing.T) {
+	errUpload := errors.New("connection reset")
+	errDump := errors.New("pg_dump exited with status 1")
+
+	type attempt struct {
+		// result is nil for an attempt that only stored pending manifests
+		result *event.BackupFinished
+		err    error
+	}
+
+	tests := []struct {
+		name     string
+		attempts []attempt
+		// wantEvents is 0 when no attempt took a backup
+		wantEvents  int
+		wantErr     bool
+		wantStage   event.Stage
+		wantUploads map[string]bool
+	}{
+		{
+			name: "first attempt succeeds",
+			attempts: []attempt{
+				{result: &event.BackupFinished{Uploads: []event.Upload{{Backend: event.BackendS3}, {Backend: event.BackendLocal}}}},
+			},
+			wantEvents:  1,
+			wantUploads: map[string]bool{event.BackendS3: true, event.BackendLocal: true},
+		},
+		{
+			name: "upload recovered by a retry",
+			attempts: []attempt{
+				{
+					result: &event.BackupFinished{Stage: event.StageUpload, Uploads: []event.Upload{
+						{Backend: event.BackendS3, Err: errUpload},
+						{Backend: event.BackendLocal},
+					}},
+					err: errUpload,
+				},
+				{result: &event.BackupFinished{Uploads: []event.Upload{{Backend: event.BackendS3}}}},
+			},
+			wantEvents:  1,
+			wantUploads: map[string]bool{event.BackendS3: true, event.BackendLocal: true},
+		},
+		{
+			name: "manifest stored by a retry",
+			attempts: []attempt{
+				{result: &event.BackupFinished{Stage: event.StageUpload, Uploads: []event.Upload{{Backend: event.BackendS3}}}, err: errUpload},
+				{},
+			},
+			wantEvents:  1,
+			wantUploads: map[string]bool{event.BackendS3: true},
+		},
+		{
+			name: "every attempt fails",
+			attempts: []attempt{
+				{result: &event.BackupFinished{Stage: event.StageDump}, err: errDump},
+				{result: &event.BackupFinished{Stage: event.StageDump}, err: errDump},
+				{result: &event.BackupFinished{Stage: event.StageDump}, err: errDump},
+			},
+			wantEvents: 1,
+			wantErr:    true,
+			wantStage:  event.StageDump,
+		},
+		{
+			name:     "no attempt took a backup",
+			attempts: []attempt{{}},
+		},
+	}
+
+	var mu sync.Mutex
+	var published []event.BackupFinished
+	event.Subscribe(func(e event.Event) {
+		if backup, ok := e.(event.BackupFinished); ok && backup.Job == "finish-test" {
+			mu.Lock()
+			published = append(published, backup)
+			mu.Unlock()
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			published = nil
+			mu.Unlock()
+
+			run := NewBackupRun(BackupJob{Name: "finish-test", Databases: []string{"app"}})
+			for _, attempt := range tt.attempts {
+				if attempt.result != nil {
+					attempt.result.Job = "finish-test"
+					attempt.result.Database = "app"
+				}
+				run.merge("app", attempt.result, attempt.err)
+			}
+
+			mu.Lock()
+			if len(published) != 0 {
+				t.Errorf("%d events published before Finish, want none", len(published))
+			}
+			mu.Unlock()
+
+			run.Finish()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(published) != tt.wantEvents {
+				t.Fatalf("%d events published, want %d", len(published), tt.wantEvents)
+			}
+			if tt.wantEvents == 0 {
+				return
+			}
+
+			got := published[0]
+			if (got.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, want error %v", got.Err, tt.wantErr)
+			}
+			if got.Stage != tt.wantStage {
+				t.Errorf("Stage = %q, want %q", got.Stage, tt.wantStage)
+			}
+
+			uploads := make(map[string]bool)
+			for _, upload := range got.Uploads {
+				if _, ok := uploads[upload.Backend]; ok {
+					t.Errorf("backend %s reported more than once", upload.Backend)
+				}
+				uploads[upload.Backend] = upload.Err == nil
+			}
+			if len(uploads) != len(tt.wantUploads) {
+				t.Errorf("uploads = %v, want %v", uploads, tt.wantUploads)
+			}
+			for backend, ok := range tt.wantUploads {
+				if uploads[backend] != ok {
+					t.Errorf("upload to %s succeeded = %v, want %v", backend, uploads[backend], ok)
+				}
+			}
+		})
+	}
+}
@@ -17,12 +17,12 @@ const (
 	algorithmGzip = "gzip"
 )
 
-func Compress(input io.Reader) (io.Reader, error) {
+func Compress(input io.Reader, settings *config.CompressConfig) (io.Reader, error) {
 	r, w := io.Pipe()
 
-	switch config.Loaded.Compress.Algorithm {
+	switch settings.Algorithm {
 	case algorithmZstd:
-		encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*config.Loaded.Compress.CompressLevel)))
+		encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*settings.CompressLevel)))
 		if err != nil {
 			return nil, err
 		}
@@ -37,7 +37,7 @@ func Compress(input io.Reader) (io.Reader, error) {
 
 		return r, nil
 	case algorithmGzip:
-		writer, _ := gzip.NewWriterLevel(w, *config.Loaded.Compress.CompressLevel)
+		writer, _ := gzip.NewWriterLevel(w, *settings.CompressLevel)
 
 		go func() {
 			if _, err := io.Copy(writer, input); err != nil {
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultTelegramAPIURL is the Telegram Bot API endpoint
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// ChatConfig posts a formatted message to the incoming webhook of Slack, Discord or Microsoft Teams
+type ChatConfig struct {
+	WebhookURL string `hcl:"webhook_url"`
+}
+
+func (c *ChatConfig) validate() error {
+	if c.WebhookURL == "" {
+		return errors.New("webhook_url is required")
+	}
+
+	if err := validateURL(c.WebhookURL); err != nil {
+		return fmt.Errorf("webhook_url: %w", err)
+	}
+
+	return nil
+}
+
+// TelegramConfig sends a formatted message through a Telegram bot
+type TelegramConfig struct {
+	ChatID       string  `hcl:"chat_id"`
+	BotTokenFile *string `hcl:"bot_token_file"` // optional: file holding the bot token
+	BotTokenEnv  *string `hcl:"bot_token_env"`  // optional: environment variable holding the bot token
+	APIURL       *string `hcl:"api_url"`        // optional: defaults to https://api.telegram.org
+}
+
+func (t *TelegramConfig) GetAPIURL() string {
+	if t.APIURL == nil {
+		return DefaultTelegramAPIURL
+	}
+
+	return strings.TrimRight(*t.APIURL, "/")
+}
+
+// GetBotToken reads the bot token from bot_token_file or bot_token_env
+func (t *TelegramConfig) GetBotToken() (string, error) {
+	switch {
+	case t.BotTokenFile != nil:
+		data, err := os.ReadFile(*t.BotTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read bot_token_file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case t.BotTokenEnv != nil:
+		token, ok := os.LookupEnv(*t.BotTokenEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s from bot_token_env is not set", *t.BotTokenEnv)
+		}
+		return token, nil
+	default:
+		return "", errors.New("one of bot_token_file and bot_token_env is required")
+	}
+}
+
+func (t *TelegramConfig) validate() error {
+	if t.ChatID == "" {
+		return errors.New("chat_id is required")
+	}
+
+	if t.BotTokenFile != nil && t.BotTokenEnv != nil {
+		return errors.New("only one of bot_token_file and bot_token_env may be set")
+	}
+	if _, err := t.GetBotToken(); err != nil {
+		return err
+	}
+
+	if err := validateURL(t.GetAPIURL()); err != nil {
+		return fmt.Errorf("api_url: %w", err)
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/hashicorp/hcl/v2/hclsimple"
 
@@ -11,15 +13,67 @@ import (
 
 var Loaded *Config
 
+// BackupScheduleName returns the name of the entry of the top-level schedule list at index
+func BackupScheduleName(index int) string {
+	return fmt.Sprintf("backup-%d", index)
+}
+
 type RestoreScheduleConfig struct {
+	Name            *string `hcl:"name"` // optional: defaults to "restore-<index>"
 	Cron            string  `hcl:"cron"`
 	TargetDatabase  string  `hcl:"target_database"`
+	Job             *string `hcl:"job"`              // optional: job block whose backups are restored, defaults to the top-level schedule's backups
+	Database        *string `hcl:"database"`         // optional: database of the job whose backups are restored, required when the job dumps several
 	BackupSelection string  `hcl:"backup_selection"` // "latest", "pattern", "specific"
 	BackupPattern   *string `hcl:"backup_pattern"`   // optional: for pattern-based selection
 	BackupID        *string `hcl:"backup_id"`        // optional: for specific backup selection
 	IncludeS3       *bool   `hcl:"include_s3"`
 	IncludeLocal    *bool   `hcl:"include_local"`
+	Overlap         *string `hcl:"overlap"`       // optional: "skip", "queue" or "allow", defaults to scheduler.overlap
+	Timezone        *string `hcl:"timezone"`      // optional: defaults to scheduler.timezone
+	Jitter          *string `hcl:"jitter"`        // optional: defaults to scheduler.jitter
+	Timeout         *string `hcl:"timeout"`       // optional: defaults to scheduler.timeout
+	Retries         *int    `hcl:"retries"`       // optional: defaults to scheduler.retries
+	RetryBackoff    *string `hcl:"retry_backoff"` // optional: defaults to scheduler.retry_backoff
 	Enabled         *bool   `hcl:"enabled"`
+	// Ping calls URLs when a scheduled restore starts, succeeds and fails
+	Ping *PingConfig `hcl:"ping,block"`
+}
+
+func (r RestoreScheduleConfig) GetName(index int) string {
+	if r.Name != nil {
+		return *r.Name
+	}
+
+	return fmt.Sprintf("restore-%d", index)
+}
+
+// GetJob returns the job block whose backups are restored, nil for the backups of the top-level schedule list
+func (r RestoreScheduleConfig) GetJob(c Config) *JobConfig {
+	if r.Job == nil {
+		return nil
+	}
+
+	for i := range c.Jobs {
+		if c.Jobs[i].Name == *r.Job {
+			return &c.Jobs[i]
+		}
+	}
+
+	return nil
+}
+
+// GetDatabase returns the database whose backups are restored, empty for the backups of the top-level schedule list
+func (r RestoreScheduleConfig) GetDatabase(c Config) string {
+	if r.Database != nil {
+		return *r.Database
+	}
+
+	if job := r.GetJob(c); job != nil {
+		return job.GetDatabases(c)[0]
+	}
+
+	return ""
 }
 
 func (r RestoreScheduleConfig) IsEnabled() bool {
@@ -34,13 +88,124 @@ func (r RestoreScheduleConfig) ShouldIncludeLocal() bool {
 	return r.IncludeLocal == nil || *r.IncludeLocal
 }
 
+// DefaultGCMinAge protects artifacts of backups that may still be running from garbage collection
+const DefaultGCMinAge = time.Hour
+
+type GCScheduleConfig struct {
+	Name         *string `hcl:"name"` // optional: defaults to "gc-<index>"
+	Cron         string  `hcl:"cron"`
+	MinAge       *string `hcl:"min_age"` // optional: only collect artifacts older than this duration, default 1h
+	DryRun       *bool   `hcl:"dry_run"`
+	Overlap      *string `hcl:"overlap"`       // optional: "skip", "queue" or "allow", defaults to scheduler.overlap
+	Timezone     *string `hcl:"timezone"`      // optional: defaults to scheduler.timezone
+	Jitter       *string `hcl:"jitter"`        // optional: defaults to scheduler.jitter
+	Timeout      *string `hcl:"timeout"`       // optional: defaults to scheduler.timeout
+	Retries      *int    `hcl:"retries"`       // optional: defaults to scheduler.retries
+	RetryBackoff *string `hcl:"retry_backoff"` // optional: defaults to scheduler.retry_backoff
+	Enabled      *bool   `hcl:"enabled"`
+}
+
+func (g GCScheduleConfig) GetName(index int) string {
+	if g.Name != nil {
+		return *g.Name
+	}
+
+	return fmt.Sprintf("gc-%d", index)
+}
+
+func (g GCScheduleConfig) IsEnabled() bool {
+	return g.Enabled == nil || *g.Enabled
+}
+
+func (g GCScheduleConfig) IsDryRun() bool {
+	return g.DryRun != nil && *g.DryRun
+}
+
+func (g GCScheduleConfig) GetMinAge() (time.Duration, error) {
+	if g.MinAge == nil {
+		return DefaultGCMinAge, nil
+	}
+
+	return time.ParseDuration(*g.MinAge)
+}
+
+type RetentionScheduleConfig struct {
+	Name         *string `hcl:"name"` // optional: defaults to "retention-<index>"
+	Cron         string  `hcl:"cron"`
+	Overlap      *string `hcl:"overlap"`       // optional: "skip", "queue" or "allow", defaults to scheduler.overlap
+	Timezone     *string `hcl:"timezone"`      // optional: defaults to scheduler.timezone
+	Jitter       *string `hcl:"jitter"`        // optional: defaults to scheduler.jitter
+	Timeout      *string `hcl:"timeout"`       // optional: defaults to scheduler.timeout
+	Retries      *int    `hcl:"retries"`       // optional: defaults to scheduler.retries
+	RetryBackoff *string `hcl:"retry_backoff"` // optional: defaults to scheduler.retry_backoff
+	Enabled      *bool   `hcl:"enabled"`
+}
+
+func (r RetentionScheduleConfig) GetName(index int) string {
+	if r.Name != nil {
+		return *r.Name
+	}
+
+	return fmt.Sprintf("retention-%d", index)
+}
+
+func (r RetentionScheduleConfig) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// DefaultVerifyCount is how many of the newest backups of each job are verified
+const DefaultVerifyCount = 1
+
+type VerifyScheduleConfig struct {
+	Name         *string `hcl:"name"` // optional: defaults to "verify-<index>"
+	Cron         string  `hcl:"cron"`
+	Count        *int    `hcl:"count"`         // optional: number of newest backups verified per job, database and storage, default 1
+	Overlap      *string `hcl:"overlap"`       // optional: "skip", "queue" or "allow", defaults to scheduler.overlap
+	Timezone     *string `hcl:"timezone"`      // optional: defaults to scheduler.timezone
+	Jitter       *string `hcl:"jitter"`        // optional: defaults to scheduler.jitter
+	Timeout      *string `hcl:"timeout"`       // optional: defaults to scheduler.timeout
+	Retries      *int    `hcl:"retries"`       // optional: defaults to scheduler.retries
+	RetryBackoff *string `hcl:"retry_backoff"` // optional: defaults to scheduler.retry_backoff
+	Enabled      *bool   `hcl:"enabled"`
+}
+
+func (v VerifyScheduleConfig) GetName(index int) string {
+	if v.Name != nil {
+		return *v.Name
+	}
+
+	return fmt.Sprintf("verify-%d", index)
+}
+
+func (v VerifyScheduleConfig) IsEnabled() bool {
+	return v.Enabled == nil || *v.Enabled
+}
+
+func (v VerifyScheduleConfig) GetCount() int {
+	if v.Count == nil {
+		return DefaultVerifyCount
+	}
+
+	return *v.Count
+}
+
 type Config struct {
-	Postgres        PostgresConfig          `hcl:"postgres,block"`
-	Storage         storage.Storage         `hcl:"storage,block"`
-	Compress        *CompressConfig         `hcl:"compress,block"`
-	Schedule        []string                `hcl:"schedule,optional"`
-	RestoreSchedule []RestoreScheduleConfig `hcl:"restore_schedule,block"`
-	Verbose         *bool                   `hcl:"verbose"`
+	Postgres          PostgresConfig            `hcl:"postgres,block"`
+	Storage           storage.Storage           `hcl:"storage,block"`
+	Compress          *CompressConfig           `hcl:"compress,block"`
+	Encrypt           *EncryptConfig            `hcl:"encrypt,block"`
+	Manifest          *ManifestConfig           `hcl:"manifest,block"`
+	Schedule          []string                  `hcl:"schedule,optional"`
+	Ping              *PingConfig               `hcl:"ping,block"`
+	Jobs              []JobConfig               `hcl:"job,block"`
+	RestoreSchedule   []RestoreScheduleConfig   `hcl:"restore_schedule,block"`
+	GCSchedule        []GCScheduleConfig        `hcl:"gc_schedule,block"`
+	RetentionSchedule []RetentionScheduleConfig `hcl:"retention_schedule,block"`
+	VerifySchedule    []VerifyScheduleConfig    `hcl:"verify_schedule,block"`
+	Scheduler         *SchedulerConfig          `hcl:"scheduler,block"`
+	HTTP              *HTTPConfig               `hcl:"http,block"`
+	Notify            []NotifyConfig            `hcl:"notify,block"`
+	Verbose           *bool                     `hcl:"verbose"`
 }
 
 func (c Config) IsVerbose() bool {
@@ -69,6 +234,30 @@ func (c Config) Validate() error {
 		if c.Storage.S3.RetentionCount != nil && *c.Storage.S3.RetentionCount <= 0 {
 			return fmt.Errorf("s3 retention_count must be positive, got %d", *c.Storage.S3.RetentionCount)
 		}
+
+		if err := c.Storage.S3.ValidateConnection(); err != nil {
+			return fmt.Errorf("s3: %w", err)
+		}
+
+		if err := c.Storage.S3.ValidateCredentials(); err != nil {
+			return fmt.Errorf("s3: %w", err)
+		}
+
+		if err := c.Storage.S3.ValidateUpload(); err != nil {
+			return fmt.Errorf("s3: %w", err)
+		}
+
+		if c.Storage.S3.ServerSideEncryption != nil {
+			if err := c.Storage.S3.ServerSideEncryption.Validate(); err != nil {
+				return fmt.Errorf("s3 server_side_encryption: %w", err)
+			}
+		}
+
+		if c.Storage.S3.ObjectLock != nil {
+			if err := c.Storage.S3.ObjectLock.Validate(); err != nil {
+				return fmt.Errorf("s3 object_lock: %w", err)
+			}
+		}
 	}
 
 	if c.Storage.Local != nil {
@@ -85,6 +274,56 @@ func (c Config) Validate() error {
 		}
 	}
 
+	if c.Scheduler != nil {
+		if err := c.Scheduler.Validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.HTTP != nil {
+		if err := c.HTTP.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Encrypt != nil {
+		if err := c.Encrypt.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Manifest != nil {
+		if err := c.Manifest.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Ping != nil {
+		if err := c.Ping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Decode and validate notifiers, the slice shares its elements with the loaded config
+	for i := range c.Notify {
+		if err := c.Notify[i].decode(c, i); err != nil {
+			return err
+		}
+	}
+
+	// Validate backup jobs
+	jobNames := make(map[string]bool, len(c.Jobs))
+	for i, job := range c.Jobs {
+		if err := job.validate(c, i); err != nil {
+			return err
+		}
+
+		if jobNames[job.Name] {
+			return fmt.Errorf("job %q: defined more than once", job.Name)
+		}
+		jobNames[job.Name] = true
+	}
+
 	// Validate restore schedules
 	for i, restoreSchedule := range c.RestoreSchedule {
 		if err := c.validateRestoreSchedule(restoreSchedule, i); err != nil {
@@ -92,6 +331,93 @@ func (c Config) Validate() error {
 		}
 	}
 
+	// Validate garbage collection schedules
+	for i, gcSchedule := range c.GCSchedule {
+		if gcSchedule.Cron == "" {
+			return fmt.Errorf("gc_schedule[%d]: cron expression is required", i)
+		}
+
+		minAge, err := gcSchedule.GetMinAge()
+		if err != nil {
+			return fmt.Errorf("gc_schedule[%d]: invalid min_age: %w", i, err)
+		}
+		if minAge < 0 {
+			return fmt.Errorf("gc_schedule[%d]: min_age must not be negative, got %s", i, minAge)
+		}
+
+		if err := validateScheduleOptions(gcSchedule.Overlap, gcSchedule.Timezone, gcSchedule.Jitter,
+			gcSchedule.Timeout, gcSchedule.Retries, gcSchedule.RetryBackoff); err != nil {
+			return fmt.Errorf("gc_schedule[%d]: %w", i, err)
+		}
+	}
+
+	// Validate retention schedules
+	for i, retentionSchedule := range c.RetentionSchedule {
+		if retentionSchedule.Cron == "" {
+			return fmt.Errorf("retention_schedule[%d]: cron expression is required", i)
+		}
+
+		if err := validateScheduleOptions(retentionSchedule.Overlap, retentionSchedule.Timezone, retentionSchedule.Jitter,
+			retentionSchedule.Timeout, retentionSchedule.Retries, retentionSchedule.RetryBackoff); err != nil {
+			return fmt.Errorf("retention_schedule[%d]: %w", i, err)
+		}
+	}
+
+	// Validate verify schedules
+	for i, verifySchedule := range c.VerifySchedule {
+		if verifySchedule.Cron == "" {
+			return fmt.Errorf("verify_schedule[%d]: cron expression is required", i)
+		}
+
+		if verifySchedule.GetCount() <= 0 {
+			return fmt.Errorf("verify_schedule[%d]: count must be positive, got %d", i, verifySchedule.GetCount())
+		}
+
+		if err := validateScheduleOptions(verifySchedule.Overlap, verifySchedule.Timezone, verifySchedule.Jitter,
+			verifySchedule.Timeout, verifySchedule.Retries, verifySchedule.RetryBackoff); err != nil {
+			return fmt.Errorf("verify_schedule[%d]: %w", i, err)
+		}
+	}
+
+	return c.validateScheduleNames()
+}
+
+// validateScheduleNames rejects schedules sharing a name across every kind of schedule,
+// the scheduler state, leader locks and `schedule trigger` all tell schedules apart by name
+func (c Config) validateScheduleNames() error {
+	type schedule struct {
+		block string
+		name  string
+	}
+
+	var schedules []schedule
+	for i := range c.Schedule {
+		schedules = append(schedules, schedule{fmt.Sprintf("schedule[%d]", i), BackupScheduleName(i)})
+	}
+	for i, job := range c.Jobs {
+		schedules = append(schedules, schedule{fmt.Sprintf("job[%d]", i), job.Name})
+	}
+	for i, restoreSchedule := range c.RestoreSchedule {
+		schedules = append(schedules, schedule{fmt.Sprintf("restore_schedule[%d]", i), restoreSchedule.GetName(i)})
+	}
+	for i, gcSchedule := range c.GCSchedule {
+		schedules = append(schedules, schedule{fmt.Sprintf("gc_schedule[%d]", i), gcSchedule.GetName(i)})
+	}
+	for i, retentionSchedule := range c.RetentionSchedule {
+		schedules = append(schedules, schedule{fmt.Sprintf("retention_schedule[%d]", i), retentionSchedule.GetName(i)})
+	}
+	for i, verifySchedule := range c.VerifySchedule {
+		schedules = append(schedules, schedule{fmt.Sprintf("verify_schedule[%d]", i), verifySchedule.GetName(i)})
+	}
+
+	seen := make(map[string]string, len(schedules))
+	for _, schedule := range schedules {
+		if other, ok := seen[schedule.name]; ok {
+			return fmt.Errorf("%s: schedule name %q is already used by %s", schedule.block, schedule.name, other)
+		}
+		seen[schedule.name] = schedule.block
+	}
+
 	return nil
 }
 
@@ -135,11 +461,56 @@ func (c Config) validateRestoreSchedule(rs RestoreScheduleConfig, index int) err
 		}
 	}
 
+	if rs.Job != nil {
+		job := rs.GetJob(c)
+		if job == nil {
+			return fmt.Errorf("restore_schedule[%d]: job %q is not defined", index, *rs.Job)
+		}
+
+		databases := job.GetDatabases(c)
+		switch {
+		case rs.Database != nil && !slices.Contains(databases, *rs.Database):
+			return fmt.Errorf("restore_schedule[%d]: job %q does not back up database '%s'", index, *rs.Job, *rs.Database)
+		case rs.Database == nil && len(databases) > 1:
+			return fmt.Errorf("restore_schedule[%d]: database is required since job %q backs up %d databases", index, *rs.Job, len(databases))
+		}
+	} else if rs.Database != nil {
+		return fmt.Errorf("restore_schedule[%d]: database requires job, backups of the top-level schedule are of postgres.database", index)
+	}
+
+	if rs.Overlap != nil {
+		if err := validateOverlap(*rs.Overlap); err != nil {
+			return fmt.Errorf("restore_schedule[%d]: overlap %w", index, err)
+		}
+	}
+
+	if rs.Timezone != nil {
+		if err := validateTimezone(*rs.Timezone); err != nil {
+			return fmt.Errorf("restore_schedule[%d]: timezone: %w", index, err)
+		}
+	}
+
+	if rs.Jitter != nil {
+		if err := validateJitter(*rs.Jitter); err != nil {
+			return fmt.Errorf("restore_schedule[%d]: jitter: %w", index, err)
+		}
+	}
+
+	if err := validateRetry(rs.Timeout, rs.Retries, rs.RetryBackoff); err != nil {
+		return fmt.Errorf("restore_schedule[%d]: %w", index, err)
+	}
+
 	// Validate that at least one storage source is enabled
 	if !rs.ShouldIncludeS3() && !rs.ShouldIncludeLocal() {
 		return fmt.Errorf("restore_schedule[%d]: at least one of include_s3 or include_local must be true", index)
 	}
 
+	if rs.Ping != nil {
+		if err := rs.Ping.Validate(); err != nil {
+			return fmt.Errorf("restore_schedule[%d]: %w", index, err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,386 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+// baseConfig is the smallest configuration that passes validation
+const baseConfig = `
+postgres {
+  version = 17
+  host    = "localhost"
+}
+
+storage {
+  local {
+    directory = "/var/backups"
+  }
+}
+
+compress {
+  algorithm = "zstd"
+}
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		// config is appended to baseConfig
+		config string
+		// modify changes the decoded config before it is validated
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{name: "minimal"},
+		{
+			name: "jobs and schedules with distinct names",
+			config: `
+schedule = ["0 * * * *"]
+
+job "nightly" {
+  cron = "0 3 * * *"
+}
+
+gc_schedule {
+  cron = "0 4 * * *"
+}
+
+verify_schedule {
+  name = "verify-nightly"
+  cron = "0 5 * * *"
+}
+`,
+		},
+		{
+			name:    "unsupported compress algorithm",
+			modify:  func(c *Config) { c.Compress.Algorithm = "lz4" },
+			wantErr: "compress.algorithm: unsupported algorithm",
+		},
+		{
+			name: "negative local retention_count",
+			modify: func(c *Config) {
+				count := -1
+				c.Storage.Local.RetentionCount = &count
+			},
+			wantErr: "local retention_count must be positive, got -1",
+		},
+		{
+			name: "job without cron",
+			config: `
+job "nightly" {
+  cron = ""
+}
+`,
+			wantErr: `job "nightly": cron expression is required`,
+		},
+		{
+			name: "job with an unconfigured storage",
+			config: `
+job "nightly" {
+  cron     = "0 3 * * *"
+  storages = ["s3"]
+}
+`,
+			wantErr: `job "nightly": storage "s3" is not configured`,
+		},
+		{
+			name: "job defined twice",
+			config: `
+job "nightly" {
+  cron = "0 3 * * *"
+}
+
+job "nightly" {
+  cron = "0 4 * * *"
+}
+`,
+			wantErr: `job "nightly": defined more than once`,
+		},
+		{
+			name: "job named like a backup schedule",
+			config: `
+schedule = ["0 * * * *"]
+
+job "backup-0" {
+  cron = "0 3 * * *"
+}
+`,
+			wantErr: `job[0]: schedule name "backup-0" is already used by schedule[0]`,
+		},
+		{
+			name: "verify schedule named like a job",
+			config: `
+job "nightly" {
+  cron = "0 3 * * *"
+}
+
+verify_schedule {
+  name = "nightly"
+  cron = "0 5 * * *"
+}
+`,
+			wantErr: `verify_schedule[0]: schedule name "nightly" is already used by job[0]`,
+		},
+		{
+			name: "schedules sharing a default name",
+			config: `
+gc_schedule {
+  cron = "0 4 * * *"
+}
+
+retention_schedule {
+  name = "gc-0"
+  cron = "0 5 * * *"
+}
+`,
+			wantErr: `retention_schedule[0]: schedule name "gc-0" is already used by gc_schedule[0]`,
+		},
+		{
+			name: "gc schedule without cron",
+			config: `
+gc_schedule {
+  cron = ""
+}
+`,
+			wantErr: "gc_schedule[0]: cron expression is required",
+		},
+		{
+			name: "negative gc min_age",
+			config: `
+gc_schedule {
+  cron    = "0 4 * * *"
+  min_age = "-1h"
+}
+`,
+			wantErr: "gc_schedule[0]: min_age must not be negative",
+		},
+		{
+			name: "verify count of zero",
+			config: `
+verify_schedule {
+  cron  = "0 5 * * *"
+  count = 0
+}
+`,
+			wantErr: "verify_schedule[0]: count must be positive, got 0",
+		},
+		{
+			name: "restore schedule with an unknown backup_selection",
+			config: `
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "oldest"
+}
+`,
+			wantErr: "restore_schedule[0]: backup_selection must be one of",
+		},
+		{
+			name: "restore schedule without a storage",
+			config: `
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  include_s3       = false
+  include_local    = false
+}
+`,
+			wantErr: "restore_schedule[0]: at least one of include_s3 or include_local must be true",
+		},
+		{
+			name: "restore schedule of a job database",
+			config: `
+job "nightly" {
+  cron      = "0 3 * * *"
+  databases = ["app", "billing"]
+}
+
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  job              = "nightly"
+  database         = "billing"
+}
+`,
+		},
+		{
+			name: "restore schedule of a job without databases",
+			config: `
+job "nightly" {
+  cron = "0 3 * * *"
+}
+
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  job              = "nightly"
+}
+`,
+		},
+		{
+			name: "restore schedule of an undefined job",
+			config: `
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  job              = "nightly"
+}
+`,
+			wantErr: `restore_schedule[0]: job "nightly" is not defined`,
+		},
+		{
+			name: "restore schedule of a database the job does not back up",
+			config: `
+job "nightly" {
+  cron      = "0 3 * * *"
+  databases = ["app"]
+}
+
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  job              = "nightly"
+  database         = "billing"
+}
+`,
+			wantErr: `restore_schedule[0]: job "nightly" does not back up database 'billing'`,
+		},
+		{
+			name: "restore schedule without the database of a job with several",
+			config: `
+job "nightly" {
+  cron      = "0 3 * * *"
+  databases = ["app", "billing"]
+}
+
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  job              = "nightly"
+}
+`,
+			wantErr: `restore_schedule[0]: database is required since job "nightly" backs up 2 databases`,
+		},
+		{
+			name: "restore schedule with a database but no job",
+			config: `
+restore_schedule {
+  cron             = "0 6 * * *"
+  target_database  = "restored"
+  backup_selection = "latest"
+  database         = "app"
+}
+`,
+			wantErr: "restore_schedule[0]: database requires job",
+		},
+		{
+			name: "catch up without a state file",
+			config: `
+scheduler {
+  catch_up = true
+}
+`,
+			wantErr: "scheduler.catch_up: state_file is required",
+		},
+		{
+			name: "s3 leader lock without s3 storage",
+			config: `
+scheduler {
+  leader_lock {
+    backend = "s3"
+  }
+}
+`,
+			wantErr: `scheduler.leader_lock: backend "s3" requires s3 storage`,
+		},
+		{
+			name: "manifest require without public keys",
+			config: `
+manifest {
+  require = true
+}
+`,
+			wantErr: "manifest: require needs public_key_files",
+		},
+		{
+			name: "negative retries",
+			config: `
+job "nightly" {
+  cron    = "0 3 * * *"
+  retries = -1
+}
+`,
+			wantErr: `job "nightly": retries: must not be negative, got -1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			err := hclsimple.Decode("config.hcl", []byte(baseConfig+tt.config), nil, &cfg)
+			if err != nil {
+				t.Fatalf("failed to decode config: %v", err)
+			}
+			if tt.modify != nil {
+				tt.modify(&cfg)
+			}
+
+			err = cfg.Validate()
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJobGetDatabases(t *testing.T) {
+	database := "app"
+
+	tests := []struct {
+		name     string
+		postgres PostgresConfig
+		job      JobConfig
+		want     []string
+	}{
+		{
+			name: "listed databases",
+			job:  JobConfig{Databases: []string{"app", "billing"}},
+			want: []string{"app", "billing"},
+		},
+		{
+			name:     "postgres.database",
+			postgres: PostgresConfig{Database: &database},
+			want:     []string{"app"},
+		},
+		{
+			name: "libpq default database",
+			want: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.job.GetDatabases(Config{Postgres: tt.postgres})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetDatabases() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
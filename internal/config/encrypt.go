@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	EncryptAge      = "age"
+	EncryptOpenPGP  = "openpgp"
+	EncryptEnvelope = "envelope"
+)
+
+// EncryptConfig encrypts backups on the client before they are uploaded and decrypts them on restore.
+// Hosts that only restore need the identities, hosts that only back up need the recipients.
+type EncryptConfig struct {
+	AgeRecipients   []string        `hcl:"age_recipients,optional"` // optional: age public keys backups are encrypted to
+	AgeIdentityFile *string         `hcl:"age_identity_file"`       // optional: file holding the age identities used to decrypt
+	AgeIdentityEnv  *string         `hcl:"age_identity_env"`        // optional: environment variable holding the age identities
+	OpenPGP         *OpenPGPConfig  `hcl:"openpgp,block"`           // optional: OpenPGP keys, an alternative to age
+	Envelope        *EnvelopeConfig `hcl:"envelope,block"`          // optional: master keys for envelope encryption, an alternative to age
+}
+
+// IsEnabled reports whether new backups are encrypted
+func (e *EncryptConfig) IsEnabled() bool {
+	return e.GetMethod() != ""
+}
+
+// GetMethod returns how new backups are encrypted, "age", "openpgp" or "envelope", empty when they are not encrypted
+func (e *EncryptConfig) GetMethod() string {
+	switch {
+	case e == nil:
+		return ""
+	case len(e.AgeRecipients) > 0:
+		return EncryptAge
+	case e.OpenPGP != nil && len(e.OpenPGP.RecipientKeyFiles) > 0:
+		return EncryptOpenPGP
+	case e.Envelope != nil && len(e.Envelope.MasterKeyFiles) > 0:
+		return EncryptEnvelope
+	default:
+		return ""
+	}
+}
+
+// GetAgeRecipients parses the configured age recipients
+func (e *EncryptConfig) GetAgeRecipients() ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(e.AgeRecipients))
+	for _, raw := range e.AgeRecipients {
+		recipient, err := age.ParseX25519Recipient(raw)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt.age_recipients: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// GetAgeIdentities reads the age identities from age_identity_file or age_identity_env
+func (e *EncryptConfig) GetAgeIdentities() ([]age.Identity, error) {
+	var data string
+	switch {
+	case e == nil || (e.AgeIdentityFile == nil && e.AgeIdentityEnv == nil):
+		return nil, errors.New("encrypt.age_identity_file or encrypt.age_identity_env is required to decrypt age encrypted backups")
+	case e.AgeIdentityFile != nil:
+		content, err := os.ReadFile(*e.AgeIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt.age_identity_file: %w", err)
+		}
+		data = string(content)
+	default:
+		content, ok := os.LookupEnv(*e.AgeIdentityEnv)
+		if !ok {
+			return nil, fmt.Errorf("encrypt.age_identity_env: environment variable %s is not set", *e.AgeIdentityEnv)
+		}
+		data = content
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+func (e *EncryptConfig) Validate() error {
+	if e.AgeIdentityFile != nil && e.AgeIdentityEnv != nil {
+		return errors.New("encrypt: only one of age_identity_file and age_identity_env may be set")
+	}
+
+	if _, err := e.GetAgeRecipients(); err != nil {
+		return err
+	}
+
+	if e.OpenPGP != nil {
+		if len(e.AgeRecipients) > 0 && len(e.OpenPGP.RecipientKeyFiles) > 0 {
+			return errors.New("encrypt: age_recipients and openpgp.recipient_key_files can not be used together")
+		}
+
+		if err := e.OpenPGP.validate(); err != nil {
+			return err
+		}
+	}
+
+	if e.Envelope != nil {
+		if len(e.Envelope.MasterKeyFiles) > 0 && (len(e.AgeRecipients) > 0 || (e.OpenPGP != nil && len(e.OpenPGP.RecipientKeyFiles) > 0)) {
+			return errors.New("encrypt: envelope.master_key_files can not be used together with age_recipients or openpgp.recipient_key_files")
+		}
+
+		if err := e.Envelope.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
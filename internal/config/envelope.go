@@ -0,0 +1,92 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeySize is the size of a master key in bytes, master keys are AES-256 keys
+const MasterKeySize = 32
+
+// EnvelopeConfig encrypts every backup with its own random data key, which is wrapped by master keys.
+// Master key files hold 32 random bytes encoded as base64, e.g. the output of `openssl rand -base64 32`.
+type EnvelopeConfig struct {
+	MasterKeyFiles  []string `hcl:"master_key_files,optional"`  // optional: keys the data keys of new backups are wrapped with
+	RetiredKeyFiles []string `hcl:"retired_key_files,optional"` // optional: keys that only unwrap data keys of older backups
+}
+
+// MasterKey is a key data keys are wrapped with, identified by a fingerprint of the key
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// GetMasterKeys reads the keys the data keys of new backups are wrapped with
+func (e *EnvelopeConfig) GetMasterKeys() ([]MasterKey, error) {
+	return readMasterKeys(e.MasterKeyFiles, "encrypt.envelope.master_key_files")
+}
+
+// GetUnwrapKeys reads every key a data key may be wrapped with, master keys first
+func (e *EnvelopeConfig) GetUnwrapKeys() ([]MasterKey, error) {
+	if e == nil || len(e.MasterKeyFiles)+len(e.RetiredKeyFiles) == 0 {
+		return nil, errors.New("encrypt.envelope.master_key_files or encrypt.envelope.retired_key_files is required to decrypt envelope encrypted backups")
+	}
+
+	keys, err := e.GetMasterKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	retired, err := readMasterKeys(e.RetiredKeyFiles, "encrypt.envelope.retired_key_files")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, retired...), nil
+}
+
+func (e *EnvelopeConfig) validate() error {
+	keys, err := e.GetUnwrapKeys()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key.ID] {
+			return fmt.Errorf("encrypt.envelope: master key %s is configured more than once", key.ID)
+		}
+		seen[key.ID] = true
+	}
+
+	return nil
+}
+
+// readMasterKeys reads base64 encoded master keys from files
+func readMasterKeys(files []string, setting string) ([]MasterKey, error) {
+	keys := make([]MasterKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s is not base64 encoded: %w", setting, file, err)
+		}
+		if len(key) != MasterKeySize {
+			return nil, fmt.Errorf("%s: %s holds a %d byte key, master keys must be %d bytes", setting, file, len(key), MasterKeySize)
+		}
+
+		sum := sha256.Sum256(key)
+		keys = append(keys, MasterKey{ID: hex.EncodeToString(sum[:8]), Key: key})
+	}
+
+	return keys, nil
+}
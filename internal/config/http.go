@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultMetricsPath is where the HTTP listener serves Prometheus metrics
+const DefaultMetricsPath = "/metrics"
+
+// reservedPaths are served by the HTTP listener regardless of the configuration
+var reservedPaths = []string{"/healthz", "/readyz", "/status"}
+
+// HTTPConfig enables an HTTP listener in `schedule run`
+type HTTPConfig struct {
+	Listen      string  `hcl:"listen"`       // address to listen on, e.g. ":9187"
+	MetricsPath *string `hcl:"metrics_path"` // optional: defaults to "/metrics"
+	MaxAge      *string `hcl:"max_age"`      // optional: /readyz fails once the newest backup of a database is older than this
+}
+
+func (h *HTTPConfig) GetMetricsPath() string {
+	if h.MetricsPath == nil {
+		return DefaultMetricsPath
+	}
+
+	return *h.MetricsPath
+}
+
+// GetMaxAge returns how old the newest backup of a database may be before /readyz fails, zero disables the check
+func (h *HTTPConfig) GetMaxAge() time.Duration {
+	if h.MaxAge == nil {
+		return 0
+	}
+
+	// Validated on load, so the max age always parses here
+	maxAge, _ := time.ParseDuration(*h.MaxAge)
+	return maxAge
+}
+
+func (h *HTTPConfig) Validate() error {
+	if h.Listen == "" {
+		return errors.New("http.listen: address is required")
+	}
+
+	if !strings.HasPrefix(h.GetMetricsPath(), "/") {
+		return fmt.Errorf("http.metrics_path: must start with '/', got '%s'", h.GetMetricsPath())
+	}
+
+	if slices.Contains(reservedPaths, h.GetMetricsPath()) {
+		return fmt.Errorf("http.metrics_path: %s is already served by the listener", h.GetMetricsPath())
+	}
+
+	if h.MaxAge != nil {
+		maxAge, err := time.ParseDuration(*h.MaxAge)
+		if err != nil {
+			return fmt.Errorf("http.max_age: %w", err)
+		}
+		if maxAge <= 0 {
+			return fmt.Errorf("http.max_age: must be positive, got %s", maxAge)
+		}
+	}
+
+	return nil
+}
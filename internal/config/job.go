@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+const (
+	StorageS3    = "s3"
+	StorageLocal = "local"
+)
+
+// jobNamePattern keeps job names usable as a path segment in every storage backend
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// JobConfig is a named backup job that combines what to dump, when to dump it,
+// where to store it and how long to keep it.
+// Backups of a job are stored under "<job>/<database>/" in each of its storage backends,
+// so jobs never apply their retention to each other's backups.
+type JobConfig struct {
+	Name         string             `hcl:"name,label"`
+	Cron         string             `hcl:"cron"`
+	Databases    []string           `hcl:"databases,optional"` // optional: defaults to postgres.database
+	Storages     []string           `hcl:"storages,optional"`  // optional: "s3" and/or "local", defaults to every configured storage
+	Compress     *CompressConfig    `hcl:"compress,block"`     // optional: defaults to the top-level compress block
+	Retention    *storage.Retention `hcl:"retention,block"`    // optional: defaults to the retention settings of each storage
+	Ping         *PingConfig        `hcl:"ping,block"`         // optional: URLs called when a run starts, succeeds and fails
+	Overlap      *string            `hcl:"overlap"`            // optional: "skip", "queue" or "allow", defaults to scheduler.overlap
+	Timezone     *string            `hcl:"timezone"`           // optional: defaults to scheduler.timezone
+	Jitter       *string            `hcl:"jitter"`             // optional: defaults to scheduler.jitter
+	Timeout      *string            `hcl:"timeout"`            // optional: defaults to scheduler.timeout
+	Retries      *int               `hcl:"retries"`            // optional: defaults to scheduler.retries
+	RetryBackoff *string            `hcl:"retry_backoff"`      // optional: defaults to scheduler.retry_backoff
+	Enabled      *bool              `hcl:"enabled"`
+}
+
+func (j JobConfig) IsEnabled() bool {
+	return j.Enabled == nil || *j.Enabled
+}
+
+// GetDatabases returns the databases dumped by the job, postgres.database when none are listed.
+// An empty name stands for the libpq default database.
+func (j JobConfig) GetDatabases(c Config) []string {
+	if len(j.Databases) == 0 {
+		return []string{c.Postgres.GetDatabase()}
+	}
+
+	return j.Databases
+}
+
+// UsesStorage reports whether the job stores its backups in the given storage backend
+func (j JobConfig) UsesStorage(name string) bool {
+	return len(j.Storages) == 0 || slices.Contains(j.Storages, name)
+}
+
+// GetCompress returns the compression settings of the job, nil when backups are not compressed
+func (j JobConfig) GetCompress(c Config) *CompressConfig {
+	if j.Compress != nil {
+		return j.Compress
+	}
+
+	return c.Compress
+}
+
+func (j JobConfig) validate(c Config, index int) error {
+	if !jobNamePattern.MatchString(j.Name) {
+		return fmt.Errorf("job[%d]: name '%s' may only contain letters, digits, '_', '-' and '.', and must not start with '.'", index, j.Name)
+	}
+
+	if j.Cron == "" {
+		return fmt.Errorf("job %q: cron expression is required", j.Name)
+	}
+
+	if j.Ping != nil {
+		if err := j.Ping.Validate(); err != nil {
+			return fmt.Errorf("job %q: %w", j.Name, err)
+		}
+	}
+
+	for _, database := range j.Databases {
+		if database == "" || database == "." || database == ".." || strings.ContainsAny(database, `/\`) {
+			return fmt.Errorf("job %q: database name '%s' can not be used as a storage path", j.Name, database)
+		}
+	}
+
+	for _, name := range j.Storages {
+		switch name {
+		case StorageS3:
+			if c.Storage.S3 == nil {
+				return fmt.Errorf("job %q: storage \"s3\" is not configured", j.Name)
+			}
+		case StorageLocal:
+			if c.Storage.Local == nil {
+				return fmt.Errorf("job %q: storage \"local\" is not configured", j.Name)
+			}
+		default:
+			return fmt.Errorf("job %q: storages must only contain \"%s\" or \"%s\", got '%s'", j.Name, StorageS3, StorageLocal, name)
+		}
+	}
+
+	if j.Compress != nil {
+		if err := j.Compress.Validate(); err != nil {
+			return fmt.Errorf("job %q: %w", j.Name, err)
+		}
+	}
+
+	if j.Retention != nil {
+		if err := j.Retention.Validate(); err != nil {
+			return fmt.Errorf("job %q: retention %w", j.Name, err)
+		}
+	}
+
+	if j.Overlap != nil {
+		if err := validateOverlap(*j.Overlap); err != nil {
+			return fmt.Errorf("job %q: overlap %w", j.Name, err)
+		}
+	}
+
+	if j.Timezone != nil {
+		if err := validateTimezone(*j.Timezone); err != nil {
+			return fmt.Errorf("job %q: timezone: %w", j.Name, err)
+		}
+	}
+
+	if j.Jitter != nil {
+		if err := validateJitter(*j.Jitter); err != nil {
+			return fmt.Errorf("job %q: jitter: %w", j.Name, err)
+		}
+	}
+
+	if err := validateRetry(j.Timeout, j.Retries, j.RetryBackoff); err != nil {
+		return fmt.Errorf("job %q: %w", j.Name, err)
+	}
+
+	return nil
+}
+
+// GetJob finds a backup job by name
+func (c Config) GetJob(name string) (JobConfig, bool) {
+	for _, job := range c.Jobs {
+		if job.Name == name {
+			return job, true
+		}
+	}
+
+	return JobConfig{}, false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ManifestConfig signs a manifest holding the checksum and metadata of every backup, and checks it on restore.
+// Backup hosts need the signing key, restore hosts only the public keys, so they can't forge backups.
+// Keys are PEM files as written by `openssl genpkey -algorithm ed25519` and `openssl pkey -pubout`.
+type ManifestConfig struct {
+	SigningKeyFile *string  `hcl:"signing_key_file"`          // optional: ed25519 private key manifests of new backups are signed with
+	PublicKeyFiles []string `hcl:"public_key_files,optional"` // optional: ed25519 public keys restore and verify accept manifests from
+	Require        *bool    `hcl:"require"`                   // optional: refuse backups without a manifest, default true
+}
+
+// IsSigning reports whether new backups get a signed manifest
+func (m *ManifestConfig) IsSigning() bool {
+	return m != nil && m.SigningKeyFile != nil
+}
+
+// IsVerifying reports whether restore and verify check the manifests of backups
+func (m *ManifestConfig) IsVerifying() bool {
+	return m != nil && len(m.PublicKeyFiles) > 0
+}
+
+// IsRequired reports whether backups without a manifest are refused when manifests are checked
+func (m *ManifestConfig) IsRequired() bool {
+	if m.Require == nil {
+		return true
+	}
+
+	return *m.Require
+}
+
+// GetSigningKey reads the key manifests are signed with
+func (m *ManifestConfig) GetSigningKey() (ed25519.PrivateKey, error) {
+	block, err := readPEM(*m.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("manifest.signing_key_file: %w", err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("manifest.signing_key_file: %w", err)
+	}
+
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("manifest.signing_key_file: %s is not an ed25519 key", *m.SigningKeyFile)
+	}
+
+	return signingKey, nil
+}
+
+// GetPublicKeys reads the keys manifests are verified against
+func (m *ManifestConfig) GetPublicKeys() ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(m.PublicKeyFiles))
+	for _, file := range m.PublicKeyFiles {
+		block, err := readPEM(file)
+		if err != nil {
+			return nil, fmt.Errorf("manifest.public_key_files: %w", err)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("manifest.public_key_files: %w", err)
+		}
+
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("manifest.public_key_files: %s is not an ed25519 key", file)
+		}
+		keys = append(keys, publicKey)
+	}
+
+	return keys, nil
+}
+
+// ManifestKeyID identifies the key a manifest is signed with
+func ManifestKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (m *ManifestConfig) Validate() error {
+	if m.SigningKeyFile != nil {
+		if _, err := m.GetSigningKey(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := m.GetPublicKeys(); err != nil {
+		return err
+	}
+
+	if m.Require != nil && len(m.PublicKeyFiles) == 0 {
+		return errors.New("manifest: require needs public_key_files")
+	}
+
+	return nil
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", file)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+const (
+	NotifyWebhook  = "webhook"
+	NotifySMTP     = "smtp"
+	NotifySlack    = "slack"
+	NotifyDiscord  = "discord"
+	NotifyTeams    = "teams"
+	NotifyTelegram = "telegram"
+)
+
+const (
+	NotifyOnSuccess = "success"
+	NotifyOnFailure = "failure"
+	NotifyOnStale   = "stale"
+)
+
+const (
+	// DefaultNotifyTimeout bounds a single delivery attempt of a notification
+	DefaultNotifyTimeout = 10 * time.Second
+	// DefaultNotifyRetries is how often a failed delivery is retried
+	DefaultNotifyRetries = 3
+	// DefaultNotifyRetryBackoff is the delay before the first retry of a delivery
+	DefaultNotifyRetryBackoff = 2 * time.Second
+)
+
+// defaultNotifyOn is what a notifier is sent when `on` is not set
+var defaultNotifyOn = []string{NotifyOnFailure, NotifyOnStale}
+
+// NotifyConfig sends a notification when a backup, restore or retention run finishes or backups go stale.
+// The settings shared by every notifier type are decoded here, the rest of the block is decoded by type.
+type NotifyConfig struct {
+	Type         string   `hcl:"type,label"`
+	On           []string `hcl:"on,optional"`   // optional: any of "success", "failure" and "stale", defaults to failure and stale
+	StaleAfter   *string  `hcl:"stale_after"`   // optional: defaults to http.max_age, required for "stale" otherwise
+	Timeout      *string  `hcl:"timeout"`       // optional: limit for a single delivery attempt, default 10s
+	Retries      *int     `hcl:"retries"`       // optional: retries after a failed delivery, default 3
+	RetryBackoff *string  `hcl:"retry_backoff"` // optional: delay before the first retry, default 2s
+	Options      hcl.Body `hcl:",remain"`
+
+	// The settings of the notifier type, decoded from Options on load. Chat is shared by slack, discord and teams.
+	Webhook  *WebhookConfig
+	SMTP     *SMTPConfig
+	Chat     *ChatConfig
+	Telegram *TelegramConfig
+}
+
+// WebhookConfig sends an HTTP request for every notification
+type WebhookConfig struct {
+	URL     string            `hcl:"url"`
+	Method  *string           `hcl:"method"`           // optional: defaults to POST
+	Headers map[string]string `hcl:"headers,optional"` // optional: extra request headers
+	Body    *string           `hcl:"body"`             // optional: Go template of the request body, defaults to the notification as JSON
+}
+
+func (w *WebhookConfig) GetMethod() string {
+	if w.Method == nil {
+		return http.MethodPost
+	}
+
+	return strings.ToUpper(*w.Method)
+}
+
+// Notifies reports whether the notifier is sent notifications of the given kind
+func (n NotifyConfig) Notifies(on string) bool {
+	if n.On == nil {
+		return slices.Contains(defaultNotifyOn, on)
+	}
+
+	return slices.Contains(n.On, on)
+}
+
+// GetStaleAfter returns how old the newest backup of a database may be before the notifier is told, zero disables it
+func (n NotifyConfig) GetStaleAfter(c Config) time.Duration {
+	if !n.Notifies(NotifyOnStale) {
+		return 0
+	}
+
+	if n.StaleAfter == nil {
+		if c.HTTP != nil {
+			return c.HTTP.GetMaxAge()
+		}
+		return 0
+	}
+
+	// Validated on load, so the duration always parses here
+	staleAfter, _ := time.ParseDuration(*n.StaleAfter)
+	return staleAfter
+}
+
+// GetRetryPolicy returns how deliveries of the notifier are bounded and retried
+func (n NotifyConfig) GetRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		Timeout: DefaultNotifyTimeout,
+		Retries: DefaultNotifyRetries,
+		Backoff: DefaultNotifyRetryBackoff,
+	}
+
+	// Validated on load, so the durations always parse here
+	if n.Timeout != nil {
+		policy.Timeout, _ = time.ParseDuration(*n.Timeout)
+	}
+	if n.Retries != nil {
+		policy.Retries = *n.Retries
+	}
+	if n.RetryBackoff != nil {
+		policy.Backoff, _ = time.ParseDuration(*n.RetryBackoff)
+	}
+
+	return policy
+}
+
+// decode decodes the type specific settings of the notifier and validates them
+func (n *NotifyConfig) decode(c Config, index int) error {
+	for _, on := range n.On {
+		if !slices.Contains([]string{NotifyOnSuccess, NotifyOnFailure, NotifyOnStale}, on) {
+			return fmt.Errorf("notify[%d]: on must contain only success, failure or stale, got '%s'", index, on)
+		}
+	}
+
+	if n.StaleAfter != nil {
+		staleAfter, err := time.ParseDuration(*n.StaleAfter)
+		if err != nil {
+			return fmt.Errorf("notify[%d]: stale_after: %w", index, err)
+		}
+		if staleAfter <= 0 {
+			return fmt.Errorf("notify[%d]: stale_after: must be positive, got %s", index, staleAfter)
+		}
+	}
+
+	if n.Notifies(NotifyOnStale) && n.GetStaleAfter(c) == 0 {
+		return fmt.Errorf("notify[%d]: stale_after or http.max_age is required for stale notifications", index)
+	}
+
+	if err := validateRetry(n.Timeout, n.Retries, n.RetryBackoff); err != nil {
+		return fmt.Errorf("notify[%d]: %w", index, err)
+	}
+
+	switch n.Type {
+	case NotifyWebhook:
+		n.Webhook = &WebhookConfig{}
+		if diags := gohcl.DecodeBody(n.Options, nil, n.Webhook); diags.HasErrors() {
+			return fmt.Errorf("notify[%d]: %w", index, diags)
+		}
+		if err := n.Webhook.validate(); err != nil {
+			return fmt.Errorf("notify[%d]: %w", index, err)
+		}
+	case NotifySMTP:
+		n.SMTP = &SMTPConfig{}
+		if diags := gohcl.DecodeBody(n.Options, nil, n.SMTP); diags.HasErrors() {
+			return fmt.Errorf("notify[%d]: %w", index, diags)
+		}
+		if err := n.SMTP.validate(); err != nil {
+			return fmt.Errorf("notify[%d]: %w", index, err)
+		}
+	case NotifySlack, NotifyDiscord, NotifyTeams:
+		n.Chat = &ChatConfig{}
+		if diags := gohcl.DecodeBody(n.Options, nil, n.Chat); diags.HasErrors() {
+			return fmt.Errorf("notify[%d]: %w", index, diags)
+		}
+		if err := n.Chat.validate(); err != nil {
+			return fmt.Errorf("notify[%d]: %w", index, err)
+		}
+	case NotifyTelegram:
+		n.Telegram = &TelegramConfig{}
+		if diags := gohcl.DecodeBody(n.Options, nil, n.Telegram); diags.HasErrors() {
+			return fmt.Errorf("notify[%d]: %w", index, diags)
+		}
+		if err := n.Telegram.validate(); err != nil {
+			return fmt.Errorf("notify[%d]: %w", index, err)
+		}
+	default:
+		return fmt.Errorf("notify[%d]: unknown type '%s', must be one of %s", index, n.Type,
+			strings.Join([]string{NotifyWebhook, NotifySMTP, NotifySlack, NotifyDiscord, NotifyTeams, NotifyTelegram}, ", "))
+	}
+
+	return nil
+}
+
+func (w *WebhookConfig) validate() error {
+	if w.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if err := validateURL(w.URL); err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	switch w.GetMethod() {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("method must be GET, POST, PUT or PATCH, got '%s'", w.GetMethod())
+	}
+
+	return nil
+}
+
+// validateURL checks that a notification endpoint is an absolute http or https URL
+func validateURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got '%s'", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return errors.New("host is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// OpenPGPConfig encrypts backups to OpenPGP public keys and optionally signs them.
+// Key files may be ASCII armored or binary.
+type OpenPGPConfig struct {
+	RecipientKeyFiles       []string `hcl:"recipient_key_files,optional"` // optional: public keys backups are encrypted to
+	SigningKeyFile          *string  `hcl:"signing_key_file"`             // optional: private key new backups are signed with
+	SigningKeyPassphraseEnv *string  `hcl:"signing_key_passphrase_env"`   // optional: environment variable holding its passphrase
+	PrivateKeyFile          *string  `hcl:"private_key_file"`             // optional: private key used by restore to decrypt
+	PrivateKeyPassphraseEnv *string  `hcl:"private_key_passphrase_env"`   // optional: environment variable holding its passphrase
+	VerifyKeyFiles          []string `hcl:"verify_key_files,optional"`    // optional: public keys restore accepts signatures from
+	RequireSignature        *bool    `hcl:"require_signature"`            // optional: refuse unsigned or badly signed backups, default false
+}
+
+func (o *OpenPGPConfig) IsSignatureRequired() bool {
+	return o != nil && o.RequireSignature != nil && *o.RequireSignature
+}
+
+// GetRecipients reads the public keys backups are encrypted to
+func (o *OpenPGPConfig) GetRecipients() (openpgp.EntityList, error) {
+	var recipients openpgp.EntityList
+	for _, file := range o.RecipientKeyFiles {
+		keys, err := readKeyRing(file)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt.openpgp.recipient_key_files: %w", err)
+		}
+		recipients = append(recipients, keys...)
+	}
+
+	return recipients, nil
+}
+
+// GetSigningKey reads and unlocks the key new backups are signed with, nil when backups are not signed
+func (o *OpenPGPConfig) GetSigningKey() (*openpgp.Entity, error) {
+	if o.SigningKeyFile == nil {
+		return nil, nil
+	}
+
+	keys, err := readPrivateKeys(*o.SigningKeyFile, o.SigningKeyPassphraseEnv)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt.openpgp.signing_key_file: %w", err)
+	}
+
+	return keys[0], nil
+}
+
+// GetDecryptionKeys reads and unlocks the private key used to decrypt backups together with the keys
+// signatures are verified against
+func (o *OpenPGPConfig) GetDecryptionKeys() (openpgp.EntityList, error) {
+	if o == nil || o.PrivateKeyFile == nil {
+		return nil, errors.New("encrypt.openpgp.private_key_file is required to decrypt OpenPGP encrypted backups")
+	}
+
+	keys, err := readPrivateKeys(*o.PrivateKeyFile, o.PrivateKeyPassphraseEnv)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt.openpgp.private_key_file: %w", err)
+	}
+
+	for _, file := range o.VerifyKeyFiles {
+		verifyKeys, err := readKeyRing(file)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt.openpgp.verify_key_files: %w", err)
+		}
+		keys = append(keys, verifyKeys...)
+	}
+
+	return keys, nil
+}
+
+func (o *OpenPGPConfig) validate() error {
+	recipients, err := o.GetRecipients()
+	if err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if _, ok := recipient.EncryptionKey(time.Now()); !ok {
+			return fmt.Errorf("encrypt.openpgp.recipient_key_files: key %X has no valid encryption key", recipient.PrimaryKey.Fingerprint)
+		}
+	}
+
+	if o.SigningKeyFile != nil && len(o.RecipientKeyFiles) == 0 {
+		return errors.New("encrypt.openpgp: signing_key_file requires recipient_key_files")
+	}
+	if _, err := o.GetSigningKey(); err != nil {
+		return err
+	}
+
+	if o.IsSignatureRequired() && len(o.VerifyKeyFiles) == 0 {
+		return errors.New("encrypt.openpgp: require_signature needs verify_key_files")
+	}
+
+	return nil
+}
+
+// readKeyRing reads the keys in an armored or binary key file
+func readKeyRing(file string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys from %s: %w", file, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", file)
+	}
+
+	return keys, nil
+}
+
+// readPrivateKeys reads the keys in a key file and unlocks them with the passphrase from passphraseEnv
+func readPrivateKeys(file string, passphraseEnv *string) (openpgp.EntityList, error) {
+	keys, err := readKeyRing(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var passphrase []byte
+	if passphraseEnv != nil {
+		value, ok := os.LookupEnv(*passphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s holding the passphrase is not set", *passphraseEnv)
+		}
+		passphrase = []byte(value)
+	}
+
+	for _, key := range keys {
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("key %X in %s is not a private key", key.PrimaryKey.Fingerprint, file)
+		}
+
+		if passphrase != nil {
+			if err := key.DecryptPrivateKeys(passphrase); err != nil {
+				return nil, fmt.Errorf("failed to unlock key %X: %w", key.PrimaryKey.Fingerprint, err)
+			}
+		} else if key.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("key %X is protected by a passphrase but no passphrase environment variable is set", key.PrimaryKey.Fingerprint)
+		}
+	}
+
+	return keys, nil
+}
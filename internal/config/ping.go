@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PingConfig calls URLs when a job starts, succeeds and fails, so that a monitoring service such as
+// healthchecks.io or an Uptime Kuma push monitor notices when runs fail or stop happening at all
+type PingConfig struct {
+	URL          *string `hcl:"url"`           // optional: healthchecks.io style base URL, start pings <url>/start and failure <url>/fail
+	Start        *string `hcl:"start"`         // optional: overrides the start URL derived from url
+	Success      *string `hcl:"success"`       // optional: overrides the success URL derived from url
+	Failure      *string `hcl:"failure"`       // optional: overrides the failure URL derived from url
+	Timeout      *string `hcl:"timeout"`       // optional: limit for a single ping, default 10s
+	Retries      *int    `hcl:"retries"`       // optional: retries after a failed ping, default 3
+	RetryBackoff *string `hcl:"retry_backoff"` // optional: delay before the first retry, default 2s
+}
+
+// GetStartURL returns the URL called when a run starts, empty when no start ping is sent
+func (p *PingConfig) GetStartURL() string {
+	return p.pingURL(p.Start, "/start")
+}
+
+// GetSuccessURL returns the URL called when a run succeeds, empty when no success ping is sent
+func (p *PingConfig) GetSuccessURL() string {
+	return p.pingURL(p.Success, "")
+}
+
+// GetFailureURL returns the URL called when a run fails, empty when no failure ping is sent
+func (p *PingConfig) GetFailureURL() string {
+	return p.pingURL(p.Failure, "/fail")
+}
+
+func (p *PingConfig) pingURL(explicit *string, suffix string) string {
+	if explicit != nil {
+		return *explicit
+	}
+
+	if p.URL == nil {
+		return ""
+	}
+
+	return strings.TrimRight(*p.URL, "/") + suffix
+}
+
+// GetRetryPolicy returns how pings are bounded and retried, with the same defaults as notifications
+func (p *PingConfig) GetRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		Timeout: DefaultNotifyTimeout,
+		Retries: DefaultNotifyRetries,
+		Backoff: DefaultNotifyRetryBackoff,
+	}
+
+	// Validated on load, so the durations always parse here
+	if p.Timeout != nil {
+		policy.Timeout, _ = time.ParseDuration(*p.Timeout)
+	}
+	if p.Retries != nil {
+		policy.Retries = *p.Retries
+	}
+	if p.RetryBackoff != nil {
+		policy.Backoff, _ = time.ParseDuration(*p.RetryBackoff)
+	}
+
+	return policy
+}
+
+func (p *PingConfig) Validate() error {
+	if p.URL == nil && p.Start == nil && p.Success == nil && p.Failure == nil {
+		return errors.New("ping: at least one of url, start, success or failure is required")
+	}
+
+	for name, pingURL := range map[string]string{
+		"start":   p.GetStartURL(),
+		"success": p.GetSuccessURL(),
+		"failure": p.GetFailureURL(),
+	} {
+		if pingURL == "" {
+			continue
+		}
+		if err := validateURL(pingURL); err != nil {
+			return fmt.Errorf("ping: %s url: %w", name, err)
+		}
+	}
+
+	if err := validateRetry(p.Timeout, p.Retries, p.RetryBackoff); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	return nil
+}
@@ -8,3 +8,13 @@ type PostgresConfig struct {
 	Password *string `hcl:"password"`
 	Database *string `hcl:"database"`
 }
+
+// GetDatabase returns the configured database, empty when unset so that pg_dump connects to the
+// libpq default database like the default job does
+func (p PostgresConfig) GetDatabase() string {
+	if p.Database == nil {
+		return ""
+	}
+
+	return *p.Database
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// DefaultCatchUpWindow is how far back `schedule run` catches up missed runs
+const DefaultCatchUpWindow = 24 * time.Hour
+
+// DefaultLeaderLockTTL is how long an S3 leader lock stays valid without being renewed
+const DefaultLeaderLockTTL = time.Minute
+
+const (
+	LeaderLockPostgres = "postgres"
+	LeaderLockS3       = "s3"
+)
+
+// LeaderLockConfig makes replicas of `schedule run` take a lock before running a job,
+// so that only one of them runs each scheduled job
+type LeaderLockConfig struct {
+	Backend  string  `hcl:"backend"`  // "postgres" (advisory lock on the backed-up server) or "s3" (lock object in the bucket)
+	TTL      *string `hcl:"ttl"`      // optional: s3 only, lock lifetime without renewal before it is considered stale, default 1m
+	Identity *string `hcl:"identity"` // optional: name of this replica in logs and lock ownership, default hostname and pid
+}
+
+func (l *LeaderLockConfig) Validate(c Config) error {
+	switch l.Backend {
+	case LeaderLockPostgres:
+	case LeaderLockS3:
+		if c.Storage.S3 == nil {
+			return errors.New("scheduler.leader_lock: backend \"s3\" requires s3 storage to be configured")
+		}
+	default:
+		return fmt.Errorf("scheduler.leader_lock.backend: must be one of [%s %s], got '%s'", LeaderLockPostgres, LeaderLockS3, l.Backend)
+	}
+
+	if l.TTL != nil {
+		ttl, err := time.ParseDuration(*l.TTL)
+		if err != nil {
+			return fmt.Errorf("scheduler.leader_lock.ttl: %w", err)
+		}
+		if ttl < 10*time.Second {
+			return fmt.Errorf("scheduler.leader_lock.ttl: must be at least 10s, got %s", ttl)
+		}
+	}
+
+	return nil
+}
+
+// GetTTL returns the lifetime of an S3 lock without renewal
+func (l *LeaderLockConfig) GetTTL() time.Duration {
+	if l.TTL == nil {
+		return DefaultLeaderLockTTL
+	}
+
+	// Validated on load, so the ttl always parses here
+	ttl, _ := time.ParseDuration(*l.TTL)
+	return ttl
+}
+
+// GetIdentity returns the name of this replica
+func (l *LeaderLockConfig) GetIdentity() string {
+	if l.Identity != nil {
+		return *l.Identity
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// DefaultRetryBackoff is the delay before the first retry of a failed job
+const DefaultRetryBackoff = 30 * time.Second
+
+// RetryPolicy bounds each attempt of a job and retries failed attempts with exponential backoff
+type RetryPolicy struct {
+	// Timeout limits a single attempt, zero means no limit
+	Timeout time.Duration
+	// Retries is the number of attempts after the first one
+	Retries int
+	// Backoff is the delay before the first retry, doubled for every further retry
+	Backoff time.Duration
+}
+
+// DefaultShutdownGracePeriod is how long `schedule run` waits for in-flight jobs on SIGINT or SIGTERM
+const DefaultShutdownGracePeriod = 20 * time.Second
+
+const (
+	// OverlapSkip skips a run while the previous run of the same schedule is still in progress
+	OverlapSkip = "skip"
+	// OverlapQueue delays a run until the previous run of the same schedule has finished
+	OverlapQueue = "queue"
+	// OverlapAllow starts every run regardless of previous runs
+	OverlapAllow = "allow"
+)
+
+var overlapPolicies = []string{
+	OverlapSkip,
+	OverlapQueue,
+	OverlapAllow,
+}
+
+// SchedulerConfig holds defaults shared by every schedule run by `schedule run`
+type SchedulerConfig struct {
+	Overlap             *string `hcl:"overlap"`               // optional: "skip", "queue" or "allow", default "skip"
+	ShutdownGracePeriod *string `hcl:"shutdown_grace_period"` // optional: time to drain in-flight jobs on shutdown, default 20s
+	Timezone            *string `hcl:"timezone"`              // optional: IANA time zone for cron expressions, default local time
+	Jitter              *string `hcl:"jitter"`                // optional: delay each run by a random duration up to this value
+	StateFile           *string `hcl:"state_file"`            // optional: local path where the last run of every schedule is persisted
+	CatchUp             *bool   `hcl:"catch_up"`              // optional: run missed schedules once on startup, requires state_file
+	CatchUpWindow       *string `hcl:"catch_up_window"`       // optional: only catch up runs missed within this duration, default 24h
+	Timeout             *string `hcl:"timeout"`               // optional: limit for a single attempt of a job, default none
+	Retries             *int    `hcl:"retries"`               // optional: attempts after the first failed one, default 0
+	RetryBackoff        *string `hcl:"retry_backoff"`         // optional: delay before the first retry, doubled for each retry, default 30s
+
+	LeaderLock *LeaderLockConfig `hcl:"leader_lock,block"`
+}
+
+func (s *SchedulerConfig) Validate(c Config) error {
+	if s.Overlap != nil {
+		if err := validateOverlap(*s.Overlap); err != nil {
+			return fmt.Errorf("scheduler.overlap: %w", err)
+		}
+	}
+
+	if s.ShutdownGracePeriod != nil {
+		grace, err := time.ParseDuration(*s.ShutdownGracePeriod)
+		if err != nil {
+			return fmt.Errorf("scheduler.shutdown_grace_period: %w", err)
+		}
+		if grace < 0 {
+			return fmt.Errorf("scheduler.shutdown_grace_period: must not be negative, got %s", grace)
+		}
+	}
+
+	if s.Timezone != nil {
+		if err := validateTimezone(*s.Timezone); err != nil {
+			return fmt.Errorf("scheduler.timezone: %w", err)
+		}
+	}
+
+	if s.Jitter != nil {
+		if err := validateJitter(*s.Jitter); err != nil {
+			return fmt.Errorf("scheduler.jitter: %w", err)
+		}
+	}
+
+	if s.IsCatchUpEnabled() && s.StateFile == nil {
+		return errors.New("scheduler.catch_up: state_file is required to catch up missed runs")
+	}
+
+	if s.CatchUpWindow != nil {
+		window, err := time.ParseDuration(*s.CatchUpWindow)
+		if err != nil {
+			return fmt.Errorf("scheduler.catch_up_window: %w", err)
+		}
+		if window <= 0 {
+			return fmt.Errorf("scheduler.catch_up_window: must be positive, got %s", window)
+		}
+	}
+
+	if err := validateRetry(s.Timeout, s.Retries, s.RetryBackoff); err != nil {
+		return fmt.Errorf("scheduler.%w", err)
+	}
+
+	if s.LeaderLock != nil {
+		if err := s.LeaderLock.Validate(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SchedulerConfig) IsCatchUpEnabled() bool {
+	return s.CatchUp != nil && *s.CatchUp
+}
+
+// GetCatchUpWindow returns how far back missed runs are caught up
+func (s *SchedulerConfig) GetCatchUpWindow() time.Duration {
+	if s.CatchUpWindow == nil {
+		return DefaultCatchUpWindow
+	}
+
+	// Validated on load, so the window always parses here
+	window, _ := time.ParseDuration(*s.CatchUpWindow)
+	return window
+}
+
+// GetOverlap returns the overlap policy for a schedule, falling back to the scheduler default
+func (c Config) GetOverlap(override *string) string {
+	if override != nil {
+		return *override
+	}
+
+	if c.Scheduler != nil && c.Scheduler.Overlap != nil {
+		return *c.Scheduler.Overlap
+	}
+
+	return OverlapSkip
+}
+
+// GetShutdownGracePeriod returns how long in-flight jobs may run after a shutdown signal
+func (c Config) GetShutdownGracePeriod() time.Duration {
+	if c.Scheduler == nil || c.Scheduler.ShutdownGracePeriod == nil {
+		return DefaultShutdownGracePeriod
+	}
+
+	// Validated on load, so the grace period always parses here
+	grace, _ := time.ParseDuration(*c.Scheduler.ShutdownGracePeriod)
+	return grace
+}
+
+// GetLocation returns the time zone for a schedule, falling back to the scheduler default and then local time
+func (c Config) GetLocation(override *string) *time.Location {
+	name := override
+	if name == nil && c.Scheduler != nil {
+		name = c.Scheduler.Timezone
+	}
+
+	if name == nil {
+		return time.Local
+	}
+
+	// Validated on load, so the time zone always loads here
+	location, _ := time.LoadLocation(*name)
+	return location
+}
+
+// GetJitter returns the maximum random delay for a schedule, falling back to the scheduler default
+func (c Config) GetJitter(override *string) time.Duration {
+	value := override
+	if value == nil && c.Scheduler != nil {
+		value = c.Scheduler.Jitter
+	}
+
+	if value == nil {
+		return 0
+	}
+
+	// Validated on load, so the jitter always parses here
+	jitter, _ := time.ParseDuration(*value)
+	return jitter
+}
+
+// GetRetryPolicy returns the retry policy for a schedule, falling back to the scheduler defaults
+func (c Config) GetRetryPolicy(timeout *string, retries *int, backoff *string) RetryPolicy {
+	if c.Scheduler != nil {
+		if timeout == nil {
+			timeout = c.Scheduler.Timeout
+		}
+		if retries == nil {
+			retries = c.Scheduler.Retries
+		}
+		if backoff == nil {
+			backoff = c.Scheduler.RetryBackoff
+		}
+	}
+
+	policy := RetryPolicy{Backoff: DefaultRetryBackoff}
+
+	// Validated on load, so the durations always parse here
+	if timeout != nil {
+		policy.Timeout, _ = time.ParseDuration(*timeout)
+	}
+	if retries != nil {
+		policy.Retries = *retries
+	}
+	if backoff != nil {
+		policy.Backoff, _ = time.ParseDuration(*backoff)
+	}
+
+	return policy
+}
+
+// validateScheduleOptions validates the overlap, timing and retry settings shared by schedule blocks
+func validateScheduleOptions(overlap, timezone, jitter, timeout *string, retries *int, retryBackoff *string) error {
+	if overlap != nil {
+		if err := validateOverlap(*overlap); err != nil {
+			return fmt.Errorf("overlap %w", err)
+		}
+	}
+
+	if timezone != nil {
+		if err := validateTimezone(*timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+
+	if jitter != nil {
+		if err := validateJitter(*jitter); err != nil {
+			return fmt.Errorf("jitter: %w", err)
+		}
+	}
+
+	return validateRetry(timeout, retries, retryBackoff)
+}
+
+// validateRetry validates the timeout, retries and retry_backoff settings of a schedule
+func validateRetry(timeout *string, retries *int, backoff *string) error {
+	if timeout != nil {
+		duration, err := time.ParseDuration(*timeout)
+		if err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("timeout: must be positive, got %s", duration)
+		}
+	}
+
+	if retries != nil && *retries < 0 {
+		return fmt.Errorf("retries: must not be negative, got %d", *retries)
+	}
+
+	if backoff != nil {
+		duration, err := time.ParseDuration(*backoff)
+		if err != nil {
+			return fmt.Errorf("retry_backoff: %w", err)
+		}
+		if duration < 0 {
+			return fmt.Errorf("retry_backoff: must not be negative, got %s", duration)
+		}
+	}
+
+	return nil
+}
+
+func validateTimezone(timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateJitter(jitter string) error {
+	duration, err := time.ParseDuration(jitter)
+	if err != nil {
+		return err
+	}
+	if duration < 0 {
+		return fmt.Errorf("must not be negative, got %s", duration)
+	}
+
+	return nil
+}
+
+func validateOverlap(overlap string) error {
+	if !slices.Contains(overlapPolicies, overlap) {
+		return fmt.Errorf("must be one of %v, got '%s'", overlapPolicies, overlap)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS and refuses servers that don't support it
+	SMTPStartTLS = "starttls"
+	// SMTPTLS connects with implicit TLS, usually on port 465
+	SMTPTLS = "tls"
+	// SMTPNone sends in plain text, for local relays and test sinks
+	SMTPNone = "none"
+)
+
+const (
+	DefaultSMTPPort    = 587
+	DefaultSMTPTLSPort = 465
+)
+
+// SMTPConfig sends an email for every notification
+type SMTPConfig struct {
+	Host         string   `hcl:"host"`
+	Port         *int     `hcl:"port"`          // optional: defaults to 465 with tls and 587 otherwise
+	TLS          *string  `hcl:"tls"`           // optional: "starttls", "tls" or "none", defaults to "starttls"
+	Username     *string  `hcl:"username"`      // optional: authenticates with PLAIN when set
+	PasswordFile *string  `hcl:"password_file"` // optional: file holding the password
+	PasswordEnv  *string  `hcl:"password_env"`  // optional: environment variable holding the password
+	From         string   `hcl:"from"`
+	To           []string `hcl:"to"`
+	Subject      *string  `hcl:"subject"` // optional: Go template of the subject
+	Body         *string  `hcl:"body"`    // optional: Go template of the plain text body
+}
+
+func (s *SMTPConfig) GetTLS() string {
+	if s.TLS == nil {
+		return SMTPStartTLS
+	}
+
+	return *s.TLS
+}
+
+func (s *SMTPConfig) GetPort() int {
+	if s.Port != nil {
+		return *s.Port
+	}
+
+	if s.GetTLS() == SMTPTLS {
+		return DefaultSMTPTLSPort
+	}
+
+	return DefaultSMTPPort
+}
+
+// GetPassword reads the password from password_file or password_env, it is empty when neither is set
+func (s *SMTPConfig) GetPassword() (string, error) {
+	switch {
+	case s.PasswordFile != nil:
+		data, err := os.ReadFile(*s.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password_file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.PasswordEnv != nil:
+		password, ok := os.LookupEnv(*s.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s from password_env is not set", *s.PasswordEnv)
+		}
+		return password, nil
+	default:
+		return "", nil
+	}
+}
+
+func (s *SMTPConfig) validate() error {
+	if s.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if port := s.GetPort(); port <= 0 || port > 65535 {
+		return fmt.Errorf("port: must be between 1 and 65535, got %d", port)
+	}
+
+	switch s.GetTLS() {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return fmt.Errorf("tls: must be starttls, tls or none, got '%s'", s.GetTLS())
+	}
+
+	if s.PasswordFile != nil && s.PasswordEnv != nil {
+		return errors.New("only one of password_file and password_env may be set")
+	}
+	if s.Username == nil && (s.PasswordFile != nil || s.PasswordEnv != nil) {
+		return errors.New("username is required when a password is set")
+	}
+	if _, err := s.GetPassword(); err != nil {
+		return err
+	}
+
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+
+	if len(s.To) == 0 {
+		return errors.New("to: at least one recipient is required")
+	}
+	for _, to := range s.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("to: %w", err)
+		}
+	}
+
+	return nil
+}
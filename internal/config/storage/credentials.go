@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	CredentialsChain       = "chain"
+	CredentialsEnv         = "env"
+	CredentialsFile        = "file"
+	CredentialsWebIdentity = "web_identity"
+	CredentialsMetadata    = "metadata"
+	CredentialsStatic      = "static"
+)
+
+// CredentialsChainOrder is the order the chain tries providers in, static keys come last
+var CredentialsChainOrder = []string{
+	CredentialsEnv,
+	CredentialsFile,
+	CredentialsWebIdentity,
+	CredentialsMetadata,
+	CredentialsStatic,
+}
+
+// S3Credentials chooses where S3 credentials come from. Without it, the providers are tried in CredentialsChainOrder.
+type S3Credentials struct {
+	Provider string `hcl:"provider,label"` // "chain", "env", "file", "web_identity", "metadata" or "static"
+
+	// file: AWS shared credentials file, default AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+	SharedCredentialsFile *string `hcl:"shared_credentials_file"`
+	// file: profile in the shared credentials file, default AWS_PROFILE or "default"
+	Profile *string `hcl:"profile"`
+
+	// web_identity: token file, default AWS_WEB_IDENTITY_TOKEN_FILE
+	WebIdentityTokenFile *string `hcl:"web_identity_token_file"`
+	// web_identity: role to assume, default AWS_ROLE_ARN
+	RoleARN *string `hcl:"role_arn"`
+	// web_identity: STS endpoint, default the regional AWS STS endpoint
+	STSEndpoint *string `hcl:"sts_endpoint"`
+
+	// metadata: instance metadata endpoint, default the EC2 or ECS endpoint
+	MetadataEndpoint *string `hcl:"metadata_endpoint"`
+}
+
+// GetCredentialsProvider returns the provider credentials come from, the chain when no credentials block is set
+func (s *S3Storage) GetCredentialsProvider() string {
+	if s.Credentials == nil {
+		return CredentialsChain
+	}
+
+	return s.Credentials.Provider
+}
+
+// HasStaticKeys reports whether access_key and secret_key are set
+func (s *S3Storage) HasStaticKeys() bool {
+	return s.AccessKey != "" && s.SecretKey != ""
+}
+
+// ValidateCredentials validates the credentials settings
+func (s *S3Storage) ValidateCredentials() error {
+	if (s.AccessKey == "") != (s.SecretKey == "") {
+		return errors.New("access_key and secret_key must be set together")
+	}
+
+	provider := s.GetCredentialsProvider()
+	switch provider {
+	case CredentialsChain, CredentialsEnv, CredentialsFile, CredentialsWebIdentity, CredentialsMetadata:
+	case CredentialsStatic:
+		if !s.HasStaticKeys() {
+			return fmt.Errorf("credentials %s requires access_key and secret_key", CredentialsStatic)
+		}
+	default:
+		return fmt.Errorf("credentials provider must be %s, %s, %s, %s, %s or %s, got '%s'",
+			CredentialsChain, CredentialsEnv, CredentialsFile, CredentialsWebIdentity, CredentialsMetadata, CredentialsStatic, provider)
+	}
+
+	if s.Credentials == nil {
+		return nil
+	}
+
+	c := s.Credentials
+	if (c.SharedCredentialsFile != nil || c.Profile != nil) && provider != CredentialsFile && provider != CredentialsChain {
+		return fmt.Errorf("shared_credentials_file and profile are only used by the %s and %s providers", CredentialsFile, CredentialsChain)
+	}
+	if (c.WebIdentityTokenFile != nil || c.RoleARN != nil || c.STSEndpoint != nil) && provider != CredentialsWebIdentity && provider != CredentialsChain {
+		return fmt.Errorf("web_identity_token_file, role_arn and sts_endpoint are only used by the %s and %s providers", CredentialsWebIdentity, CredentialsChain)
+	}
+	if c.MetadataEndpoint != nil && provider != CredentialsMetadata && provider != CredentialsChain {
+		return fmt.Errorf("metadata_endpoint is only used by the %s and %s providers", CredentialsMetadata, CredentialsChain)
+	}
+
+	return nil
+}
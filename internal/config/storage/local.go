@@ -6,4 +6,7 @@ type LocalStorage struct {
 	// Retention settings
 	RetentionPeriod *string `hcl:"retention_period"`
 	RetentionCount  *int    `hcl:"retention_count"`
+	// RetentionOnUpload applies retention after every successful upload, default true.
+	// Turn it off when a retention_schedule takes care of pruning.
+	RetentionOnUpload *bool `hcl:"retention_on_upload"`
 }
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ObjectLockGovernance = "governance"
+	ObjectLockCompliance = "compliance"
+)
+
+// ObjectLock makes backups immutable with S3 Object Lock, so they can't be deleted or overwritten until their
+// retention ends, not even with the access key they were written with. The bucket must have object locking enabled.
+type ObjectLock struct {
+	Mode      *string `hcl:"mode"`       // optional: "governance" or "compliance", required with period
+	Period    *string `hcl:"period"`     // optional: how long backups are locked after upload, e.g. "30 days"
+	LegalHold *bool   `hcl:"legal_hold"` // optional: place a legal hold, which has to be removed by hand, default false
+}
+
+func (o *ObjectLock) GetMode() string {
+	if o.Mode == nil {
+		return ""
+	}
+
+	return *o.Mode
+}
+
+func (o *ObjectLock) IsLegalHold() bool {
+	return o.LegalHold != nil && *o.LegalHold
+}
+
+// GetRetainUntil returns until when a backup uploaded now is locked, zero when backups get no retention
+func (o *ObjectLock) GetRetainUntil(now time.Time) time.Time {
+	if o.Period == nil {
+		return time.Time{}
+	}
+
+	// Validated on load, so the period always parses here
+	days, _ := ParseRetentionPeriod(*o.Period)
+	return now.AddDate(0, 0, days)
+}
+
+func (o *ObjectLock) Validate() error {
+	switch o.GetMode() {
+	case "", ObjectLockGovernance, ObjectLockCompliance:
+	default:
+		return fmt.Errorf("mode must be %s or %s, got '%s'", ObjectLockGovernance, ObjectLockCompliance, o.GetMode())
+	}
+
+	if (o.Mode == nil) != (o.Period == nil) {
+		return errors.New("mode and period must be set together")
+	}
+
+	if o.Period != nil {
+		if _, err := ParseRetentionPeriod(*o.Period); err != nil {
+			return fmt.Errorf("period: %w", err)
+		}
+	}
+
+	if o.Period == nil && !o.IsLegalHold() {
+		return errors.New("either mode and period or legal_hold is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// Retention is a retention policy that can override the retention settings of a storage backend
+type Retention struct {
+	Period *string `hcl:"period"`
+	Count  *int    `hcl:"count"`
+}
+
+// GetEffectiveRetentionDays returns the effective retention period in days
+func (r *Retention) GetEffectiveRetentionDays() (int, error) {
+	if r.Period != nil {
+		return ParseRetentionPeriod(*r.Period)
+	}
+
+	// No retention period configured
+	return 0, nil
+}
+
+// IsRetentionConfigured checks if any retention policy is configured
+func (r *Retention) IsRetentionConfigured() bool {
+	return r != nil && (r.Period != nil || r.Count != nil)
+}
+
+func (r *Retention) Validate() error {
+	if r.Period != nil {
+		if _, err := r.GetEffectiveRetentionDays(); err != nil {
+			return fmt.Errorf("period validation failed: %w", err)
+		}
+	}
+
+	if r.Count != nil && *r.Count <= 0 {
+		return fmt.Errorf("count must be positive, got %d", *r.Count)
+	}
+
+	return nil
+}
+
+// GetRetention returns the retention settings of the S3 storage as a policy
+func (s *S3Storage) GetRetention() *Retention {
+	return &Retention{Period: s.RetentionPeriod, Count: s.RetentionCount}
+}
+
+// GetRetention returns the retention settings of the local storage as a policy
+func (l *LocalStorage) GetRetention() *Retention {
+	return &Retention{Period: l.RetentionPeriod, Count: l.RetentionCount}
+}
+
+// IsRetentionOnUpload reports whether retention is applied after every successful upload to S3
+func (s *S3Storage) IsRetentionOnUpload() bool {
+	return s.RetentionOnUpload == nil || *s.RetentionOnUpload
+}
+
+// IsRetentionOnUpload reports whether retention is applied after every successful upload to local storage
+func (l *LocalStorage) IsRetentionOnUpload() bool {
+	return l.RetentionOnUpload == nil || *l.RetentionOnUpload
+}
@@ -1,18 +1,56 @@
 package storage
 
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	BucketLookupAuto = "auto"
+	BucketLookupPath = "path"
+	BucketLookupDNS  = "dns"
+)
+
 type S3Storage struct {
 	Endpoint  string `hcl:"endpoint"`
-	AccessKey string `hcl:"access_key"`
-	SecretKey string `hcl:"secret_key"`
+	AccessKey string `hcl:"access_key,optional"` // optional with credentials from another provider
+	SecretKey string `hcl:"secret_key,optional"`
+
+	// Credentials chooses where credentials come from, optional
+	Credentials *S3Credentials `hcl:"credentials,block"`
 
 	Bucket string  `hcl:"bucket"`
 	Region *string `hcl:"region"`
 
 	Prefix *string `hcl:"prefix"`
 
+	// Connection settings, for self-hosted endpoints like MinIO
+	Insecure      *bool   `hcl:"insecure"`        // optional: connect over plain HTTP, default false
+	CAFile        *string `hcl:"ca_file"`         // optional: PEM bundle trusted in addition to the system roots
+	SkipTLSVerify *bool   `hcl:"skip_tls_verify"` // optional: don't verify the endpoint certificate, default false
+	BucketLookup  *string `hcl:"bucket_lookup"`   // optional: "path", "dns" or "auto", default "auto"
+
+	// Upload settings
+	PartSize          *string           `hcl:"part_size"`          // optional: multipart part size, e.g. "64MiB", default chosen by the client
+	UploadConcurrency *int              `hcl:"upload_concurrency"` // optional: parts uploaded in parallel, requires part_size, default 1
+	StorageClass      *string           `hcl:"storage_class"`      // optional: storage class of backups, e.g. "STANDARD_IA", default the bucket default
+	ContentType       *string           `hcl:"content_type"`       // optional: content type of backups, default "application/octet-stream"
+	Metadata          map[string]string `hcl:"metadata,optional"`  // optional: user metadata stored with backups
+
+	// ServerSideEncryption asks S3 to encrypt backups at rest, optional
+	ServerSideEncryption *ServerSideEncryption `hcl:"server_side_encryption,block"`
+
+	// ObjectLock makes backups immutable, optional
+	ObjectLock *ObjectLock `hcl:"object_lock,block"`
+
 	// Retention settings
 	RetentionPeriod *string `hcl:"retention_period"`
 	RetentionCount  *int    `hcl:"retention_count"`
+	// RetentionOnUpload applies retention after every successful upload, default true.
+	// Turn it off when a retention_schedule takes care of pruning.
+	RetentionOnUpload *bool `hcl:"retention_on_upload"`
 }
 
 func (s *S3Storage) GetRegion() string {
@@ -22,3 +60,70 @@ func (s *S3Storage) GetRegion() string {
 
 	return *s.Region
 }
+
+func (s *S3Storage) IsInsecure() bool {
+	return s.Insecure != nil && *s.Insecure
+}
+
+func (s *S3Storage) IsSkipTLSVerify() bool {
+	return s.SkipTLSVerify != nil && *s.SkipTLSVerify
+}
+
+func (s *S3Storage) GetBucketLookup() string {
+	if s.BucketLookup == nil {
+		return BucketLookupAuto
+	}
+
+	return *s.BucketLookup
+}
+
+// GetRootCAs returns the system roots with the certificates of ca_file added, nil without ca_file
+func (s *S3Storage) GetRootCAs() (*x509.CertPool, error) {
+	if s.CAFile == nil {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(*s.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca_file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("ca_file: %s holds no PEM certificates", *s.CAFile)
+	}
+
+	return pool, nil
+}
+
+// ValidateConnection validates the connection settings
+func (s *S3Storage) ValidateConnection() error {
+	switch s.GetBucketLookup() {
+	case BucketLookupAuto, BucketLookupPath, BucketLookupDNS:
+	default:
+		return fmt.Errorf("bucket_lookup must be %s, %s or %s, got '%s'", BucketLookupAuto, BucketLookupPath, BucketLookupDNS, s.GetBucketLookup())
+	}
+
+	if s.IsInsecure() {
+		if s.CAFile != nil || s.IsSkipTLSVerify() {
+			return errors.New("ca_file and skip_tls_verify can't be used with insecure, which doesn't use TLS")
+		}
+		// S3 refuses customer keys that would travel in the clear
+		if s.ServerSideEncryption != nil && s.ServerSideEncryption.Type == SSEC {
+			return fmt.Errorf("server_side_encryption %s can't be used with insecure, it requires TLS", SSEC)
+		}
+	}
+
+	if s.CAFile != nil && s.IsSkipTLSVerify() {
+		return errors.New("ca_file has no effect with skip_tls_verify")
+	}
+
+	if _, err := s.GetRootCAs(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizePattern = regexp.MustCompile(`^(\d+)\s*(b|kb|kib|mb|mib|gb|gib)?$`)
+
+// ParseSize converts size strings like "64MiB", "100 MB" or "16777216" to bytes
+// KB, MB and GB are powers of 1000, KiB, MiB and GiB powers of 1024
+func ParseSize(size string) (uint64, error) {
+	if size == "" {
+		return 0, errors.New("size cannot be empty")
+	}
+
+	matches := sizePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(size)))
+	if len(matches) != 3 {
+		return 0, fmt.Errorf("unsupported size format '%s'. Supported formats: '<number>' bytes or '<number> <unit>' "+
+			"where unit can be B, KB, KiB, MB, MiB, GB or GiB", size)
+	}
+
+	value, err := strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in size '%s': %w", size, err)
+	}
+
+	var multiplier uint64
+	switch matches[2] {
+	case "", "b":
+		multiplier = 1
+	case "kb":
+		multiplier = 1000
+	case "kib":
+		multiplier = 1 << 10
+	case "mb":
+		multiplier = 1000 * 1000
+	case "mib":
+		multiplier = 1 << 20
+	case "gb":
+		multiplier = 1000 * 1000 * 1000
+	default:
+		multiplier = 1 << 30
+	}
+
+	if value > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("size '%s' is too large, it must fit in 64 bits", size)
+	}
+
+	return value * multiplier, nil
+}
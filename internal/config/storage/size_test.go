@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    uint64
+		wantErr string
+	}{
+		{size: "16777216", want: 16777216},
+		{size: "512 B", want: 512},
+		{size: "64KB", want: 64 * 1000},
+		{size: "64KiB", want: 64 << 10},
+		{size: "100 MB", want: 100 * 1000 * 1000},
+		{size: "64MiB", want: 64 << 20},
+		{size: "2gb", want: 2 * 1000 * 1000 * 1000},
+		{size: " 2 GiB ", want: 2 << 30},
+		{size: "0", want: 0},
+		{size: "18446744073709551615", want: 18446744073709551615},
+		{size: "17179869183GiB", want: 17179869183 << 30},
+		{size: "17179869184GiB", wantErr: "too large"},
+		{size: "18446744073709552KB", wantErr: "too large"},
+		{size: "18014398509481984KiB", wantErr: "too large"},
+		{size: "18446744073709551616", wantErr: "invalid number"},
+		{size: "", wantErr: "cannot be empty"},
+		{size: "64 TB", wantErr: "unsupported size format"},
+		{size: "-1", wantErr: "unsupported size format"},
+		{size: "1.5MiB", wantErr: "unsupported size format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseSize(tt.size)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseSize(%q) = %d, %v, want error %q", tt.size, got, err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseSize(%q) error = %v", tt.size, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
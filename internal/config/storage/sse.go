@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SSES3  = "sse-s3"
+	SSEKMS = "sse-kms"
+	SSEC   = "sse-c"
+)
+
+// CustomerKeySize is the size of an SSE-C key in bytes
+const CustomerKeySize = 32
+
+// ServerSideEncryption asks S3 to encrypt stored objects at rest.
+// With SSE-C the same key has to be sent to read the objects again, so restore needs it too.
+type ServerSideEncryption struct {
+	Type            string            `hcl:"type,label"`           // "sse-s3", "sse-kms" or "sse-c"
+	KMSKeyID        *string           `hcl:"kms_key_id"`           // optional: KMS key of sse-kms, defaults to the account's aws/s3 key
+	KMSContext      map[string]string `hcl:"kms_context,optional"` // optional: encryption context of sse-kms
+	CustomerKeyFile *string           `hcl:"customer_key_file"`    // sse-c: file holding the 32 byte key as base64
+	CustomerKeyEnv  *string           `hcl:"customer_key_env"`     // sse-c: environment variable holding the key as base64
+}
+
+func (s *ServerSideEncryption) GetKMSKeyID() string {
+	if s.KMSKeyID == nil {
+		return ""
+	}
+
+	return *s.KMSKeyID
+}
+
+// GetCustomerKey reads the SSE-C key from customer_key_file or customer_key_env
+func (s *ServerSideEncryption) GetCustomerKey() ([]byte, error) {
+	var encoded string
+	switch {
+	case s.CustomerKeyFile != nil:
+		data, err := os.ReadFile(*s.CustomerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("customer_key_file: %w", err)
+		}
+		encoded = string(data)
+	case s.CustomerKeyEnv != nil:
+		value, ok := os.LookupEnv(*s.CustomerKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("customer_key_env: environment variable %s is not set", *s.CustomerKeyEnv)
+		}
+		encoded = value
+	default:
+		return nil, errors.New("customer_key_file or customer_key_env is required for sse-c")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("customer key is not base64 encoded: %w", err)
+	}
+	if len(key) != CustomerKeySize {
+		return nil, fmt.Errorf("customer key is %d bytes, it must be %d bytes", len(key), CustomerKeySize)
+	}
+
+	return key, nil
+}
+
+func (s *ServerSideEncryption) Validate() error {
+	switch s.Type {
+	case SSES3:
+	case SSEKMS:
+	case SSEC:
+		if s.CustomerKeyFile != nil && s.CustomerKeyEnv != nil {
+			return errors.New("only one of customer_key_file and customer_key_env may be set")
+		}
+		if _, err := s.GetCustomerKey(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type '%s', must be one of %s, %s or %s", s.Type, SSES3, SSEKMS, SSEC)
+	}
+
+	if s.Type != SSEKMS && (s.KMSKeyID != nil || len(s.KMSContext) > 0) {
+		return fmt.Errorf("kms_key_id and kms_context only apply to %s", SSEKMS)
+	}
+	if s.Type != SSEC && (s.CustomerKeyFile != nil || s.CustomerKeyEnv != nil) {
+		return fmt.Errorf("customer_key_file and customer_key_env only apply to %s", SSEC)
+	}
+
+	return nil
+}
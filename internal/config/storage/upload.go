@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinPartSize and MaxPartSize are the part size limits of S3 multipart uploads
+	MinPartSize = 5 << 20
+	MaxPartSize = 5 << 30
+	// MaxParts is the number of parts a multipart upload can have, so a backup can't be larger than part_size times MaxParts
+	MaxParts = 10000
+
+	DefaultContentType = "application/octet-stream"
+)
+
+// GetPartSize returns the multipart part size in bytes, 0 lets the client choose
+func (s *S3Storage) GetPartSize() uint64 {
+	if s.PartSize == nil {
+		return 0
+	}
+
+	// Validated on load, so the size always parses here
+	size, _ := ParseSize(*s.PartSize)
+	return size
+}
+
+func (s *S3Storage) GetUploadConcurrency() int {
+	if s.UploadConcurrency == nil {
+		return 1
+	}
+
+	return *s.UploadConcurrency
+}
+
+func (s *S3Storage) GetStorageClass() string {
+	if s.StorageClass == nil {
+		return ""
+	}
+
+	return *s.StorageClass
+}
+
+func (s *S3Storage) GetContentType() string {
+	if s.ContentType == nil {
+		return DefaultContentType
+	}
+
+	return *s.ContentType
+}
+
+// ValidateUpload validates the upload settings
+func (s *S3Storage) ValidateUpload() error {
+	if s.PartSize != nil {
+		size, err := ParseSize(*s.PartSize)
+		if err != nil {
+			return fmt.Errorf("part_size: %w", err)
+		}
+		if size < MinPartSize || size > MaxPartSize {
+			return fmt.Errorf("part_size must be between 5MiB and 5GiB, got '%s'", *s.PartSize)
+		}
+	}
+
+	if s.UploadConcurrency != nil {
+		if *s.UploadConcurrency <= 0 {
+			return fmt.Errorf("upload_concurrency must be positive, got %d", *s.UploadConcurrency)
+		}
+		// Every concurrent part is buffered in memory, with the default part size of 512MiB that adds up quickly
+		if *s.UploadConcurrency > 1 && s.PartSize == nil {
+			return errors.New("upload_concurrency requires part_size, as every part uploaded in parallel is buffered in memory")
+		}
+	}
+
+	if s.StorageClass != nil && (*s.StorageClass == "" || strings.ToUpper(*s.StorageClass) != *s.StorageClass) {
+		return fmt.Errorf("storage_class must be an upper case storage class like STANDARD_IA, got '%s'", *s.StorageClass)
+	}
+
+	if s.ContentType != nil && *s.ContentType == "" {
+		return errors.New("content_type cannot be empty")
+	}
+
+	for key := range s.Metadata {
+		if key == "" || strings.HasPrefix(strings.ToLower(key), "x-amz-") || strings.ContainsAny(key, " :\t\r\n") {
+			return fmt.Errorf("metadata key '%s' is not a valid user metadata name", key)
+		}
+	}
+
+	return nil
+}
@@ -8,27 +8,40 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
 )
 
+// maxStderr is how much of the end of pg_dump's stderr is kept for error reporting
+const maxStderr = 4096
+
 type Process struct {
 	cmd *exec.Cmd
 
 	stdout io.ReadCloser
+	stderr tailBuffer
 }
 
 func (p *Process) Start() error {
 	p.stdout, _ = p.cmd.StdoutPipe()
+	p.cmd.Stderr = &p.stderr
 	if err := p.cmd.Start(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// Wait waits for pg_dump to exit, a failure includes the end of its stderr
 func (p *Process) Wait() error {
 	err := p.cmd.Wait()
 	p.stdout.Close()
+
+	if err != nil {
+		if stderr := strings.TrimSpace(p.stderr.String()); stderr != "" {
+			return fmt.Errorf("%w\npg_dump stderr: %s", err, stderr)
+		}
+	}
 	return err
 }
 
@@ -39,9 +52,8 @@ func (p *Process) Read(pb []byte) (int, error) {
 	return p.stdout.Read(pb)
 }
 
-// TODO: dump multiple databases
-
-func Dump(ctx context.Context) (*Process, error) {
+// Dump prepares pg_dump for the given database, an empty name dumps postgres.database
+func Dump(ctx context.Context, database string) (*Process, error) {
 	process := new(Process)
 
 	argument := []string{
@@ -57,8 +69,12 @@ func Dump(ctx context.Context) (*Process, error) {
 		argument = append(argument, "--username", *config.Loaded.Postgres.User)
 	}
 
-	if config.Loaded.Postgres.Database != nil {
-		argument = append(argument, "--dbname", *config.Loaded.Postgres.Database)
+	if database == "" && config.Loaded.Postgres.Database != nil {
+		database = *config.Loaded.Postgres.Database
+	}
+
+	if database != "" {
+		argument = append(argument, "--dbname", database)
 	}
 
 	process.cmd = exec.CommandContext(ctx, "pg_dump", argument...)
@@ -68,3 +84,20 @@ func Dump(ctx context.Context) (*Process, error) {
 
 	return process, nil
 }
+
+// tailBuffer keeps the last maxStderr bytes written to it
+type tailBuffer struct {
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > maxStderr {
+		b.data = b.data[len(b.data)-maxStderr:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
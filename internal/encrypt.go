@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+const (
+	// ExtensionAge is appended to the names of backups encrypted with age
+	ExtensionAge = "age"
+	// ExtensionOpenPGP is appended to the names of backups encrypted with OpenPGP
+	ExtensionOpenPGP = "pgp"
+)
+
+// encryptionExtension returns the extension of backups encrypted with the settings
+func encryptionExtension(settings *config.EncryptConfig) string {
+	switch settings.GetMethod() {
+	case config.EncryptOpenPGP:
+		return ExtensionOpenPGP
+	case config.EncryptEnvelope:
+		return ExtensionEnvelope
+	default:
+		return ExtensionAge
+	}
+}
+
+// Encrypt encrypts the input stream to the configured recipients. It also returns the sidecars that have to be
+// stored next to the backup to decrypt it, keyed by their suffix.
+func Encrypt(input io.Reader, settings *config.EncryptConfig) (io.ReadCloser, map[string][]byte, error) {
+	switch settings.GetMethod() {
+	case config.EncryptAge:
+		recipients, err := settings.GetAgeRecipients()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return encryptStream(input, func(w io.Writer) (io.WriteCloser, error) {
+			return age.Encrypt(w, recipients...)
+		}), nil, nil
+	case config.EncryptOpenPGP:
+		encrypted, err := encryptOpenPGP(input, settings.OpenPGP)
+		return encrypted, nil, err
+	case config.EncryptEnvelope:
+		encrypted, keys, err := encryptEnvelope(input, settings.Envelope)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return encrypted, map[string][]byte{storage.KeysSuffix: keys}, nil
+	default:
+		return nil, nil, fmt.Errorf("no encryption recipients configured")
+	}
+}
+
+// encryptStream pipes the input through the encryptor created by setup
+func encryptStream(input io.Reader, setup func(w io.Writer) (io.WriteCloser, error)) io.ReadCloser {
+	r, w := io.Pipe()
+
+	go func() {
+		// Encryptors write their header right away, so they are set up once the pipe has a reader
+		encryptor, err := setup(w)
+		if err != nil {
+			w.CloseWithError(fmt.Errorf("failed to set up encryption: %w", err))
+			return
+		}
+
+		if _, err := io.Copy(encryptor, input); err != nil {
+			w.CloseWithError(fmt.Errorf("failed to encrypt backup: %w", err))
+			return
+		}
+		w.CloseWithError(encryptor.Close())
+	}()
+
+	return &pipeReader{PipeReader: r, input: input}
+}
+
+// Decrypt decrypts the input stream if the filename shows it is encrypted, and returns the name of the
+// backup without the encryption extension. Envelope encrypted backups read their data key from the keys sidecar.
+func Decrypt(ctx context.Context, input io.Reader, filename string, sidecars storage.SidecarReader) (io.Reader, string, error) {
+	switch {
+	case strings.HasSuffix(filename, "."+ExtensionAge):
+		identities, err := config.Loaded.Encrypt.GetAgeIdentities()
+		if err != nil {
+			return nil, "", err
+		}
+
+		decrypted, err := age.Decrypt(input, identities...)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt backup: %w", err)
+		}
+
+		return decrypted, strings.TrimSuffix(filename, "."+ExtensionAge), nil
+	case strings.HasSuffix(filename, "."+ExtensionOpenPGP):
+		var settings *config.OpenPGPConfig
+		if config.Loaded.Encrypt != nil {
+			settings = config.Loaded.Encrypt.OpenPGP
+		}
+
+		decrypted, err := decryptOpenPGP(input, settings)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return decrypted, strings.TrimSuffix(filename, "."+ExtensionOpenPGP), nil
+	case strings.HasSuffix(filename, "."+ExtensionEnvelope):
+		var settings *config.EnvelopeConfig
+		if config.Loaded.Encrypt != nil {
+			settings = config.Loaded.Encrypt.Envelope
+		}
+
+		keys, err := sidecars(ctx, storage.KeysSuffix)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read the data key of the backup: %w", err)
+		}
+
+		decrypted, err := decryptEnvelope(input, keys, settings)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return decrypted, strings.TrimSuffix(filename, "."+ExtensionEnvelope), nil
+	default:
+		return input, filename, nil
+	}
+}
+
+// Open decrypts and decompresses a stored backup as its name requires, returning the pg_dump archive
+func Open(ctx context.Context, input io.Reader, filename string, sidecars storage.SidecarReader) (io.Reader, error) {
+	decrypted, filename, err := Decrypt(ctx, input, filename, sidecars)
+	if err != nil {
+		return nil, err
+	}
+
+	decompressed, err := Decompress(decrypted, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+
+	return decompressed, nil
+}
+
+// pipeReader closes its input along with the pipe, so that closing the end of a chain of streams
+// unblocks every writer in it
+type pipeReader struct {
+	*io.PipeReader
+	input io.Reader
+}
+
+func (r *pipeReader) Close() error {
+	if closer, ok := r.input.(io.Closer); ok {
+		closer.Close()
+	}
+	return r.PipeReader.Close()
+}
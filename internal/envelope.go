@@ -0,0 +1,337 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+const (
+	// ExtensionEnvelope is appended to the names of backups encrypted with a wrapped data key
+	ExtensionEnvelope = "enc"
+
+	// envelopeVersion is the version of the stream and keys sidecar formats
+	envelopeVersion = 1
+	// envelopeChunkSize is the amount of plaintext sealed in a single chunk
+	envelopeChunkSize = 64 * 1024
+)
+
+// envelopeMagic starts every envelope encrypted stream
+var envelopeMagic = []byte("PGBKENV1")
+
+// Envelope is stored in the keys sidecar of a backup and holds its data key wrapped by each master key
+type Envelope struct {
+	Version int `json:"version"`
+	// Cipher is the cipher the data and the wrapped keys are encrypted with
+	Cipher string       `json:"cipher"`
+	Keys   []WrappedKey `json:"keys"`
+}
+
+// WrappedKey is a data key encrypted with a master key
+type WrappedKey struct {
+	// MasterKey is the ID of the master key the data key is wrapped with
+	MasterKey string `json:"master_key"`
+	Nonce     []byte `json:"nonce"`
+	Key       []byte `json:"wrapped_key"`
+}
+
+// MasterKeys returns the IDs of the master keys the data key is wrapped with
+func (e *Envelope) MasterKeys() []string {
+	ids := make([]string, 0, len(e.Keys))
+	for _, key := range e.Keys {
+		ids = append(ids, key.MasterKey)
+	}
+	return ids
+}
+
+// newEnvelope wraps the data key with every master key
+func newEnvelope(dataKey []byte, masterKeys []config.MasterKey) (*Envelope, error) {
+	envelope := &Envelope{Version: envelopeVersion, Cipher: "AES-256-GCM"}
+
+	for _, masterKey := range masterKeys {
+		aead, err := newAEAD(masterKey.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+
+		// The master key ID is authenticated, so a wrapped key can't be passed off as wrapped by another key
+		envelope.Keys = append(envelope.Keys, WrappedKey{
+			MasterKey: masterKey.ID,
+			Nonce:     nonce,
+			Key:       aead.Seal(nil, nonce, dataKey, []byte(masterKey.ID)),
+		})
+	}
+
+	return envelope, nil
+}
+
+// parseEnvelope parses a keys sidecar
+func parseEnvelope(data []byte) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse keys sidecar: %w", err)
+	}
+	if envelope.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported keys sidecar version %d", envelope.Version)
+	}
+
+	return &envelope, nil
+}
+
+// Unwrap returns the data key, unwrapped with the first of the given master keys it is wrapped with
+func (e *Envelope) Unwrap(masterKeys []config.MasterKey) ([]byte, error) {
+	for _, masterKey := range masterKeys {
+		for _, wrapped := range e.Keys {
+			if wrapped.MasterKey != masterKey.ID {
+				continue
+			}
+
+			aead, err := newAEAD(masterKey.Key)
+			if err != nil {
+				return nil, err
+			}
+			if len(wrapped.Nonce) != aead.NonceSize() {
+				return nil, fmt.Errorf("data key wrapped with master key %s has an invalid nonce", wrapped.MasterKey)
+			}
+
+			dataKey, err := aead.Open(nil, wrapped.Nonce, wrapped.Key, []byte(wrapped.MasterKey))
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap data key with master key %s: %w", wrapped.MasterKey, err)
+			}
+
+			return dataKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("data key is wrapped with master keys %v, none of which is configured", e.MasterKeys())
+}
+
+// IsWrappedWith reports whether the data key is wrapped with exactly the given master keys
+func (e *Envelope) IsWrappedWith(masterKeys []config.MasterKey) bool {
+	ids := make([]string, 0, len(masterKeys))
+	for _, masterKey := range masterKeys {
+		ids = append(ids, masterKey.ID)
+	}
+
+	current := e.MasterKeys()
+	slices.Sort(ids)
+	slices.Sort(current)
+	return slices.Equal(ids, current)
+}
+
+func (e *Envelope) marshal() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// encryptEnvelope encrypts the input with a new random data key and returns the keys sidecar holding it
+func encryptEnvelope(input io.Reader, settings *config.EnvelopeConfig) (io.ReadCloser, []byte, error) {
+	masterKeys, err := settings.GetMasterKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey := make([]byte, config.MasterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	envelope, err := newEnvelope(dataKey, masterKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sidecar, err := envelope.marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encryptStream(input, func(w io.Writer) (io.WriteCloser, error) {
+		header := binary.BigEndian.AppendUint32(slices.Clone(envelopeMagic), envelopeChunkSize)
+		if _, err := w.Write(header); err != nil {
+			return nil, err
+		}
+
+		return &envelopeWriter{writer: w, aead: aead, buffer: make([]byte, 0, envelopeChunkSize)}, nil
+	}), sidecar, nil
+}
+
+// decryptEnvelope decrypts the input with the data key in the keys sidecar
+func decryptEnvelope(input io.Reader, sidecar []byte, settings *config.EnvelopeConfig) (io.Reader, error) {
+	masterKeys, err := settings.GetUnwrapKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := parseEnvelope(sidecar)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := envelope.Unwrap(masterKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(envelopeMagic)+4)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return nil, fmt.Errorf("failed to read envelope header: %w", err)
+	}
+	if !bytes.Equal(header[:len(envelopeMagic)], envelopeMagic) {
+		return nil, errors.New("backup is not envelope encrypted")
+	}
+
+	chunkSize := binary.BigEndian.Uint32(header[len(envelopeMagic):])
+	if chunkSize == 0 || chunkSize > 16*1024*1024 {
+		return nil, fmt.Errorf("envelope header has an invalid chunk size of %d bytes", chunkSize)
+	}
+
+	return &envelopeReader{
+		reader: bufio.NewReader(input),
+		aead:   aead,
+		chunk:  make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives the nonce of a chunk from its position. Every backup has its own data key,
+// so nonces never repeat under a key. Marking the last chunk makes truncated streams fail to decrypt.
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// envelopeWriter seals the stream in chunks of envelopeChunkSize bytes
+type envelopeWriter struct {
+	writer  io.Writer
+	aead    cipher.AEAD
+	buffer  []byte
+	counter uint64
+}
+
+func (w *envelopeWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so the last chunk is sealed by Close
+		if len(w.buffer) == envelopeChunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buffer[len(w.buffer):envelopeChunkSize], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the last chunk
+func (w *envelopeWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *envelopeWriter) seal(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.counter, last), w.buffer, nil)
+	if _, err := w.writer.Write(sealed); err != nil {
+		return err
+	}
+
+	w.counter++
+	w.buffer = w.buffer[:0]
+	return nil
+}
+
+// envelopeReader opens the chunks sealed by envelopeWriter
+type envelopeReader struct {
+	reader    *bufio.Reader
+	aead      cipher.AEAD
+	chunk     []byte
+	plaintext []byte
+	counter   uint64
+	done      bool
+}
+
+func (r *envelopeReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+func (r *envelopeReader) open() error {
+	n, err := io.ReadFull(r.reader, r.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		return errors.New("encrypted backup is truncated")
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one when nothing follows it
+		if _, err := r.reader.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plaintext, err := r.aead.Open(r.chunk[:0], chunkNonce(r.counter, last), r.chunk[:n], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt chunk %d, the backup is corrupted, truncated or was modified", r.counter)
+	}
+
+	r.counter++
+	r.plaintext = plaintext
+	r.done = last
+	return nil
+}
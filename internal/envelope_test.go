@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+func testAEAD(t *testing.T) cipher.AEAD {
+	t.Helper()
+
+	key := make([]byte, config.MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+// sealChunks seals plaintext with envelopeWriter and returns the sealed chunks
+func sealChunks(t *testing.T, aead cipher.AEAD, plaintext []byte) [][]byte {
+	t.Helper()
+
+	var sealed bytes.Buffer
+	writer := &envelopeWriter{writer: &sealed, aead: aead, buffer: make([]byte, 0, envelopeChunkSize)}
+	if _, err := writer.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks [][]byte
+	data := sealed.Bytes()
+	for size := envelopeChunkSize + aead.Overhead(); len(data) > size; data = data[size:] {
+		chunks = append(chunks, data[:size])
+	}
+	return append(chunks, data)
+}
+
+// openChunks reads the chunks back with envelopeReader
+func openChunks(aead cipher.AEAD, chunks [][]byte) ([]byte, error) {
+	reader := &envelopeReader{
+		reader: bufio.NewReader(bytes.NewReader(bytes.Join(chunks, nil))),
+		aead:   aead,
+		chunk:  make([]byte, envelopeChunkSize+aead.Overhead()),
+	}
+	return io.ReadAll(reader)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantChunks int
+	}{
+		{name: "empty", size: 0, wantChunks: 1},
+		{name: "one byte", size: 1, wantChunks: 1},
+		{name: "just under a chunk", size: envelopeChunkSize - 1, wantChunks: 1},
+		{name: "exactly a chunk", size: envelopeChunkSize, wantChunks: 1},
+		{name: "just over a chunk", size: envelopeChunkSize + 1, wantChunks: 2},
+		{name: "several chunks", size: 3*envelopeChunkSize + 100, wantChunks: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aead := testAEAD(t)
+			plaintext := make([]byte, tt.size)
+			if _, err := rand.Read(plaintext); err != nil {
+				t.Fatal(err)
+			}
+
+			chunks := sealChunks(t, aead, plaintext)
+			if len(chunks) != tt.wantChunks {
+				t.Errorf("chunks = %d, want %d", len(chunks), tt.wantChunks)
+			}
+
+			got, err := openChunks(aead, chunks)
+			if err != nil {
+				t.Fatalf("failed to open chunks: %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Error("plaintext read back differs from the plaintext written")
+			}
+		})
+	}
+}
+
+func TestEnvelopeRejectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(chunks [][]byte) [][]byte
+	}{
+		{
+			name: "last chunk dropped",
+			tamper: func(chunks [][]byte) [][]byte {
+				return chunks[:len(chunks)-1]
+			},
+		},
+		{
+			name: "every chunk dropped",
+			tamper: func([][]byte) [][]byte {
+				return nil
+			},
+		},
+		{
+			name: "last chunk cut short",
+			tamper: func(chunks [][]byte) [][]byte {
+				last := chunks[len(chunks)-1]
+				return append(chunks[:len(chunks)-1], last[:len(last)-1])
+			},
+		},
+		{
+			name: "cut in the middle of a chunk",
+			tamper: func(chunks [][]byte) [][]byte {
+				return [][]byte{chunks[0], chunks[1][:100]}
+			},
+		},
+		{
+			name: "chunks reordered",
+			tamper: func(chunks [][]byte) [][]byte {
+				return [][]byte{chunks[1], chunks[0], chunks[2]}
+			},
+		},
+		{
+			name: "chunk repeated",
+			tamper: func(chunks [][]byte) [][]byte {
+				return [][]byte{chunks[0], chunks[0], chunks[1], chunks[2]}
+			},
+		},
+		{
+			name: "chunk appended after the last one",
+			tamper: func(chunks [][]byte) [][]byte {
+				return append(chunks, chunks[0])
+			},
+		},
+		{
+			name: "byte flipped",
+			tamper: func(chunks [][]byte) [][]byte {
+				chunks[1][10] ^= 1
+				return chunks
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aead := testAEAD(t)
+			plaintext := bytes.Repeat([]byte("x"), 2*envelopeChunkSize+100)
+
+			chunks := sealChunks(t, aead, plaintext)
+			if len(chunks) != 3 {
+				t.Fatalf("chunks = %d, want 3", len(chunks))
+			}
+
+			// Copy the chunks, tampering must not write through to a shared buffer
+			copied := make([][]byte, len(chunks))
+			for i, chunk := range chunks {
+				copied[i] = slices.Clone(chunk)
+			}
+
+			if _, err := openChunks(aead, tt.tamper(copied)); err == nil {
+				t.Error("tampered stream was read without error")
+			}
+		})
+	}
+}
+
+func TestEnvelopeUnwrap(t *testing.T) {
+	newKey := func(id string) config.MasterKey {
+		key := make([]byte, config.MasterKeySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		return config.MasterKey{ID: id, Key: key}
+	}
+
+	current := newKey("current")
+	retired := newKey("retired")
+	other := newKey("other")
+	impostor := config.MasterKey{ID: "current", Key: other.Key}
+
+	dataKey := make([]byte, config.MasterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := newEnvelope(dataKey, []config.MasterKey{current, retired})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    []config.MasterKey
+		wantErr string
+	}{
+		{name: "current key", keys: []config.MasterKey{current}},
+		{name: "retired key", keys: []config.MasterKey{retired}},
+		{name: "unknown key first", keys: []config.MasterKey{other, retired}},
+		{name: "no matching key", keys: []config.MasterKey{other}, wantErr: "none of which is configured"},
+		{name: "wrong key under a known ID", keys: []config.MasterKey{impostor}, wantErr: "failed to unwrap data key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := envelope.Unwrap(tt.keys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Unwrap() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unwrap() error = %v", err)
+			}
+			if !bytes.Equal(got, dataKey) {
+				t.Error("Unwrap() returned a different data key")
+			}
+		})
+	}
+
+	if !envelope.IsWrappedWith([]config.MasterKey{retired, current}) {
+		t.Error("IsWrappedWith() = false for the keys the envelope was wrapped with")
+	}
+	if envelope.IsWrappedWith([]config.MasterKey{current}) {
+		t.Error("IsWrappedWith() = true for a subset of the keys")
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "valid", data: `{"version": 1, "cipher": "AES-256-GCM", "keys": []}`},
+		{name: "not JSON", data: `PGBKENV1`, wantErr: "failed to parse keys sidecar"},
+		{name: "unknown version", data: `{"version": 2, "keys": []}`, wantErr: "unsupported keys sidecar version 2"},
+		{name: "missing version", data: `{"keys": []}`, wantErr: "unsupported keys sidecar version 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEnvelope([]byte(tt.data))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("parseEnvelope() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("parseEnvelope() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package event lets backups, restores and retention runs report what happened to anyone interested,
+// such as the metrics exporter, without depending on them.
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+// Stage is the step of a backup that failed
+type Stage string
+
+const (
+	StageDump      Stage = "dump"
+	StageCompress  Stage = "compress"
+	StageEncrypt   Stage = "encrypt"
+	StageUpload    Stage = "upload"
+	StageRetention Stage = "retention"
+)
+
+// Event is published when an operation finishes
+type Event interface {
+	event()
+}
+
+// Upload is the outcome of uploading one backup to one storage backend
+type Upload struct {
+	Backend string
+	Bytes   int64
+	Err     error
+}
+
+// BackupFinished is published once for every database a backup job dumped, after the last attempt of the run
+type BackupFinished struct {
+	Job      string
+	Database string
+	// Backup is the name of the backup relative to the root of every storage backend
+	Backup   string
+	Started  time.Time
+	Finished time.Time
+	// Stage is the step that failed, it is empty when the backup succeeded
+	Stage Stage
+	Err   error
+	// DumpedBytes is the size of the pg_dump output, CompressedBytes the size after compression
+	DumpedBytes     int64
+	CompressedBytes int64
+	Uploads         []Upload
+}
+
+// RestoreFinished is published when a restore into a database finished
+type RestoreFinished struct {
+	Database string
+	Backup   string
+	Started  time.Time
+	Finished time.Time
+	// Bytes is the size of the archive streamed to pg_restore
+	Bytes int64
+	Err   error
+}
+
+// RetentionFinished is published when retention was applied to a path of a storage backend
+type RetentionFinished struct {
+	Backend string
+	Path    string
+	Deleted int
+	Err     error
+}
+
+// Inventory is published with the backups held by a storage backend after they changed
+type Inventory struct {
+	Backend string
+	Count   int
+	Size    int64
+}
+
+func (BackupFinished) event()    {}
+func (RestoreFinished) event()   {}
+func (RetentionFinished) event() {}
+func (Inventory) event()         {}
+
+// Handler receives published events. Handlers run synchronously and must not block.
+type Handler func(Event)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+)
+
+// Subscribe registers a handler for every event published from now on
+func Subscribe(handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	handlers = append(handlers, handler)
+}
+
+// Publish passes the event to every subscribed handler
+func Publish(e Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// Subscribed reports whether any handler is subscribed, so that publishers can skip gathering costly events
+func Subscribed() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return len(handlers) > 0
+}
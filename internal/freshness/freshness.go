@@ -0,0 +1,110 @@
+// Package freshness tracks the newest successful backup of every database backed up on a schedule
+package freshness
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+)
+
+// seedRetryInterval is how long to wait before listing storage again after seeding failed
+const seedRetryInterval = time.Minute
+
+// Tracker knows the newest successful backup of every scheduled database.
+// It is seeded from storage and updated by backup events afterwards.
+type Tracker struct {
+	mu     sync.Mutex
+	seeded bool
+	latest map[string]time.Time
+}
+
+// Database is the age of the newest successful backup of a database
+type Database struct {
+	LastBackup *time.Time `json:"last_backup,omitempty"`
+	Age        string     `json:"age,omitempty"`
+	Stale      bool       `json:"stale"`
+}
+
+// NewTracker creates a tracker that follows backup events
+func NewTracker() *Tracker {
+	t := &Tracker{latest: make(map[string]time.Time)}
+	event.Subscribe(t.observe)
+	return t
+}
+
+func (t *Tracker) observe(e event.Event) {
+	backup, ok := e.(event.BackupFinished)
+	if !ok || backup.Err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if backup.Finished.After(t.latest[backup.Database]) {
+		t.latest[backup.Database] = backup.Finished
+	}
+}
+
+// Seed looks up the newest backup of every scheduled database in storage, retrying until it succeeds
+func (t *Tracker) Seed(ctx context.Context) {
+	logger := log.Logger.With().Str("caller", "freshness_seed").Logger()
+
+	for {
+		latest, err := internal.LatestBackups(ctx, internal.ScheduledBackupJobs())
+		if err == nil {
+			t.mu.Lock()
+			for database, newest := range latest {
+				// A backup that finished while seeding may be newer than what storage listed
+				if current, ok := t.latest[database]; !ok || newest.After(current) {
+					t.latest[database] = newest
+				}
+			}
+			t.seeded = true
+			t.mu.Unlock()
+
+			logger.Info().Int("databases", len(latest)).Msg("looked up the newest backup of every scheduled database")
+			return
+		}
+
+		logger.Warn().Err(err).Dur("retry_in", seedRetryInterval).Msg("failed to look up the newest backups")
+
+		select {
+		case <-time.After(seedRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check reports whether the tracker is seeded and every database has a backup younger than maxAge,
+// along with the details of each database. A zero maxAge never marks a database as stale.
+func (t *Tracker) Check(now time.Time, maxAge time.Duration) (bool, map[string]Database) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fresh := t.seeded
+	databases := make(map[string]Database, len(t.latest))
+
+	for database, newest := range t.latest {
+		status := Database{}
+		if !newest.IsZero() {
+			status.LastBackup = &newest
+			status.Age = now.Sub(newest).Round(time.Second).String()
+		}
+
+		status.Stale = maxAge > 0 && (newest.IsZero() || now.Sub(newest) > maxAge)
+		if status.Stale {
+			fresh = false
+		}
+
+		databases[database] = status
+	}
+
+	return fresh, databases
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// GarbageCollect removes incomplete and orphaned artifacts from every configured storage backend
+func GarbageCollect(ctx context.Context, opts storage.GCOptions) error {
+	logger := log.Logger.With().Str("caller", "garbage_collect").Logger()
+
+	logger.Info().
+		Bool("dry_run", opts.DryRun).
+		Dur("min_age", opts.MinAge).
+		Msg("starting garbage collection")
+
+	var errs []error
+	found := 0
+
+	if config.Loaded.Storage.S3 != nil {
+		count, err := s3.GarbageCollect(ctx, opts)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("bucket", config.Loaded.Storage.S3.Bucket).
+				Msg("S3 garbage collection failed")
+			errs = append(errs, fmt.Errorf("s3: %w", err))
+		}
+		found += count
+	}
+
+	if config.Loaded.Storage.Local != nil {
+		count, err := local.GarbageCollect(ctx, opts)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("directory", config.Loaded.Storage.Local.Directory).
+				Msg("local garbage collection failed")
+			errs = append(errs, fmt.Errorf("local: %w", err))
+		}
+		found += count
+	}
+
+	logger.Info().
+		Int("found_count", found).
+		Bool("dry_run", opts.DryRun).
+		Msg("garbage collection finished")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"io"
+)
+
+// holdback is how much of the end of a backup is held back until it was verified,
+// so that readers never see the end of an archive whose signature or checksum turns out to be bad
+const holdback = 64 * 1024
+
+// holdbackReader returns the stream, holding back its end until check passed once the stream was read to the end
+type holdbackReader struct {
+	reader io.Reader
+	check  func() error
+	buffer []byte
+	// chunk is reused for every read from reader
+	chunk []byte
+	eof   bool
+	err   error
+}
+
+func (r *holdbackReader) Read(p []byte) (int, error) {
+	if r.chunk == nil {
+		r.chunk = make([]byte, 32*1024)
+	}
+
+	for !r.eof && len(r.buffer) <= holdback {
+		n, err := r.reader.Read(r.chunk)
+		r.buffer = append(r.buffer, r.chunk[:n]...)
+
+		if errors.Is(err, io.EOF) {
+			r.eof = true
+			r.err = r.check()
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	available := len(r.buffer)
+	if !r.eof {
+		available -= holdback
+	}
+
+	n := copy(p, r.buffer[:available])
+	r.buffer = r.buffer[n:]
+
+	if r.eof && len(r.buffer) == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
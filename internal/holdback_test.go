@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHoldbackReader(t *testing.T) {
+	errCheck := errors.New("checksum mismatch")
+	errRead := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		size     int
+		checkErr error
+		// readErr fails the stream once it was read to the end instead of ending it
+		readErr error
+		// oneByte reads the stream a byte at a time
+		oneByte bool
+	}{
+		{name: "empty", size: 0},
+		{name: "smaller than the holdback", size: 1000},
+		{name: "exactly the holdback", size: holdback},
+		{name: "just over the holdback", size: holdback + 1},
+		{name: "several times the holdback", size: 5*holdback + 123},
+		{name: "read a byte at a time", size: holdback + 100, oneByte: true},
+		{name: "check fails on a small stream", size: 1000, checkErr: errCheck},
+		{name: "check fails on a large stream", size: 5*holdback + 123, checkErr: errCheck},
+		{name: "check fails read a byte at a time", size: 2 * holdback, checkErr: errCheck, oneByte: true},
+		{name: "stream fails", size: 3 * holdback, readErr: errRead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatal(err)
+			}
+
+			var source io.Reader = bytes.NewReader(data)
+			if tt.readErr != nil {
+				source = io.MultiReader(source, iotest.ErrReader(tt.readErr))
+			}
+			if tt.oneByte {
+				source = iotest.OneByteReader(source)
+			}
+
+			checked := 0
+			reader := &holdbackReader{reader: source, check: func() error {
+				checked++
+				return tt.checkErr
+			}}
+
+			got, err := io.ReadAll(reader)
+
+			wantErr := tt.checkErr
+			if tt.readErr != nil {
+				wantErr = tt.readErr
+			}
+			if !errors.Is(err, wantErr) {
+				t.Fatalf("error = %v, want %v", err, wantErr)
+			}
+
+			if wantErr == nil {
+				if !bytes.Equal(got, data) {
+					t.Errorf("read %d bytes that differ from the %d bytes of the stream", len(got), len(data))
+				}
+			} else if len(got) > max(tt.size-holdback, 0) {
+				// The end of a stream that fails is never returned
+				t.Errorf("returned %d bytes of a failing %d byte stream, want at most %d", len(got), tt.size, max(tt.size-holdback, 0))
+			}
+
+			wantChecked := 1
+			if tt.readErr != nil {
+				wantChecked = 0
+			}
+			if checked != wantChecked {
+				t.Errorf("check called %d times, want %d", checked, wantChecked)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// publishInventory publishes the number and total size of the backups held by each given storage backend
+func publishInventory(ctx context.Context, includeS3, includeLocal bool) {
+	logger := log.Logger.With().Str("caller", "inventory").Logger()
+
+	// Listing every backup is only worth it when someone is interested
+	if !event.Subscribed() {
+		return
+	}
+
+	if includeS3 {
+		client, err := s3.CreateClient()
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to create S3 client for inventory")
+		} else if backups, err := s3.ListBackups(ctx, client); err != nil {
+			logger.Warn().Err(err).Msg("failed to list S3 backups for inventory")
+		} else {
+			inventory := event.Inventory{Backend: event.BackendS3, Count: len(backups)}
+			for _, backup := range backups {
+				inventory.Size += backup.Size
+			}
+			event.Publish(inventory)
+		}
+	}
+
+	if includeLocal {
+		if backups, err := local.ListBackups(); err != nil {
+			logger.Warn().Err(err).Msg("failed to list local backups for inventory")
+		} else {
+			inventory := event.Inventory{Backend: event.BackendLocal, Count: len(backups)}
+			for _, backup := range backups {
+				inventory.Size += backup.Size
+			}
+			event.Publish(inventory)
+		}
+	}
+}
+
+// LatestBackups returns the time of the newest backup of every database the jobs back up, across all of
+// their storage backends. Databases without any backup are included with a zero time.
+func LatestBackups(ctx context.Context, jobs []BackupJob) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time)
+
+	var client *minio.Client
+	for _, job := range jobs {
+		if job.S3 && client == nil {
+			var err error
+			if client, err = s3.CreateClient(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, database := range job.databases() {
+			label := databaseLabel(database)
+			target := job.Target(database)
+			newest := latest[label]
+
+			if job.S3 {
+				backups, err := s3.ListTargetBackups(ctx, client, target)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list S3 backups: %w", err)
+				}
+				if len(backups) > 0 && backups[0].LastModified.After(newest) {
+					newest = backups[0].LastModified
+				}
+			}
+
+			if job.Local {
+				backups, err := local.ListTargetBackups(target)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list local backups: %w", err)
+				}
+				if len(backups) > 0 && backups[0].LastModified.After(newest) {
+					newest = backups[0].LastModified
+				}
+			}
+
+			latest[label] = newest
+		}
+	}
+
+	return latest, nil
+}
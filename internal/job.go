@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"path"
+	"strings"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	storageconfig "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+// BackupJob describes what a backup dumps, where it is stored and how long it is kept
+type BackupJob struct {
+	// Name is empty for the default job, whose backups are stored in the root of each storage backend
+	Name string
+	// Databases lists the databases to dump, an empty list dumps postgres.database
+	Databases []string
+	S3        bool
+	Local     bool
+	// Compress is nil when backups are not compressed
+	Compress *config.CompressConfig
+	// Encrypt is nil when backups are not encrypted
+	Encrypt *config.EncryptConfig
+	// Retention overrides the retention settings of each storage backend when set
+	Retention *storageconfig.Retention
+}
+
+// DefaultBackupJob returns the job run by the top-level schedule list and by `backup` without --job
+func DefaultBackupJob() BackupJob {
+	return BackupJob{
+		S3:       config.Loaded.Storage.S3 != nil,
+		Local:    config.Loaded.Storage.Local != nil,
+		Compress: config.Loaded.Compress,
+		Encrypt:  encryptSettings(),
+	}
+}
+
+// NewBackupJob returns the backup job for a job block of the configuration
+func NewBackupJob(job config.JobConfig) BackupJob {
+	return BackupJob{
+		Name:      job.Name,
+		Databases: job.GetDatabases(*config.Loaded),
+		S3:        config.Loaded.Storage.S3 != nil && job.UsesStorage(config.StorageS3),
+		Local:     config.Loaded.Storage.Local != nil && job.UsesStorage(config.StorageLocal),
+		Compress:  job.GetCompress(*config.Loaded),
+		Encrypt:   encryptSettings(),
+		Retention: job.Retention,
+	}
+}
+
+// encryptSettings returns the encryption settings every job uses, nil when backups are not encrypted
+func encryptSettings() *config.EncryptConfig {
+	if !config.Loaded.Encrypt.IsEnabled() {
+		return nil
+	}
+
+	return config.Loaded.Encrypt
+}
+
+// BackupJobs returns the default job followed by every job block of the configuration
+func BackupJobs() []BackupJob {
+	jobs := []BackupJob{DefaultBackupJob()}
+	for _, job := range config.Loaded.Jobs {
+		jobs = append(jobs, NewBackupJob(job))
+	}
+
+	return jobs
+}
+
+// ScheduledBackupJobs returns the backup jobs `schedule run` runs: the default job when the top-level
+// schedule list is set, followed by every enabled job block
+func ScheduledBackupJobs() []BackupJob {
+	var jobs []BackupJob
+	if len(config.Loaded.Schedule) > 0 {
+		jobs = append(jobs, DefaultBackupJob())
+	}
+
+	for _, job := range config.Loaded.Jobs {
+		if job.IsEnabled() {
+			jobs = append(jobs, NewBackupJob(job))
+		}
+	}
+
+	return jobs
+}
+
+// Target returns where backups of the database are stored inside each storage backend
+func (j BackupJob) Target(database string) storage.Target {
+	target := storage.Target{Retention: j.Retention}
+
+	if j.Name != "" {
+		target.Path = path.Join(j.Name, database)
+	}
+
+	var extensions []string
+	if j.Compress != nil {
+		extensions = append(extensions, j.Compress.Algorithm)
+	}
+	if j.Encrypt != nil {
+		extensions = append(extensions, encryptionExtension(j.Encrypt))
+	}
+	target.Extension = strings.Join(extensions, ".")
+
+	return target
+}
+
+// databases returns the databases to dump, an empty name stands for postgres.database
+func (j BackupJob) databases() []string {
+	if len(j.Databases) == 0 {
+		return []string{""}
+	}
+
+	return j.Databases
+}
+
+// label names the job in events, the default job is called "default"
+func (j BackupJob) label() string {
+	if j.Name == "" {
+		return "default"
+	}
+
+	return j.Name
+}
+
+// databaseLabel names a database in events, an empty name stands for postgres.database.
+// It stays empty when postgres.database is unset and pg_dump connects to the libpq default database.
+func databaseLabel(database string) string {
+	if database == "" {
+		return config.Loaded.Postgres.GetDatabase()
+	}
+
+	return database
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// RotateOptions controls key rotation
+type RotateOptions struct {
+	// DryRun reports backups that would be rewrapped without changing them
+	DryRun bool
+}
+
+// RotateKeys rewraps the data keys of every envelope encrypted backup with the configured master keys.
+// Only the keys sidecars are rewritten, the backups themselves are left untouched. Once every backup is
+// rewrapped, the retired master keys are no longer needed.
+func RotateKeys(ctx context.Context, opts RotateOptions) error {
+	logger := log.Logger.With().Str("caller", "rotate_keys").Logger()
+
+	var settings *config.EnvelopeConfig
+	if config.Loaded.Encrypt != nil {
+		settings = config.Loaded.Encrypt.Envelope
+	}
+	if settings == nil || len(settings.MasterKeyFiles) == 0 {
+		return errors.New("encrypt.envelope.master_key_files is required to rotate keys")
+	}
+
+	masterKeys, err := settings.GetMasterKeys()
+	if err != nil {
+		return err
+	}
+	unwrapKeys, err := settings.GetUnwrapKeys()
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(masterKeys))
+	for _, masterKey := range masterKeys {
+		ids = append(ids, masterKey.ID)
+	}
+	logger.Info().Strs("master_keys", ids).Bool("dry_run", opts.DryRun).Msg("starting key rotation")
+
+	rotation := keyRotation{master: masterKeys, unwrap: unwrapKeys, dryRun: opts.DryRun}
+
+	var errs []error
+	if config.Loaded.Storage.S3 != nil {
+		if err := rotation.rotateS3(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("s3: %w", err))
+		}
+	}
+	if config.Loaded.Storage.Local != nil {
+		if err := rotation.rotateLocal(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("local: %w", err))
+		}
+	}
+
+	event := logger.Info()
+	if len(errs) > 0 {
+		event = logger.Error()
+	}
+	event.
+		Int("rotated_count", rotation.rotated).
+		Int("current_count", rotation.current).
+		Int("failed_count", rotation.failed).
+		Msg("key rotation finished")
+
+	return errors.Join(errs...)
+}
+
+// keyRotation rewraps data keys and counts the outcome for every backup
+type keyRotation struct {
+	master  []config.MasterKey
+	unwrap  []config.MasterKey
+	dryRun  bool
+	rotated int
+	current int
+	failed  int
+}
+
+func (r *keyRotation) rotateS3(ctx context.Context) error {
+	logger := log.Logger.With().Str("caller", "rotate_keys_s3").Logger()
+
+	client, err := s3.CreateClient()
+	if err != nil {
+		return err
+	}
+
+	backups, err := s3.ListBackups(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	// Rewrapping writes a new version of each keys sidecar, the locked versions can't be removed
+	if config.Loaded.Storage.S3.ObjectLock != nil && !r.dryRun {
+		logger.Warn().
+			Str("bucket", config.Loaded.Storage.S3.Bucket).
+			Msg("object lock is enabled, the previous keys sidecars stay readable with the retired keys until their retention ends")
+	}
+
+	var errs []error
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup.Key, "."+ExtensionEnvelope) {
+			continue
+		}
+
+		err := r.rotate(ctx, backup.Key,
+			func() ([]byte, error) {
+				return s3.ReadSidecar(ctx, client, backup.Key, storage.KeysSuffix)
+			},
+			func(data []byte) error {
+				return s3.WriteSidecar(ctx, client, backup.Key, storage.KeysSuffix, data)
+			},
+		)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("key", backup.Key).
+				Str("bucket", config.Loaded.Storage.S3.Bucket).
+				Msg("failed to rewrap data key of S3 backup")
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *keyRotation) rotateLocal(ctx context.Context) error {
+	logger := log.Logger.With().Str("caller", "rotate_keys_local").Logger()
+
+	backups, err := local.ListBackups()
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var errs []error
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup.Name, "."+ExtensionEnvelope) {
+			continue
+		}
+
+		err := r.rotate(ctx, backup.Name,
+			func() ([]byte, error) {
+				return local.ReadSidecar(backup.Path, storage.KeysSuffix)
+			},
+			func(data []byte) error {
+				return local.WriteSidecar(backup.Path, storage.KeysSuffix, data)
+			},
+		)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("path", backup.Path).
+				Msg("failed to rewrap data key of local backup")
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// rotate rewraps the data key of a single backup unless it is already wrapped with exactly the master keys
+func (r *keyRotation) rotate(ctx context.Context, name string, read func() ([]byte, error), write func([]byte) error) error {
+	logger := log.Logger.With().Str("caller", "rotate_keys").Str("backup", name).Logger()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := func() error {
+		data, err := read()
+		if err != nil {
+			return err
+		}
+
+		envelope, err := parseEnvelope(data)
+		if err != nil {
+			return err
+		}
+
+		if envelope.IsWrappedWith(r.master) {
+			logger.Debug().Msg("data key is already wrapped with the master keys")
+			r.current++
+			return nil
+		}
+
+		dataKey, err := envelope.Unwrap(r.unwrap)
+		if err != nil {
+			return err
+		}
+
+		if r.dryRun {
+			logger.Info().Strs("wrapped_with", envelope.MasterKeys()).Msg("would rewrap data key (dry run)")
+			r.rotated++
+			return nil
+		}
+
+		rewrapped, err := newEnvelope(dataKey, r.master)
+		if err != nil {
+			return err
+		}
+
+		data, err = rewrapped.marshal()
+		if err != nil {
+			return err
+		}
+
+		if err := write(data); err != nil {
+			return err
+		}
+
+		logger.Info().
+			Strs("previously_wrapped_with", envelope.MasterKeys()).
+			Strs("wrapped_with", rewrapped.MasterKeys()).
+			Msg("rewrapped data key")
+		r.rotated++
+		return nil
+	}()
+	if err != nil {
+		r.failed++
+	}
+
+	return err
+}
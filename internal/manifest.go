@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+// manifestVersion is the version of the manifest format
+const manifestVersion = 1
+
+// Manifest is stored next to a backup and proves that the backup is the one that was written.
+// It is signed with the manifest signing key, the signature covers every other field.
+type Manifest struct {
+	Version int `json:"version"`
+	// Backup is the name of the backup relative to the storage root, so a manifest can't be moved to another backup
+	Backup      string    `json:"backup"`
+	Job         string    `json:"job,omitempty"`
+	Database    string    `json:"database,omitempty"`
+	Created     time.Time `json:"created"`
+	Compression string    `json:"compression,omitempty"`
+	Encryption  string    `json:"encryption,omitempty"`
+	// Size and SHA256 describe the stored backup, after compression and encryption
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// KeyID identifies the key the manifest is signed with
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// signedPayload returns the bytes the signature covers, the manifest without its signature
+func (m Manifest) signedPayload() ([]byte, error) {
+	m.Signature = nil
+	return json.Marshal(m)
+}
+
+// newManifest describes and signs a backup of the job that was stored under name
+func newManifest(job BackupJob, database, name string, created time.Time, checksum *checksumReader) ([]byte, error) {
+	key, err := config.Loaded.Manifest.GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Version:  manifestVersion,
+		Backup:   name,
+		Job:      job.Name,
+		Database: databaseLabel(database),
+		Created:  created.UTC(),
+		Size:     checksum.Count(),
+		SHA256:   checksum.Sum(),
+		KeyID:    config.ManifestKeyID(key.Public().(ed25519.PublicKey)),
+	}
+	if job.Compress != nil {
+		manifest.Compression = job.Compress.Algorithm
+	}
+	if job.Encrypt != nil {
+		manifest.Encryption = job.Encrypt.GetMethod()
+	}
+
+	payload, err := manifest.signedPayload()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Signature = ed25519.Sign(key, payload)
+
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// parseManifest parses a manifest and checks its signature against the public keys
+func parseManifest(data []byte, keys []ed25519.PublicKey) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+
+	payload, err := manifest.signedPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if config.ManifestKeyID(key) != manifest.KeyID {
+			continue
+		}
+		if !ed25519.Verify(key, payload, manifest.Signature) {
+			return nil, fmt.Errorf("manifest signature by key %s is invalid", manifest.KeyID)
+		}
+		return &manifest, nil
+	}
+
+	return nil, fmt.Errorf("manifest is signed by key %s, which is not in manifest.public_key_files", manifest.KeyID)
+}
+
+// verifyManifest checks the manifest of the backup stored as filename, relative to the storage root, when manifests
+// are checked. The signature is checked upfront, the checksum once the returned reader was read to the end. The end
+// of the backup is held back until then, restore reads the backup to the end this way before pg_restore starts.
+func verifyManifest(ctx context.Context, input io.Reader, filename string, sidecars storage.SidecarReader) (io.Reader, error) {
+	settings := config.Loaded.Manifest
+	if !settings.IsVerifying() {
+		return input, nil
+	}
+
+	data, err := sidecars(ctx, storage.ManifestSuffix)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && settings.IsRequired():
+		return nil, errors.New("backup has no manifest but manifests are required")
+	case errors.Is(err, fs.ErrNotExist):
+		log.Logger.Warn().Str("caller", "manifest_verify").
+			Str("backup", filename).
+			Msg("backup has no manifest, its integrity is not checked")
+		return input, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	keys, err := settings.GetPublicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := parseManifest(data, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names are relative to the storage root, so a backup moved to another job or database doesn't verify
+	if manifest.Backup != filename {
+		return nil, fmt.Errorf("manifest belongs to backup %s, not to %s", manifest.Backup, filename)
+	}
+	job, database := backupOrigin(filename)
+	if manifest.Job != job {
+		return nil, fmt.Errorf("manifest belongs to job %q, not to job %q the backup is stored under", manifest.Job, job)
+	}
+	if database != "" && manifest.Database != database {
+		return nil, fmt.Errorf("manifest belongs to database %q, not to database %q the backup is stored under", manifest.Database, database)
+	}
+
+	checksum := newChecksumReader(input)
+	return &holdbackReader{reader: checksum, check: func() error {
+		if checksum.Count() != manifest.Size {
+			return fmt.Errorf("backup is %d bytes but its manifest says %d bytes", checksum.Count(), manifest.Size)
+		}
+		if checksum.Sum() != manifest.SHA256 {
+			return fmt.Errorf("backup checksum %s doesn't match its manifest checksum %s", checksum.Sum(), manifest.SHA256)
+		}
+		return nil
+	}}, nil
+}
+
+// backupOrigin returns the job and database a backup is stored under from its name relative to the storage root,
+// "<job>/<database>/<timestamp>". Both are empty for backups of the default job in the storage root.
+func backupOrigin(name string) (job, database string) {
+	dir := path.Dir(name)
+	if dir == "." {
+		return "", ""
+	}
+
+	job, database, _ = strings.Cut(dir, "/")
+	return job, database
+}
+
+// checksumReader hashes and counts the bytes read through it
+type checksumReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	count  int64
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	return &checksumReader{reader: reader, hash: sha256.New()}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.count += int64(n)
+	return n, err
+}
+
+// Close closes the underlying reader if it can be closed, so that closing the chain unblocks its writer
+func (r *checksumReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *checksumReader) Count() int64 {
+	return r.count
+}
+
+// Sum returns the SHA-256 of the bytes read so far, hex encoded
+func (r *checksumReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
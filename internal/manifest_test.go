@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+func testSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+// signManifest signs the manifest with key as newManifest does
+func signManifest(t *testing.T, manifest Manifest, key ed25519.PrivateKey) []byte {
+	t.Helper()
+
+	payload, err := manifest.signedPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Signature = ed25519.Sign(key, payload)
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testBackup is the name of the backup testManifest describes, relative to the storage root
+const testBackup = "nightly/app/2025-01-01T00:00:00.zst"
+
+func testManifest(key ed25519.PublicKey, data []byte) Manifest {
+	sum := sha256.Sum256(data)
+	return Manifest{
+		Version:  manifestVersion,
+		Backup:   testBackup,
+		Job:      "nightly",
+		Database: "app",
+		Created:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Size:     int64(len(data)),
+		SHA256:   hex.EncodeToString(sum[:]),
+		KeyID:    config.ManifestKeyID(key),
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	trusted, trustedKey := testSigningKey(t)
+	other, _ := testSigningKey(t)
+	rogue, rogueKey := testSigningKey(t)
+	manifest := testManifest(trusted, []byte("backup"))
+
+	tests := []struct {
+		name    string
+		data    func() []byte
+		wantErr string
+	}{
+		{
+			name: "signed by a trusted key",
+			data: func() []byte {
+				return signManifest(t, manifest, trustedKey)
+			},
+		},
+		{
+			name: "field changed after signing",
+			data: func() []byte {
+				var changed Manifest
+				if err := json.Unmarshal(signManifest(t, manifest, trustedKey), &changed); err != nil {
+					t.Fatal(err)
+				}
+				changed.Size++
+				data, _ := json.Marshal(changed)
+				return data
+			},
+			wantErr: "signature by key " + config.ManifestKeyID(trusted) + " is invalid",
+		},
+		{
+			name: "signed by an untrusted key",
+			data: func() []byte {
+				m := manifest
+				m.KeyID = config.ManifestKeyID(rogue)
+				return signManifest(t, m, rogueKey)
+			},
+			wantErr: "not in manifest.public_key_files",
+		},
+		{
+			name: "untrusted key claiming a trusted key ID",
+			data: func() []byte {
+				return signManifest(t, manifest, rogueKey)
+			},
+			wantErr: "is invalid",
+		},
+		{
+			name: "signature missing",
+			data: func() []byte {
+				data, _ := json.Marshal(manifest)
+				return data
+			},
+			wantErr: "is invalid",
+		},
+		{
+			name: "unsupported version",
+			data: func() []byte {
+				m := manifest
+				m.Version = manifestVersion + 1
+				return signManifest(t, m, trustedKey)
+			},
+			wantErr: "unsupported manifest version",
+		},
+		{
+			name: "not JSON",
+			data: func() []byte {
+				return []byte("not a manifest")
+			},
+			wantErr: "failed to parse manifest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseManifest(tt.data(), []ed25519.PublicKey{other, trusted})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseManifest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseManifest() error = %v", err)
+			}
+			if got.Backup != manifest.Backup || got.SHA256 != manifest.SHA256 || got.Size != manifest.Size {
+				t.Errorf("parseManifest() = %+v, want %+v", got, manifest)
+			}
+		})
+	}
+}
+
+// useManifestKey configures restore to accept manifests signed by key
+func useManifestKey(t *testing.T, key ed25519.PublicKey, require *bool) {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "manifest.pub")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config.Loaded
+	config.Loaded = &config.Config{Manifest: &config.ManifestConfig{PublicKeyFiles: []string{file}, Require: require}}
+	t.Cleanup(func() { config.Loaded = previous })
+}
+
+func TestVerifyManifest(t *testing.T) {
+	public, private := testSigningKey(t)
+	backup := []byte(strings.Repeat("backup data ", 20000))
+	optional := false
+
+	tests := []struct {
+		name     string
+		filename string
+		// manifest is the stored manifest, nil when the backup has none
+		manifest func() []byte
+		require  *bool
+		// wantOpenErr fails verifyManifest itself, wantReadErr reading the backup through it
+		wantOpenErr string
+		wantReadErr string
+	}{
+		{
+			name:     "matching backup",
+			filename: testBackup,
+			manifest: func() []byte { return signManifest(t, testManifest(public, backup), private) },
+		},
+		{
+			name:     "size mismatch",
+			filename: testBackup,
+			manifest: func() []byte {
+				m := testManifest(public, backup)
+				m.Size++
+				return signManifest(t, m, private)
+			},
+			wantReadErr: "its manifest says",
+		},
+		{
+			name:     "checksum mismatch",
+			filename: testBackup,
+			manifest: func() []byte {
+				m := testManifest(public, backup)
+				m.SHA256 = strings.Repeat("0", 64)
+				return signManifest(t, m, private)
+			},
+			wantReadErr: "doesn't match its manifest checksum",
+		},
+		{
+			name:     "default job in the storage root",
+			filename: "2025-01-01T00:00:00.zst",
+			manifest: func() []byte {
+				m := testManifest(public, backup)
+				m.Backup, m.Job, m.Database = "2025-01-01T00:00:00.zst", "", "postgres"
+				return signManifest(t, m, private)
+			},
+		},
+		{
+			name:        "manifest of another backup",
+			filename:    "nightly/app/2025-01-02T00:00:00.zst",
+			manifest:    func() []byte { return signManifest(t, testManifest(public, backup), private) },
+			wantOpenErr: "manifest belongs to backup",
+		},
+		{
+			name:        "backup moved to another database",
+			filename:    "nightly/billing/2025-01-01T00:00:00.zst",
+			manifest:    func() []byte { return signManifest(t, testManifest(public, backup), private) },
+			wantOpenErr: "manifest belongs to backup",
+		},
+		{
+			name:        "backup moved to another job",
+			filename:    "weekly/app/2025-01-01T00:00:00.zst",
+			manifest:    func() []byte { return signManifest(t, testManifest(public, backup), private) },
+			wantOpenErr: "manifest belongs to backup",
+		},
+		{
+			name:     "manifest naming the backup but another job",
+			filename: testBackup,
+			manifest: func() []byte {
+				m := testManifest(public, backup)
+				m.Job = "weekly"
+				return signManifest(t, m, private)
+			},
+			wantOpenErr: `manifest belongs to job "weekly"`,
+		},
+		{
+			name:     "manifest naming the backup but another database",
+			filename: testBackup,
+			manifest: func() []byte {
+				m := testManifest(public, backup)
+				m.Database = "billing"
+				return signManifest(t, m, private)
+			},
+			wantOpenErr: `manifest belongs to database "billing"`,
+		},
+		{
+			name:        "manifest required but missing",
+			filename:    testBackup,
+			wantOpenErr: "backup has no manifest but manifests are required",
+		},
+		{
+			name:     "manifest optional and missing",
+			filename: testBackup,
+			require:  &optional,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useManifestKey(t, public, tt.require)
+
+			sidecars := func(_ context.Context, suffix string) ([]byte, error) {
+				if suffix != storage.ManifestSuffix || tt.manifest == nil {
+					return nil, fmt.Errorf("sidecar %s: %w", suffix, fs.ErrNotExist)
+				}
+				return tt.manifest(), nil
+			}
+
+			reader, err := verifyManifest(context.Background(), bytes.NewReader(backup), tt.filename, sidecars)
+			if tt.wantOpenErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantOpenErr) {
+					t.Errorf("verifyManifest() error = %v, want %q", err, tt.wantOpenErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyManifest() error = %v", err)
+			}
+
+			got, err := io.ReadAll(reader)
+			if tt.wantReadErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantReadErr) {
+					t.Errorf("read error = %v, want %q", err, tt.wantReadErr)
+				}
+				if len(got) > len(backup)-holdback {
+					t.Errorf("read %d bytes of a backup that failed verification, want its end held back", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if !bytes.Equal(got, backup) {
+				t.Error("backup read through verifyManifest differs from the stored backup")
+			}
+		})
+	}
+}
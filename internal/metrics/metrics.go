@@ -0,0 +1,198 @@
+// Package metrics exports Prometheus metrics built from the events published by backups,
+// restores and retention runs.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+)
+
+const namespace = "postgres_backup"
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+var (
+	backupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_runs_total",
+		Help:      "Number of finished backups by job, database and outcome.",
+	}, []string{"job", "database", "outcome"})
+
+	backupLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_success_timestamp_seconds",
+		Help:      "Time the last successful backup of the database finished.",
+	}, []string{"job", "database"})
+
+	backupLastDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_duration_seconds",
+		Help:      "Duration of the last backup of the database, successful or not.",
+	}, []string{"job", "database"})
+
+	backupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backup_duration_seconds",
+		Help:      "Duration of backups.",
+		Buckets:   []float64{10, 30, 60, 300, 600, 1800, 3600, 7200, 14400},
+	}, []string{"job", "database"})
+
+	dumpedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_dumped_bytes_total",
+		Help:      "Bytes written by pg_dump.",
+	}, []string{"job", "database"})
+
+	compressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_compressed_bytes_total",
+		Help:      "Bytes written by the compressor.",
+	}, []string{"job", "database"})
+
+	uploadedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_uploaded_bytes_total",
+		Help:      "Bytes uploaded to a storage backend.",
+	}, []string{"job", "database", "backend"})
+
+	lastUploadSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_upload_size_bytes",
+		Help:      "Size of the last successful upload of the database to a storage backend.",
+	}, []string{"job", "database", "backend"})
+
+	failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failures_total",
+		Help:      "Number of failures by stage: dump, compress, upload or retention.",
+	}, []string{"stage", "database", "backend"})
+
+	storageBackups = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_backups",
+		Help:      "Number of backups held by a storage backend.",
+	}, []string{"backend"})
+
+	storageSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_size_bytes",
+		Help:      "Total size of the backups held by a storage backend.",
+	}, []string{"backend"})
+
+	retentionDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_deleted_backups_total",
+		Help:      "Number of backups removed by retention.",
+	}, []string{"backend"})
+
+	restoreRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "restore_runs_total",
+		Help:      "Number of finished restores by target database and outcome.",
+	}, []string{"database", "outcome"})
+
+	restoreLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "restore_last_success_timestamp_seconds",
+		Help:      "Time the last successful restore into the database finished.",
+	}, []string{"database"})
+
+	restoreLastDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "restore_last_duration_seconds",
+		Help:      "Duration of the last restore into the database, successful or not.",
+	}, []string{"database"})
+)
+
+var (
+	registerOnce sync.Once
+	registry     = prometheus.NewRegistry()
+)
+
+// Register subscribes the exporter to events, it is safe to call more than once
+func Register() {
+	registerOnce.Do(func() {
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+			backupRuns, backupLastSuccess, backupLastDuration, backupDuration,
+			dumpedBytes, compressedBytes, uploadedBytes, lastUploadSize, failures,
+			storageBackups, storageSize, retentionDeleted,
+			restoreRuns, restoreLastSuccess, restoreLastDuration,
+		)
+
+		event.Subscribe(observe)
+	})
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+func observe(e event.Event) {
+	switch e := e.(type) {
+	case event.BackupFinished:
+		observeBackup(e)
+	case event.RestoreFinished:
+		duration := e.Finished.Sub(e.Started).Seconds()
+		restoreLastDuration.WithLabelValues(e.Database).Set(duration)
+
+		if e.Err != nil {
+			restoreRuns.WithLabelValues(e.Database, outcomeFailure).Inc()
+			return
+		}
+
+		restoreRuns.WithLabelValues(e.Database, outcomeSuccess).Inc()
+		restoreLastSuccess.WithLabelValues(e.Database).Set(float64(e.Finished.Unix()))
+	case event.RetentionFinished:
+		retentionDeleted.WithLabelValues(e.Backend).Add(float64(e.Deleted))
+
+		if e.Err != nil {
+			failures.WithLabelValues(string(event.StageRetention), "", e.Backend).Inc()
+		}
+	case event.Inventory:
+		storageBackups.WithLabelValues(e.Backend).Set(float64(e.Count))
+		storageSize.WithLabelValues(e.Backend).Set(float64(e.Size))
+	}
+}
+
+func observeBackup(e event.BackupFinished) {
+	duration := e.Finished.Sub(e.Started).Seconds()
+	backupLastDuration.WithLabelValues(e.Job, e.Database).Set(duration)
+	backupDuration.WithLabelValues(e.Job, e.Database).Observe(duration)
+
+	dumpedBytes.WithLabelValues(e.Job, e.Database).Add(float64(e.DumpedBytes))
+	compressedBytes.WithLabelValues(e.Job, e.Database).Add(float64(e.CompressedBytes))
+
+	for _, upload := range e.Uploads {
+		uploadedBytes.WithLabelValues(e.Job, e.Database, upload.Backend).Add(float64(upload.Bytes))
+
+		if upload.Err != nil {
+			failures.WithLabelValues(string(event.StageUpload), e.Database, upload.Backend).Inc()
+			continue
+		}
+		lastUploadSize.WithLabelValues(e.Job, e.Database, upload.Backend).Set(float64(upload.Bytes))
+	}
+
+	if e.Err != nil {
+		// Upload failures were counted per backend above
+		if e.Stage != event.StageUpload {
+			failures.WithLabelValues(string(e.Stage), e.Database, "").Inc()
+		}
+		backupRuns.WithLabelValues(e.Job, e.Database, outcomeFailure).Inc()
+		return
+	}
+
+	backupRuns.WithLabelValues(e.Job, e.Database, outcomeSuccess).Inc()
+	backupLastSuccess.WithLabelValues(e.Job, e.Database).Set(float64(e.Finished.Unix()))
+}
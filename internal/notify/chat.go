@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// maxErrorExcerpt is how much of an error chat messages show, chat platforms cap the size of a message
+const maxErrorExcerpt = 1000
+
+// fact is a labelled value shown in chat messages
+type fact struct {
+	Name  string
+	Value string
+}
+
+// title summarises the notification in a single line
+func title(n Notification) string {
+	operation := strings.ToUpper(n.Operation[:1]) + n.Operation[1:]
+
+	var summary string
+	switch {
+	case n.Event == config.NotifyOnStale:
+		summary = "Backups are stale"
+	case n.Event == config.NotifyOnFailure:
+		summary = operation + " failed"
+	case n.Operation == OperationRetention:
+		summary = "Retention removed backups"
+	default:
+		summary = operation + " succeeded"
+	}
+
+	if n.Database != "" {
+		summary += ": " + n.Database
+	}
+
+	return summary
+}
+
+// status describes the outcome in a word
+func status(n Notification) string {
+	switch n.Event {
+	case config.NotifyOnFailure:
+		return "failed"
+	case config.NotifyOnStale:
+		return "stale"
+	default:
+		return "succeeded"
+	}
+}
+
+// facts lists the details of the notification that are set
+func facts(n Notification) []fact {
+	facts := []fact{{Name: "Status", Value: status(n)}}
+
+	add := func(name, value string) {
+		if value != "" {
+			facts = append(facts, fact{Name: name, Value: value})
+		}
+	}
+
+	add("Database", n.Database)
+	add("Job", n.Job)
+	add("Backup", n.Backup)
+	add("Backend", n.Backend)
+	if n.Size > 0 {
+		add("Size", formatBytes(n.Size))
+	}
+	if n.Deleted > 0 {
+		add("Deleted", fmt.Sprintf("%d backups", n.Deleted))
+	}
+	if n.Duration > 0 {
+		name := "Duration"
+		if n.Event == config.NotifyOnStale {
+			name = "Age"
+		}
+		add(name, roundDuration(n.Duration).String())
+	}
+	add("Stage", n.Stage)
+
+	return facts
+}
+
+// errorExcerpt returns the end of the error text, where pg_dump and pg_restore put their stderr
+func errorExcerpt(n Notification) string {
+	text := strings.TrimSpace(n.Error)
+	if len(text) <= maxErrorExcerpt {
+		return text
+	}
+
+	text = text[len(text)-maxErrorExcerpt:]
+	// Don't start in the middle of a multi-byte character
+	for len(text) > 0 && !utf8.RuneStart(text[0]) {
+		text = text[1:]
+	}
+
+	return "…" + text
+}
+
+// roundDuration drops the precision nobody reads, keeping milliseconds for very short operations
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+
+	return d.Round(time.Second)
+}
+
+// formatBytes formats a size with a binary unit
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
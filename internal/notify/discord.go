@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+const (
+	discordGreen  = 0x2EB67D
+	discordRed    = 0xE01E5A
+	discordOrange = 0xECB22E
+)
+
+// discord posts embeds to a Discord channel webhook
+type discord struct {
+	config *config.ChatConfig
+	client *http.Client
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (d *discord) Send(ctx context.Context, n Notification) error {
+	embed := discordEmbed{
+		Title:     title(n),
+		Color:     discordGreen,
+		Timestamp: n.Time.UTC().Format(time.RFC3339),
+	}
+
+	switch n.Event {
+	case config.NotifyOnFailure:
+		embed.Color = discordRed
+	case config.NotifyOnStale:
+		embed.Color = discordOrange
+	}
+
+	for _, f := range facts(n) {
+		embed.Fields = append(embed.Fields, discordField{Name: f.Name, Value: f.Value, Inline: true})
+	}
+
+	if excerpt := errorExcerpt(n); excerpt != "" {
+		embed.Description = "```\n" + excerpt + "\n```"
+	}
+
+	return postJSON(ctx, d.client, config.NotifyDiscord, d.config.WebhookURL, discordMessage{Embeds: []discordEmbed{embed}})
+}
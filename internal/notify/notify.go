@@ -0,0 +1,258 @@
+// Package notify tells people when backups, restores and retention runs finish and when backups go stale.
+// Notifications are delivered in the background and retried on their own, so they never fail the operation they report.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+)
+
+const (
+	OperationBackup    = "backup"
+	OperationRestore   = "restore"
+	OperationRetention = "retention"
+)
+
+// flushTimeout bounds how long the process waits for pending notifications before it exits
+const flushTimeout = 30 * time.Second
+
+// Notification describes what happened, its fields are available to body templates
+type Notification struct {
+	// Event is "success", "failure" or "stale"
+	Event string `json:"event"`
+	// Operation is "backup", "restore" or "retention"
+	Operation string `json:"operation"`
+	Job       string `json:"job,omitempty"`
+	Database  string `json:"database,omitempty"`
+	// Backup is the name of the backup that was taken or restored, or the path retention was applied to
+	Backup  string `json:"backup,omitempty"`
+	Backend string `json:"backend,omitempty"`
+	// Size is the size of the backup in bytes
+	Size int64 `json:"size,omitempty"`
+	// Deleted is the number of backups removed by retention
+	Deleted int `json:"deleted,omitempty"`
+	// Duration is how long the operation took, or how old the newest backup of a stale database is
+	Duration time.Duration `json:"-"`
+	// Stage is the step of a backup that failed
+	Stage string    `json:"stage,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// MarshalJSON adds the duration in a readable form and in seconds
+func (n Notification) MarshalJSON() ([]byte, error) {
+	type plain Notification
+
+	payload := struct {
+		plain
+		Duration        string  `json:"duration,omitempty"`
+		DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	}{plain: plain(n)}
+
+	if n.Duration > 0 {
+		payload.Duration = n.Duration.Round(time.Second).String()
+		payload.DurationSeconds = n.Duration.Seconds()
+	}
+
+	return json.Marshal(payload)
+}
+
+// Notifier delivers a single notification
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// target is a configured notifier together with what it is sent and how deliveries are retried
+type target struct {
+	name     string
+	config   config.NotifyConfig
+	policy   config.RetryPolicy
+	notifier Notifier
+}
+
+var (
+	targets []target
+	pending sync.WaitGroup
+)
+
+// Setup creates the configured notifiers and subscribes them to backup, restore and retention events
+func Setup(c *config.Config) error {
+	for i, notifyConfig := range c.Notify {
+		notifier, err := newNotifier(notifyConfig)
+		if err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+
+		targets = append(targets, target{
+			name:     fmt.Sprintf("notify-%s-%d", notifyConfig.Type, i),
+			config:   notifyConfig,
+			policy:   notifyConfig.GetRetryPolicy(),
+			notifier: notifier,
+		})
+	}
+
+	if len(targets) > 0 {
+		event.Subscribe(handle)
+	}
+
+	return nil
+}
+
+func newNotifier(c config.NotifyConfig) (Notifier, error) {
+	switch c.Type {
+	case config.NotifyWebhook:
+		return newWebhook(c.Webhook)
+	case config.NotifySMTP:
+		return newSMTP(c.SMTP)
+	case config.NotifySlack:
+		return &slack{config: c.Chat, client: &http.Client{}}, nil
+	case config.NotifyDiscord:
+		return &discord{config: c.Chat, client: &http.Client{}}, nil
+	case config.NotifyTeams:
+		return &teams{config: c.Chat, client: &http.Client{}}, nil
+	case config.NotifyTelegram:
+		return newTelegram(c.Telegram)
+	default:
+		// Unknown types are rejected when the config is loaded
+		return nil, fmt.Errorf("unknown type '%s'", c.Type)
+	}
+}
+
+func handle(e event.Event) {
+	n, ok := fromEvent(e)
+	if !ok {
+		return
+	}
+
+	for _, t := range targets {
+		if t.config.Notifies(n.Event) {
+			send(t, n)
+		}
+	}
+}
+
+// fromEvent turns an event into a notification, events nobody needs to hear about yield false
+func fromEvent(e event.Event) (Notification, bool) {
+	switch e := e.(type) {
+	case event.BackupFinished:
+		n := Notification{
+			Event:     outcome(e.Err),
+			Operation: OperationBackup,
+			Job:       e.Job,
+			Database:  e.Database,
+			Backup:    e.Backup,
+			Size:      e.CompressedBytes,
+			Duration:  e.Finished.Sub(e.Started),
+			Stage:     string(e.Stage),
+			Time:      e.Finished,
+		}
+		if e.Err != nil {
+			n.Error = e.Err.Error()
+		}
+		return n, true
+	case event.RestoreFinished:
+		n := Notification{
+			Event:     outcome(e.Err),
+			Operation: OperationRestore,
+			Database:  e.Database,
+			Backup:    e.Backup,
+			Size:      e.Bytes,
+			Duration:  e.Finished.Sub(e.Started),
+			Time:      e.Finished,
+		}
+		if e.Err != nil {
+			n.Error = e.Err.Error()
+		}
+		return n, true
+	case event.RetentionFinished:
+		// Retention runs after every upload, only runs that removed something are worth a success notification
+		if e.Err == nil && e.Deleted == 0 {
+			return Notification{}, false
+		}
+
+		n := Notification{
+			Event:     outcome(e.Err),
+			Operation: OperationRetention,
+			Backend:   e.Backend,
+			Backup:    e.Path,
+			Deleted:   e.Deleted,
+			Time:      time.Now(),
+		}
+		if e.Err != nil {
+			n.Error = e.Err.Error()
+		}
+		return n, true
+	default:
+		return Notification{}, false
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return config.NotifyOnFailure
+	}
+
+	return config.NotifyOnSuccess
+}
+
+// send delivers the notification to the target in the background
+func send(t target, n Notification) {
+	pending.Add(1)
+
+	go func() {
+		defer pending.Done()
+
+		logger := log.Logger.With().Str("caller", "notify").Str("notifier", t.name).Logger()
+
+		// Notifications outlive the operation they report, so they don't use its context
+		err := internal.Retry(context.Background(), t.name, t.policy, func(ctx context.Context) error {
+			return t.notifier.Send(ctx, n)
+		})
+		if err != nil {
+			logger.Error().Err(err).
+				Str("event", n.Event).
+				Str("operation", n.Operation).
+				Str("database", n.Database).
+				Msg("failed to deliver notification")
+			return
+		}
+
+		logger.Debug().
+			Str("event", n.Event).
+			Str("operation", n.Operation).
+			Str("database", n.Database).
+			Msg("notification delivered")
+	}()
+}
+
+// Wait waits for notifications that are still being delivered, giving up after a while
+func Wait() {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(flushTimeout):
+		log.Logger.Warn().Str("caller", "notify").Dur("timeout", flushTimeout).Msg("gave up waiting for notifications to be delivered")
+	}
+}
+
+// Exit waits for pending notifications and exits the process with the given status
+func Exit(code int) {
+	Wait()
+	os.Exit(code)
+}
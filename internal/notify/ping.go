@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// maxPingBody is how much of the end of an error the failure ping carries, healthchecks.io keeps the first 10 KB
+const maxPingBody = 10000
+
+var pingClient = &http.Client{}
+
+// PingRun reports a single run of a job to its ping URLs
+type PingRun struct {
+	name    string
+	config  *config.PingConfig
+	started chan struct{}
+}
+
+// StartPing sends the start ping of a job run in the background. It returns nil when the job has no ping
+// settings, which Finish accepts.
+func StartPing(name string, c *config.PingConfig) *PingRun {
+	if c == nil {
+		return nil
+	}
+
+	run := &PingRun{name: name, config: c, started: make(chan struct{})}
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		defer close(run.started)
+
+		run.ping(c.GetStartURL(), "")
+	}()
+
+	return run
+}
+
+// Finish sends the success or failure ping of the run in the background, the failure ping carries the error text.
+// It is sent after the start ping, so a monitor never sees a run finish before it started.
+func (r *PingRun) Finish(err error) {
+	if r == nil {
+		return
+	}
+
+	pingURL, body := r.config.GetSuccessURL(), ""
+	if err != nil {
+		pingURL, body = r.config.GetFailureURL(), err.Error()
+		if len(body) > maxPingBody {
+			body = body[len(body)-maxPingBody:]
+		}
+	}
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		<-r.started
+
+		r.ping(pingURL, body)
+	}()
+}
+
+// ping calls the URL, with a POST carrying the body when there is one
+func (r *PingRun) ping(pingURL, body string) {
+	if pingURL == "" {
+		return
+	}
+
+	logger := log.Logger.With().Str("caller", "ping").Str("job", r.name).Logger()
+
+	method := http.MethodGet
+	if body != "" {
+		method = http.MethodPost
+	}
+
+	name := "ping-" + r.name
+	// Pings outlive the run they report, so they don't use its context
+	err := internal.Retry(context.Background(), name, r.config.GetRetryPolicy(), func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, method, pingURL, strings.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("ping: failed to create request: %w", err)
+		}
+		if body != "" {
+			request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+
+		return do(pingClient, "ping", request)
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to send ping")
+		return
+	}
+
+	logger.Debug().Str("method", method).Msg("ping sent")
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// slack posts Block Kit messages to a Slack incoming webhook
+type slack struct {
+	config *config.ChatConfig
+	client *http.Client
+}
+
+type slackMessage struct {
+	// Text is shown in notifications and by clients that don't render blocks
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (s *slack) Send(ctx context.Context, n Notification) error {
+	summary := title(n)
+
+	var fields []slackText
+	for _, f := range facts(n) {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*" + f.Name + "*\n" + slackEscape(f.Value)})
+	}
+
+	message := slackMessage{
+		Text: summary,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: summary}},
+		},
+	}
+
+	// A section holds at most 10 fields
+	for len(fields) > 0 {
+		count := min(len(fields), 10)
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section", Fields: fields[:count]})
+		fields = fields[count:]
+	}
+
+	if excerpt := errorExcerpt(n); excerpt != "" {
+		message.Blocks = append(message.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "```" + slackEscape(excerpt) + "```"},
+		})
+	}
+
+	return postJSON(ctx, s.client, config.NotifySlack, s.config.WebhookURL, message)
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes the characters Slack treats as control characters in mrkdwn
+func slackEscape(text string) string {
+	return slackEscaper.Replace(text)
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+const defaultSubject = `[postgres-backup] {{ .Operation }} {{ .Event }}{{ with .Database }}: {{ . }}{{ end }}`
+
+const defaultBody = `{{ .Operation }} {{ .Event }}
+{{ with .Job }}
+Job:      {{ . }}{{ end }}{{ with .Database }}
+Database: {{ . }}{{ end }}{{ with .Backup }}
+Backup:   {{ . }}{{ end }}{{ with .Backend }}
+Backend:  {{ . }}{{ end }}{{ if .Size }}
+Size:     {{ .Size }} bytes{{ end }}{{ if .Deleted }}
+Deleted:  {{ .Deleted }} backups{{ end }}{{ if .Duration }}
+Duration: {{ .Duration.Round 1000000 }}{{ end }}{{ with .Stage }}
+Stage:    {{ . }}{{ end }}
+Time:     {{ .Time.Format "2006-01-02 15:04:05 MST" }}
+{{ with .Error }}
+Error:
+{{ . }}
+{{ end }}`
+
+// smtpMailer sends every notification as a plain text email
+type smtpMailer struct {
+	config   *config.SMTPConfig
+	password string
+	subject  *template.Template
+	body     *template.Template
+}
+
+func newSMTP(c *config.SMTPConfig) (*smtpMailer, error) {
+	password, err := c.GetPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &smtpMailer{config: c, password: password}
+
+	subject := defaultSubject
+	if c.Subject != nil {
+		subject = *c.Subject
+	}
+	if m.subject, err = template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return nil, fmt.Errorf("subject: %w", err)
+	}
+
+	body := defaultBody
+	if c.Body != nil {
+		body = *c.Body
+	}
+	if m.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, n Notification) error {
+	message, err := m.message(n)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.config.Username != nil {
+		auth := smtp.PlainAuth("", *m.config.Username, m.password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp: authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(envelopeAddress(m.config.From)); err != nil {
+		return fmt.Errorf("smtp: sender rejected: %w", err)
+	}
+
+	for _, to := range m.config.To {
+		recipient := envelopeAddress(to)
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("smtp: recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: failed to start message: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("smtp: failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("smtp: message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the server, secures the connection as configured and bounds the whole exchange by ctx
+func (m *smtpMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	address := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.GetPort()))
+	tlsConfig := &tls.Config{ServerName: m.config.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+	if m.config.GetTLS() == config.SMTPTLS {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp: failed to connect: %w", err)
+	}
+
+	// net/smtp doesn't take a context, the deadline stops a stuck server instead
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp: failed to greet server: %w", err)
+	}
+
+	if m.config.GetTLS() == config.SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp: %s does not support STARTTLS", m.config.Host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp: STARTTLS failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// message renders the headers and body of the email
+func (m *smtpMailer) message(n Notification) ([]byte, error) {
+	var subject bytes.Buffer
+	if err := m.subject.Execute(&subject, n); err != nil {
+		return nil, fmt.Errorf("smtp: failed to render subject: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := m.body.Execute(&body, n); err != nil {
+		return nil, fmt.Errorf("smtp: failed to render body: %w", err)
+	}
+
+	// A subject spanning several lines would inject headers
+	subjectLine := strings.Join(strings.Fields(subject.String()), " ")
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(m.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subjectLine))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+
+	return message.Bytes(), nil
+}
+
+// envelopeAddress returns the bare address of a "Name <address>" string, addresses are validated on load
+func envelopeAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+
+	return parsed.Address
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/freshness"
+)
+
+// staleCheckInterval is how often the age of the newest backups is checked
+const staleCheckInterval = time.Minute
+
+// WatchesStale reports whether any notifier is sent stale notifications
+func WatchesStale() bool {
+	for _, t := range targets {
+		if t.config.GetStaleAfter(*config.Loaded) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WatchStale checks the backups known to tracker every minute until ctx is done, and notifies once
+// when the newest backup of a database becomes older than a notifier's stale_after.
+// A database is notified again only after it was backed up in between.
+func WatchStale(ctx context.Context, tracker *freshness.Tracker) {
+	// notified holds the databases each target was told about, by target index
+	notified := make([]map[string]bool, len(targets))
+	for i := range notified {
+		notified[i] = make(map[string]bool)
+	}
+
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		now := time.Now()
+		for i, t := range targets {
+			staleAfter := t.config.GetStaleAfter(*config.Loaded)
+			if staleAfter == 0 {
+				continue
+			}
+
+			_, databases := tracker.Check(now, staleAfter)
+			for database, status := range databases {
+				if !status.Stale {
+					delete(notified[i], database)
+					continue
+				}
+				if notified[i][database] {
+					continue
+				}
+
+				n := Notification{
+					Event:     config.NotifyOnStale,
+					Operation: OperationBackup,
+					Database:  database,
+					Time:      now,
+				}
+				if status.LastBackup != nil {
+					n.Duration = now.Sub(*status.LastBackup)
+				}
+
+				send(t, n)
+				notified[i][database] = true
+			}
+		}
+	}
+}
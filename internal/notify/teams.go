@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// teams posts adaptive cards to a Microsoft Teams workflow or incoming webhook
+type teams struct {
+	config *config.ChatConfig
+	client *http.Client
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+}
+
+type teamsElement struct {
+	Type     string      `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	Size     string      `json:"size,omitempty"`
+	Weight   string      `json:"weight,omitempty"`
+	Color    string      `json:"color,omitempty"`
+	FontType string      `json:"fontType,omitempty"`
+	Wrap     bool        `json:"wrap,omitempty"`
+	Facts    []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func (t *teams) Send(ctx context.Context, n Notification) error {
+	color := "Good"
+	switch n.Event {
+	case config.NotifyOnFailure:
+		color = "Attention"
+	case config.NotifyOnStale:
+		color = "Warning"
+	}
+
+	var cardFacts []teamsFact
+	for _, f := range facts(n) {
+		cardFacts = append(cardFacts, teamsFact{Title: f.Name, Value: f.Value})
+	}
+
+	body := []teamsElement{
+		{Type: "TextBlock", Text: title(n), Size: "Large", Weight: "Bolder", Color: color, Wrap: true},
+		{Type: "FactSet", Facts: cardFacts},
+	}
+
+	if excerpt := errorExcerpt(n); excerpt != "" {
+		body = append(body, teamsElement{Type: "TextBlock", Text: excerpt, FontType: "Monospace", Wrap: true})
+	}
+
+	message := teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+			},
+		}},
+	}
+
+	return postJSON(ctx, t.client, config.NotifyTeams, t.config.WebhookURL, message)
+}
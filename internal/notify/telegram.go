@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// telegram sends HTML formatted messages through a Telegram bot
+type telegram struct {
+	config *config.TelegramConfig
+	token  string
+	client *http.Client
+}
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+func newTelegram(c *config.TelegramConfig) (*telegram, error) {
+	token, err := c.GetBotToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &telegram{config: c, token: token, client: &http.Client{}}, nil
+}
+
+func (t *telegram) Send(ctx context.Context, n Notification) error {
+	var text strings.Builder
+	text.WriteString("<b>" + html.EscapeString(title(n)) + "</b>\n")
+
+	for _, f := range facts(n) {
+		text.WriteString("\n<b>" + html.EscapeString(f.Name) + ":</b> " + html.EscapeString(f.Value))
+	}
+
+	if excerpt := errorExcerpt(n); excerpt != "" {
+		text.WriteString("\n\n<pre>" + html.EscapeString(excerpt) + "</pre>")
+	}
+
+	message := telegramMessage{
+		ChatID:                t.config.ChatID,
+		Text:                  text.String(),
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}
+
+	err := postJSON(ctx, t.client, config.NotifyTelegram, t.config.GetAPIURL()+"/bot"+t.token+"/sendMessage", message)
+	if err != nil {
+		// The token is part of the URL, which request errors include
+		return errors.New(strings.ReplaceAll(err.Error(), t.token, "<redacted>"))
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// maxResponseBody is how much of an error response is kept for the log
+const maxResponseBody = 1024
+
+// templateFuncs are available in body templates, json quotes a value so it can be embedded in a JSON payload
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// webhook sends every notification as an HTTP request
+type webhook struct {
+	config *config.WebhookConfig
+	// body renders the request body, it is nil when the notification is sent as JSON
+	body   *template.Template
+	client *http.Client
+}
+
+func newWebhook(c *config.WebhookConfig) (*webhook, error) {
+	w := &webhook{config: c, client: &http.Client{}}
+
+	if c.Body != nil {
+		body, err := template.New("body").Funcs(templateFuncs).Parse(*c.Body)
+		if err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+		w.body = body
+	}
+
+	return w, nil
+}
+
+func (w *webhook) Send(ctx context.Context, n Notification) error {
+	var body bytes.Buffer
+	if w.body != nil {
+		if err := w.body.Execute(&body, n); err != nil {
+			return fmt.Errorf("webhook: failed to render body: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(n); err != nil {
+		return fmt.Errorf("webhook: failed to encode notification: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, w.config.GetMethod(), w.config.URL, &body)
+	if err != nil {
+		return fmt.Errorf("webhook: failed to create request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range w.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	return do(w.client, config.NotifyWebhook, request)
+}
+
+// postJSON sends payload as JSON to url
+func postJSON(ctx context.Context, client *http.Client, name, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode message: %w", name, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: failed to create request: %w", name, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	return do(client, name, request)
+}
+
+// do sends the request and turns responses other than 2xx into an error, name prefixes the error
+func do(client *http.Client, name string, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s: request failed: %w", name, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseBody))
+		return fmt.Errorf("%s: unexpected status %s: %s", name, response.Status, bytes.TrimSpace(excerpt))
+	}
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
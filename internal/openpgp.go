@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+func encryptOpenPGP(input io.Reader, settings *config.OpenPGPConfig) (io.ReadCloser, error) {
+	recipients, err := settings.GetRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := settings.GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptStream(input, func(w io.Writer) (io.WriteCloser, error) {
+		return openpgp.Encrypt(w, recipients, signer, &openpgp.FileHints{IsBinary: true}, nil)
+	}), nil
+}
+
+// decryptOpenPGP decrypts the input stream and verifies its signature once it was read to the end.
+// Unsigned backups and backups signed by unknown keys are refused upfront when a signature is required.
+func decryptOpenPGP(input io.Reader, settings *config.OpenPGPConfig) (io.Reader, error) {
+	keys, err := settings.GetDecryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := openpgp.ReadMessage(input, keys, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	required := settings.IsSignatureRequired()
+
+	switch {
+	case !message.IsSigned && required:
+		return nil, errors.New("backup is not signed but encrypt.openpgp.require_signature is set")
+	case !message.IsSigned:
+		return message.UnverifiedBody, nil
+	case message.SignedBy == nil && required:
+		return nil, fmt.Errorf("backup is signed by unknown key %X", message.SignedByKeyId)
+	case message.SignedBy == nil:
+		log.Logger.Warn().Str("caller", "openpgp_decrypt").
+			Str("key_id", fmt.Sprintf("%X", message.SignedByKeyId)).
+			Msg("backup is signed by a key that is not in verify_key_files, the signature is not checked")
+		return message.UnverifiedBody, nil
+	}
+
+	// The signature is checked by the read that reaches the end of the message
+	return &holdbackReader{reader: message.UnverifiedBody, check: func() error {
+		if message.SignatureError != nil {
+			return fmt.Errorf("backup signature verification failed: %w", message.SignatureError)
+		}
+		return nil
+	}}, nil
+}
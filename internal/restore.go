@@ -8,16 +8,17 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/rs/zerolog/log"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
 	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
 )
@@ -168,9 +169,27 @@ func NewRestore(ctx context.Context, targetDatabase string) (*RestoreProcess, er
 	return process, nil
 }
 
-// Restore performs a complete restore operation from a backup reader to the target database
-func Restore(backupReader io.Reader, targetDatabase, backupFilename string) error {
-	ctx := context.Background()
+// Restore performs a complete restore operation from a backup reader to the target database.
+// sidecars reads the sidecars stored next to the backup. Cancelling ctx stops pg_restore.
+func Restore(ctx context.Context, backupReader io.Reader, targetDatabase, backupFilename string, sidecars storage.SidecarReader) error {
+	result := event.RestoreFinished{
+		Database: targetDatabase,
+		Backup:   backupFilename,
+		Started:  time.Now(),
+	}
+
+	counted := &countingReader{reader: backupReader}
+	err := restore(ctx, counted, targetDatabase, backupFilename, sidecars)
+
+	result.Finished = time.Now()
+	result.Bytes = counted.Count()
+	result.Err = err
+	event.Publish(result)
+
+	return err
+}
+
+func restore(ctx context.Context, backupReader io.Reader, targetDatabase, backupFilename string, sidecars storage.SidecarReader) error {
 	logger := log.Logger.With().
 		Str("caller", "restore").
 		Str("target_database", targetDatabase).
@@ -179,10 +198,13 @@ func Restore(backupReader io.Reader, targetDatabase, backupFilename string) erro
 
 	logger.Debug().Msg("starting restore operation")
 
-	// Apply decompression if needed
-	decompressedReader, err := Decompress(backupReader, backupFilename)
+	// Apply decryption and decompression if needed
+	decompressedReader, spooled, err := openForRestore(ctx, backupReader, backupFilename, sidecars)
 	if err != nil {
-		return fmt.Errorf("failed to decompress backup: %w", err)
+		return err
+	}
+	if spooled != nil {
+		defer spooled.Close()
 	}
 
 	// Create pg_restore process
@@ -229,8 +251,47 @@ func Restore(backupReader io.Reader, targetDatabase, backupFilename string) erro
 	return nil
 }
 
+// openForRestore opens the backup for pg_restore. When manifests are checked, pg_restore must not drop the database
+// before the whole backup is known to be intact: the backup is spooled to a temporary file and its manifest,
+// signature and checksums are checked first, so what is restored is exactly what was checked.
+// Otherwise the backup is streamed straight into pg_restore. The returned spool file is nil when nothing was spooled.
+func openForRestore(ctx context.Context, backupReader io.Reader, backupFilename string, sidecars storage.SidecarReader) (io.Reader, *spoolFile, error) {
+	if !config.Loaded.Manifest.IsVerifying() {
+		reader, err := Open(ctx, backupReader, backupFilename, sidecars)
+		return reader, nil, err
+	}
+
+	spooled, err := spool(backupReader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archiveSize, err := verifyArchive(ctx, spooled, backupFilename, sidecars)
+	if err != nil {
+		spooled.Close()
+		return nil, nil, fmt.Errorf("backup failed verification, the database was not touched: %w", err)
+	}
+	if err := spooled.Rewind(); err != nil {
+		spooled.Close()
+		return nil, nil, err
+	}
+
+	log.Logger.Debug().Str("caller", "restore").
+		Str("backup_filename", backupFilename).
+		Int64("archive_size", archiveSize).
+		Msg("backup verified, starting pg_restore")
+
+	reader, err := Open(ctx, spooled, backupFilename, sidecars)
+	if err != nil {
+		spooled.Close()
+		return nil, nil, err
+	}
+	return reader, spooled, nil
+}
+
 // BackupEntry represents a backup available for restore
 type BackupEntry struct {
+	// Name is relative to the storage root, the prefix or directory of the backend
 	Name      string
 	Key       string
 	Source    string // "s3" or "local"
@@ -270,7 +331,7 @@ func ScheduledRestore(ctx context.Context, scheduleConfig config.RestoreSchedule
 
 // findBackupForRestore finds the appropriate backup based on the schedule configuration
 func findBackupForRestore(ctx context.Context, scheduleConfig config.RestoreScheduleConfig) (*BackupEntry, error) {
-	backups, err := getAllBackupsForSchedule(ctx, scheduleConfig.ShouldIncludeS3(), scheduleConfig.ShouldIncludeLocal())
+	backups, err := getAllBackupsForSchedule(ctx, scheduleConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -291,32 +352,33 @@ func findBackupForRestore(ctx context.Context, scheduleConfig config.RestoreSche
 	}
 }
 
-// getAllBackupsForSchedule retrieves all available backups from configured sources
-func getAllBackupsForSchedule(ctx context.Context, includeS3, includeLocal bool) ([]BackupEntry, error) {
+// getAllBackupsForSchedule retrieves the backups of the schedule's job and database from its storage sources, newest first
+func getAllBackupsForSchedule(ctx context.Context, scheduleConfig config.RestoreScheduleConfig) ([]BackupEntry, error) {
 	var allBackups []BackupEntry
 
+	job := DefaultBackupJob()
+	if jobConfig := scheduleConfig.GetJob(*config.Loaded); jobConfig != nil {
+		job = NewBackupJob(*jobConfig)
+	}
+	target := job.Target(scheduleConfig.GetDatabase(*config.Loaded))
+
 	// Get S3 backups if enabled
-	if includeS3 && config.Loaded.Storage.S3 != nil {
+	if scheduleConfig.ShouldIncludeS3() && job.S3 {
 		// Create S3 client
-		client, err := minio.New(config.Loaded.Storage.S3.Endpoint, &minio.Options{
-			Creds:  credentials.NewStaticV4(config.Loaded.Storage.S3.AccessKey, config.Loaded.Storage.S3.SecretKey, ""),
-			Region: config.Loaded.Storage.S3.GetRegion(),
-			Secure: true,
-		})
+		client, err := s3.CreateClient()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create S3 client: %w", err)
 		}
 
-		s3Backups, err := s3.ListBackups(ctx, client)
+		s3Backups, err := s3.ListTargetBackups(ctx, client, target)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list S3 backups: %w", err)
 		}
 
 		for _, backup := range s3Backups {
-			// Parse timestamp from backup name (assuming format contains timestamp)
-			timestamp, _ := parseTimestampFromBackupName(backup.Key)
+			timestamp, _ := parseTimestampFromBackupName(backup.Name)
 			allBackups = append(allBackups, BackupEntry{
-				Name:      backup.Key,
+				Name:      backup.Name,
 				Key:       backup.Key,
 				Source:    "s3",
 				Timestamp: timestamp,
@@ -325,23 +387,16 @@ func getAllBackupsForSchedule(ctx context.Context, includeS3, includeLocal bool)
 	}
 
 	// Get local backups if enabled
-	if includeLocal && config.Loaded.Storage.Local != nil {
-		localBackups, err := local.ListBackups()
+	if scheduleConfig.ShouldIncludeLocal() && job.Local {
+		localBackups, err := local.ListTargetBackups(target)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list local backups: %w", err)
 		}
 
 		for _, backup := range localBackups {
-			// Parse timestamp from backup path - extract filename from full path
-			filename := backup.Path
-			if idx := strings.LastIndex(backup.Path, "\\"); idx >= 0 {
-				filename = backup.Path[idx+1:]
-			} else if idx := strings.LastIndex(backup.Path, "/"); idx >= 0 {
-				filename = backup.Path[idx+1:]
-			}
-			timestamp, _ := parseTimestampFromBackupName(filename)
+			timestamp, _ := parseTimestampFromBackupName(backup.Name)
 			allBackups = append(allBackups, BackupEntry{
-				Name:      filename,
+				Name:      backup.Name,
 				Key:       backup.Path,
 				Source:    "local",
 				Timestamp: timestamp,
@@ -350,7 +405,7 @@ func getAllBackupsForSchedule(ctx context.Context, includeS3, includeLocal bool)
 	}
 
 	// Sort by timestamp (newest first)
-	sort.Slice(allBackups, func(i, j int) bool {
+	sort.SliceStable(allBackups, func(i, j int) bool {
 		return allBackups[i].Timestamp.After(allBackups[j].Timestamp)
 	})
 
@@ -377,36 +432,15 @@ func findBackupBySpecificID(backups []BackupEntry, backupID string) (*BackupEntr
 	return nil, nil
 }
 
-// parseTimestampFromBackupName attempts to parse timestamp from backup filename
-func parseTimestampFromBackupName(filename string) (time.Time, error) {
-	// Try common timestamp formats in backup filenames
-	formats := []string{
-		"2006-01-02_15-04-05",
-		"20060102_150405",
-		"2006-01-02T15:04:05",
-		"20060102T150405",
-	}
-
-	for _, format := range formats {
-		if timestamp, err := time.Parse(format, extractTimestampFromFilename(filename, format)); err == nil {
-			return timestamp, nil
-		}
+// parseTimestampFromBackupName parses the time a backup was taken from its name, such as
+// "job/database/2006-01-02T15:04:05.zstd". Backups are named after the local time they were taken at.
+func parseTimestampFromBackupName(name string) (time.Time, error) {
+	base := path.Base(name)
+	if !storage.IsBackupName(base) {
+		return time.Time{}, fmt.Errorf("could not parse timestamp from backup name: %s", name)
 	}
 
-	// If no timestamp found, return zero time
-	return time.Time{}, fmt.Errorf("could not parse timestamp from filename: %s", filename)
-}
-
-// extractTimestampFromFilename extracts timestamp portion from filename
-func extractTimestampFromFilename(filename, _ string) string {
-	// Simple extraction - look for timestamp-like patterns
-	// This is a basic implementation and might need refinement
-	parts := strings.Split(filename, "_")
-	if len(parts) >= 2 {
-		// Try to combine date and time parts
-		return parts[len(parts)-2] + "_" + strings.Split(parts[len(parts)-1], ".")[0]
-	}
-	return filename
+	return time.ParseInLocation(storage.BackupTimeFormat, base[:len(storage.BackupTimeFormat)], time.Local)
 }
 
 // performScheduledRestore performs the actual restore operation for scheduled restore
@@ -421,6 +455,7 @@ func performScheduledRestore(ctx context.Context, backup *BackupEntry, targetDat
 	logger.Info().Msg("starting scheduled restore operation")
 
 	var backupReader io.ReadCloser
+	var sidecars storage.SidecarReader
 	var err error
 
 	// Get backup data based on source
@@ -430,11 +465,13 @@ func performScheduledRestore(ctx context.Context, backup *BackupEntry, targetDat
 		if err != nil {
 			return fmt.Errorf("failed to download S3 backup: %w", err)
 		}
+		sidecars = s3.SidecarReader(backup.Key)
 	case "local":
 		backupReader, err = local.OpenBackup(backup.Key)
 		if err != nil {
 			return fmt.Errorf("failed to open local backup: %w", err)
 		}
+		sidecars = local.SidecarReader(backup.Key)
 	default:
 		return fmt.Errorf("unsupported backup source: %s", backup.Source)
 	}
@@ -443,7 +480,7 @@ func performScheduledRestore(ctx context.Context, backup *BackupEntry, targetDat
 	logger.Info().Msg("backup data retrieved, starting restore process")
 
 	// Perform the restore
-	err = Restore(backupReader, targetDatabase, backup.Name)
+	err = Restore(ctx, backupReader, targetDatabase, backup.Name, sidecars)
 	if err != nil {
 		return fmt.Errorf("restore process failed: %w", err)
 	}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestampFromBackupName(t *testing.T) {
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		backup  string
+		wantErr bool
+	}{
+		{name: "default job", backup: "2025-01-02T03:04:05"},
+		{name: "compressed and encrypted", backup: "2025-01-02T03:04:05.zstd.age"},
+		{name: "job and database prefix", backup: "nightly/app/2025-01-02T03:04:05.gzip"},
+		{name: "S3 key with a prefix", backup: "backups/nightly/app/2025-01-02T03:04:05.zstd"},
+		{name: "sidecar", backup: "2025-01-02T03:04:05.zstd.manifest.json", wantErr: true},
+		{name: "other file", backup: "nightly/app/README", wantErr: true},
+		{name: "invalid date", backup: "2025-13-02T03:04:05.zstd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimestampFromBackupName(tt.backup)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTimestampFromBackupName() = %v, want an error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseTimestampFromBackupName() error = %v", err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("parseTimestampFromBackupName() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// CleanupRetention applies the retention policy of every backup job to each of its storage backends
+func CleanupRetention(ctx context.Context) error {
+	logger := log.Logger.With().Str("caller", "retention_cleanup").Logger()
+
+	var errs []error
+	cleaned, failed := 0, 0
+
+	for _, job := range BackupJobs() {
+		for _, database := range job.databases() {
+			target := job.Target(database)
+
+			if job.S3 {
+				if err := s3.CleanupRetention(ctx, target); err != nil {
+					logger.Error().Err(err).
+						Str("bucket", config.Loaded.Storage.S3.Bucket).
+						Str("path", target.Path).
+						Msg("S3 retention cleanup failed")
+					errs = append(errs, fmt.Errorf("s3 %s: %w", target.Path, err))
+					failed++
+				} else {
+					cleaned++
+				}
+			}
+
+			if job.Local {
+				if err := local.CleanupRetention(ctx, target); err != nil {
+					logger.Error().Err(err).
+						Str("directory", config.Loaded.Storage.Local.Directory).
+						Str("path", target.Path).
+						Msg("local retention cleanup failed")
+					errs = append(errs, fmt.Errorf("local %s: %w", target.Path, err))
+					failed++
+				} else {
+					cleaned++
+				}
+			}
+		}
+	}
+
+	publishInventory(ctx, config.Loaded.Storage.S3 != nil, config.Loaded.Storage.Local != nil)
+
+	logger.Info().
+		Int("successful_targets", cleaned).
+		Int("failed_targets", failed).
+		Msg("retention cleanup operation finished")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// maxRetryBackoff caps the exponentially growing delay between attempts
+const maxRetryBackoff = 30 * time.Minute
+
+// Retry runs fn until it succeeds or the policy's retries are exhausted.
+// Every attempt gets its own timeout; a cancelled ctx stops retrying immediately.
+func Retry(ctx context.Context, name string, policy config.RetryPolicy, fn func(ctx context.Context) error) error {
+	logger := log.Logger.With().Str("caller", "retry").Str("job", name).Logger()
+
+	attempts := policy.Retries + 1
+	backoff := policy.Backoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		attemptCtx, cancel := attemptContext(ctx, policy.Timeout)
+
+		if attempts > 1 {
+			logger.Info().
+				Int("attempt", attempt).
+				Int("max_attempts", attempts).
+				Msg("starting attempt")
+		}
+
+		started := time.Now()
+		err = fn(attemptCtx)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+
+		if err == nil {
+			if attempt > 1 {
+				logger.Info().
+					Int("attempt", attempt).
+					Dur("duration", time.Since(started)).
+					Msg("attempt succeeded after retry")
+			}
+			return nil
+		}
+
+		if timedOut {
+			err = fmt.Errorf("attempt timed out after %s: %w", policy.Timeout, err)
+		}
+
+		// The caller gave up, retrying would only fail again
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		logger.Warn().Err(err).
+			Int("attempt", attempt).
+			Int("max_attempts", attempts).
+			Dur("duration", time.Since(started)).
+			Bool("timed_out", timedOut).
+			Msg("attempt failed")
+
+		logger.Info().
+			Dur("backoff", backoff).
+			Int("next_attempt", attempt+1).
+			Msg("waiting before retry")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+
+	if attempts > 1 {
+		return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+	}
+	return err
+}
+
+// attemptContext derives the context of a single attempt, bounded by timeout when it is set
+func attemptContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
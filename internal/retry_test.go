@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+func TestRetry(t *testing.T) {
+	errAttempt := errors.New("attempt failed")
+
+	tests := []struct {
+		name   string
+		policy config.RetryPolicy
+		// failures is the number of attempts that fail before one succeeds
+		failures     int
+		wantAttempts int
+		wantErr      string
+	}{
+		{
+			name:         "first attempt succeeds",
+			policy:       config.RetryPolicy{Retries: 2, Backoff: time.Millisecond},
+			failures:     0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after retries",
+			policy:       config.RetryPolicy{Retries: 2, Backoff: time.Millisecond},
+			failures:     2,
+			wantAttempts: 3,
+		},
+		{
+			name:         "no retries",
+			policy:       config.RetryPolicy{},
+			failures:     1,
+			wantAttempts: 1,
+			wantErr:      "attempt failed",
+		},
+		{
+			name:         "retries exhausted",
+			policy:       config.RetryPolicy{Retries: 2, Backoff: time.Millisecond},
+			failures:     5,
+			wantAttempts: 3,
+			wantErr:      "failed after 3 attempts: attempt failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Retry(context.Background(), "test", tt.policy, func(context.Context) error {
+				attempts++
+				if attempts <= tt.failures {
+					return errAttempt
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Retry() error = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("Retry() error = %v, want %q", err, tt.wantErr)
+			case tt.wantErr != "" && !errors.Is(err, errAttempt):
+				t.Errorf("Retry() error = %v, does not wrap the attempt error", err)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+
+	var starts []time.Time
+	_ = Retry(context.Background(), "test", config.RetryPolicy{Retries: 3, Backoff: backoff}, func(context.Context) error {
+		starts = append(starts, time.Now())
+		return errors.New("attempt failed")
+	})
+
+	if len(starts) != 4 {
+		t.Fatalf("attempts = %d, want 4", len(starts))
+	}
+
+	// Each delay doubles the previous one
+	for i, want := range []time.Duration{backoff, 2 * backoff, 4 * backoff} {
+		if got := starts[i+1].Sub(starts[i]); got < want {
+			t.Errorf("delay before attempt %d = %s, want at least %s", i+2, got, want)
+		}
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	policy := config.RetryPolicy{Timeout: 10 * time.Millisecond, Retries: 1, Backoff: time.Millisecond}
+
+	attempts := 0
+	err := Retry(context.Background(), "test", policy, func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2, a timed out attempt is retried", attempts)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "attempt timed out after 10ms") {
+		t.Errorf("Retry() error = %v, want a timed out attempt", err)
+	}
+}
+
+func TestRetryCancellation(t *testing.T) {
+	tests := []struct {
+		name string
+		// duringAttempt cancels from within the first attempt, otherwise ctx is cancelled while waiting for the retry
+		duringAttempt bool
+		backoff       time.Duration
+	}{
+		{
+			name:          "cancelled during an attempt",
+			duringAttempt: true,
+			backoff:       time.Millisecond,
+		},
+		{
+			name:    "cancelled during the backoff",
+			backoff: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if !tt.duringAttempt {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+
+			attempts := 0
+			started := time.Now()
+			err := Retry(ctx, "test", config.RetryPolicy{Retries: 5, Backoff: tt.backoff}, func(context.Context) error {
+				attempts++
+				if tt.duringAttempt {
+					cancel()
+				}
+				return errors.New("attempt failed")
+			})
+
+			if attempts != 1 {
+				t.Errorf("attempts = %d, want 1", attempts)
+			}
+			if err == nil {
+				t.Error("Retry() error = nil, want the error of the last attempt")
+			}
+			if elapsed := time.Since(started); elapsed > time.Second {
+				t.Errorf("Retry() returned after %s, want it to stop right away", elapsed)
+			}
+		})
+	}
+}
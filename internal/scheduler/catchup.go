@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// CatchUp starts one run of every job that missed a scheduled run while the scheduler was down,
+// or whose last run was cut off by it stopping. Only runs missed within window are caught up, and jobs
+// without a recorded run are left alone since there is nothing to tell whether they missed anything.
+func (s *Scheduler) CatchUp(window time.Duration) int {
+	if s.state == nil {
+		return 0
+	}
+
+	now := time.Now()
+	started := 0
+
+	for _, e := range s.entries {
+		last, ok := s.state.Get(e.job.Name)
+		if !ok {
+			s.logger.Debug().
+				Str("job", e.job.Name).
+				Msg("no recorded run, skipping catch-up")
+			continue
+		}
+
+		missed, first := missedSlot(e.schedule, last, now, window)
+		if first.IsZero() || first.After(now) {
+			continue
+		}
+
+		if missed.IsZero() {
+			s.logger.Info().
+				Str("job", e.job.Name).
+				Time("missed_run", first).
+				Time("last_run", last.LastRun).
+				Dur("catch_up_window", window).
+				Msg("missed runs are outside the catch-up window, not catching up")
+			continue
+		}
+
+		s.logger.Info().
+			Str("job", e.job.Name).
+			Str("type", e.job.Type).
+			Time("missed_run", missed).
+			Time("last_run", last.LastRun).
+			Str("last_outcome", last.Outcome).
+			Msg("starting catch-up run for missed schedule")
+
+		s.detached.Add(1)
+		go func() {
+			defer s.detached.Done()
+			e.run(s.ctx, missed)
+		}()
+		started++
+	}
+
+	return started
+}
+
+// missedSlot returns the most recent slot of schedule within window that was not handled according
+// to last, and the first slot that was not. A run that was still running when the scheduler stopped
+// did not finish, so its own slot counts as missed.
+func missedSlot(schedule cron.Schedule, last JobState, now time.Time, window time.Duration) (time.Time, time.Time) {
+	from := last.LastRun
+	if last.Outcome == OutcomeRunning {
+		// Schedules have a resolution of a second, so this is the latest time before the slot itself
+		from = from.Add(-time.Second)
+	}
+
+	first := schedule.Next(from)
+	if first.IsZero() || first.After(now) {
+		return time.Time{}, first
+	}
+
+	// Find the most recent fire time within the window, starting no earlier than the window itself
+	if cutoff := now.Add(-window); cutoff.After(from) {
+		from = cutoff
+	}
+
+	var missed time.Time
+	for next := schedule.Next(from); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		missed = next
+	}
+
+	return missed, first
+}
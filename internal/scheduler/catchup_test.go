@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestMissedSlot(t *testing.T) {
+	hourly, err := cron.ParseStandard("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		last       JobState
+		window     time.Duration
+		wantMissed time.Time
+		wantFirst  time.Time
+	}{
+		{
+			name:       "nothing missed",
+			last:       JobState{LastRun: at(12, 0), Outcome: OutcomeSuccess},
+			window:     24 * time.Hour,
+			wantMissed: time.Time{},
+			wantFirst:  at(13, 0),
+		},
+		{
+			name:       "one slot missed",
+			last:       JobState{LastRun: at(11, 0), Outcome: OutcomeSuccess},
+			window:     24 * time.Hour,
+			wantMissed: at(12, 0),
+			wantFirst:  at(12, 0),
+		},
+		{
+			name:       "several slots missed, the latest is caught up",
+			last:       JobState{LastRun: at(8, 0), Outcome: OutcomeFailure},
+			window:     24 * time.Hour,
+			wantMissed: at(12, 0),
+			wantFirst:  at(9, 0),
+		},
+		{
+			name:       "missed slots outside the window",
+			last:       JobState{LastRun: at(8, 0), Outcome: OutcomeSuccess},
+			window:     20 * time.Minute,
+			wantMissed: time.Time{},
+			wantFirst:  at(9, 0),
+		},
+		{
+			name:       "window covers only the latest slot",
+			last:       JobState{LastRun: at(8, 0), Outcome: OutcomeSuccess},
+			window:     time.Hour,
+			wantMissed: at(12, 0),
+			wantFirst:  at(9, 0),
+		},
+		{
+			name:       "run cut off by a restart",
+			last:       JobState{LastRun: at(12, 0), Outcome: OutcomeRunning},
+			window:     24 * time.Hour,
+			wantMissed: at(12, 0),
+			wantFirst:  at(12, 0),
+		},
+		{
+			name:       "run cut off by a restart outside the window",
+			last:       JobState{LastRun: at(12, 0), Outcome: OutcomeRunning},
+			window:     10 * time.Minute,
+			wantMissed: time.Time{},
+			wantFirst:  at(12, 0),
+		},
+		{
+			name:       "skipped slot is handled",
+			last:       JobState{LastRun: at(12, 0), Outcome: OutcomeSkipped},
+			window:     24 * time.Hour,
+			wantMissed: time.Time{},
+			wantFirst:  at(13, 0),
+		},
+		{
+			name:       "cancelled run is handled",
+			last:       JobState{LastRun: at(12, 0), Outcome: OutcomeCancelled},
+			window:     24 * time.Hour,
+			wantMissed: time.Time{},
+			wantFirst:  at(13, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, first := missedSlot(hourly, tt.last, now, tt.window)
+			if !missed.Equal(tt.wantMissed) {
+				t.Errorf("missed = %s, want %s", missed, tt.wantMissed)
+			}
+			if !first.Equal(tt.wantFirst) {
+				t.Errorf("first = %s, want %s", first, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestStateRecord(t *testing.T) {
+	slot1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	slot2 := slot1.Add(time.Hour)
+	finished := slot1.Add(90 * time.Minute)
+
+	tests := []struct {
+		name    string
+		records []JobState
+		want    JobState
+	}{
+		{
+			name: "run started",
+			records: []JobState{
+				{LastRun: slot1, Outcome: OutcomeRunning},
+			},
+			want: JobState{LastRun: slot1, Outcome: OutcomeRunning},
+		},
+		{
+			name: "run finished",
+			records: []JobState{
+				{LastRun: slot1, Outcome: OutcomeRunning},
+				{LastRun: slot1, LastFinished: finished, Outcome: OutcomeSuccess},
+			},
+			want: JobState{LastRun: slot1, LastFinished: finished, Outcome: OutcomeSuccess},
+		},
+		{
+			name: "slot skipped while a run is in progress",
+			records: []JobState{
+				{LastRun: slot1, Outcome: OutcomeRunning},
+				{LastRun: slot2, Outcome: OutcomeSkipped, Reason: "previous run was still in progress"},
+			},
+			want: JobState{LastRun: slot2, Outcome: OutcomeRunning},
+		},
+		{
+			name: "run finished after a slot was skipped",
+			records: []JobState{
+				{LastRun: slot1, Outcome: OutcomeRunning},
+				{LastRun: slot2, Outcome: OutcomeSkipped, Reason: "previous run was still in progress"},
+				{LastRun: slot1, LastFinished: finished, Outcome: OutcomeFailure, Error: "failed"},
+			},
+			want: JobState{LastRun: slot2, LastFinished: finished, Outcome: OutcomeFailure, Error: "failed"},
+		},
+		{
+			name: "slot left to another replica",
+			records: []JobState{
+				{LastRun: slot1, LastFinished: finished, Outcome: OutcomeSuccess},
+				{LastRun: slot2, Outcome: OutcomeSkipped, Reason: "leader lock was held by replica-1"},
+			},
+			want: JobState{LastRun: slot2, Outcome: OutcomeSkipped, Reason: "leader lock was held by replica-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			state, err := LoadState(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, record := range tt.records {
+				if err := state.Record("job", record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Read back from the file, so that what is persisted is checked
+			loaded, err := LoadState(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := loaded.Get("job")
+			if !ok {
+				t.Fatal("state has no record of the job")
+			}
+			if !got.LastRun.Equal(tt.want.LastRun) || !got.LastFinished.Equal(tt.want.LastFinished) ||
+				got.Outcome != tt.want.Outcome || got.Error != tt.want.Error || got.Reason != tt.want.Reason {
+				t.Errorf("state = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStateSharedFile records from two states of the same file, like `schedule run` and `schedule trigger` do
+func TestStateSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	slot := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var states []*State
+	for range 2 {
+		state, err := LoadState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, state)
+	}
+
+	const records = 50
+	var wg sync.WaitGroup
+	for i, state := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range records {
+				name := fmt.Sprintf("job-%d-%d", i, j)
+				if err := state.Record(name, JobState{LastRun: slot, Outcome: OutcomeSuccess}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range states {
+		for j := range records {
+			if _, ok := loaded.Get(fmt.Sprintf("job-%d-%d", i, j)); !ok {
+				t.Errorf("record job-%d-%d was lost", i, j)
+			}
+		}
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != "state.json" && name != "state.json.lock" {
+			t.Errorf("unexpected file %s next to the state file", name)
+		}
+	}
+}
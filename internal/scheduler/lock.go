@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// lockMinHold keeps a leader lock for at least this long after it was acquired,
+// so that a replica whose clock is a little behind doesn't run a short job a second time
+const lockMinHold = time.Minute
+
+// Locker takes a lock per job so that only one of several scheduler replicas runs it
+type Locker interface {
+	// TryLock acquires the lock for the named job without waiting.
+	// When another replica holds the lock it returns a nil lease and the holder's identity.
+	TryLock(ctx context.Context, name string) (Lease, string, error)
+	// Identity returns the name this replica uses as lock owner
+	Identity() string
+}
+
+// errLeaderLockLost is the cause of a run cancelled because its leader lock was lost
+var errLeaderLockLost = errors.New("leader lock was lost")
+
+// Lease is a held leader lock
+type Lease interface {
+	// Lost is closed when the lock is lost while it is held, such as when another replica took it over
+	Lost() <-chan struct{}
+	// Release gives up the lock
+	Release(ctx context.Context) error
+}
+
+// UseLocker makes every job take a leader lock from locker before running.
+// It must be called before jobs are added.
+func (s *Scheduler) UseLocker(locker Locker) {
+	s.locker = locker
+}
+
+// leaderLock only runs a job on the replica that acquires its leader lock. A slot another replica
+// holds the lock for is recorded as handled, so that this replica doesn't catch it up after a restart.
+// A slot whose lock could not be taken at all is not, nothing tells whether any replica ran it.
+// The run is cancelled when the lock is lost, since another replica may run the job by then.
+func (s *Scheduler) leaderLock(job Job) runWrapper {
+	return func(run runFunc) runFunc {
+		return func(ctx context.Context, slot time.Time) {
+			lease, holder, err := s.locker.TryLock(ctx, job.Name)
+			if err != nil {
+				s.logger.Error().Err(err).
+					Str("job", job.Name).
+					Str("identity", s.locker.Identity()).
+					Msg("failed to acquire leader lock, skipping this run")
+				return
+			}
+
+			if lease == nil {
+				s.logger.Info().
+					Str("job", job.Name).
+					Str("identity", s.locker.Identity()).
+					Str("held_by", holder).
+					Msg("leader lock is held by another replica, skipping this run")
+				s.skip(job, slot, "leader lock was held by "+holder)
+				return
+			}
+
+			acquired := time.Now()
+			s.logger.Info().
+				Str("job", job.Name).
+				Str("identity", s.locker.Identity()).
+				Msg("acquired leader lock")
+
+			defer func() {
+				// A lost lock belongs to another replica by now, there is nothing left to hold or release
+				select {
+				case <-lease.Lost():
+					return
+				default:
+				}
+
+				// Hold the lock a little longer unless the scheduler is shutting down
+				if remaining := lockMinHold - time.Since(acquired); remaining > 0 {
+					timer := time.NewTimer(remaining)
+					select {
+					case <-timer.C:
+					case <-s.done:
+						timer.Stop()
+					}
+				}
+
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), cancelTimeout)
+				defer cancel()
+
+				if err := lease.Release(ctx); err != nil {
+					s.logger.Error().Err(err).
+						Str("job", job.Name).
+						Str("identity", s.locker.Identity()).
+						Msg("failed to release leader lock")
+					return
+				}
+
+				s.logger.Info().
+					Str("job", job.Name).
+					Str("identity", s.locker.Identity()).
+					Msg("released leader lock")
+			}()
+
+			ctx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+
+			go func() {
+				select {
+				case <-lease.Lost():
+					s.logger.Error().
+						Str("job", job.Name).
+						Str("identity", s.locker.Identity()).
+						Msg("lost leader lock, cancelling the run")
+					cancel(errLeaderLockLost)
+				case <-ctx.Done():
+				}
+			}()
+
+			run(ctx, slot)
+		}
+	}
+}
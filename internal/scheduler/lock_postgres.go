@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// postgresLockPingInterval is how often the session holding an advisory lock is checked
+const postgresLockPingInterval = 10 * time.Second
+
+// PostgresLocker takes session-level advisory locks on the backed-up server.
+// A replica that dies loses its session, so its locks are released by the server itself.
+type PostgresLocker struct {
+	identity string
+	logger   zerolog.Logger
+}
+
+// NewPostgresLocker creates a locker that uses PostgreSQL advisory locks
+func NewPostgresLocker(identity string) *PostgresLocker {
+	return &PostgresLocker{
+		identity: identity,
+		logger:   log.Logger.With().Str("caller", "postgres_leader_lock").Logger(),
+	}
+}
+
+func (l *PostgresLocker) Identity() string {
+	return l.identity
+}
+
+func (l *PostgresLocker) TryLock(ctx context.Context, name string) (Lease, string, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := advisoryKey(name)
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		conn.Close(ctx)
+		return nil, "", fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+
+	if acquired {
+		return l.lease(conn, key), "", nil
+	}
+
+	// Look up the application name of the session holding the lock, which carries its identity.
+	// A bigint advisory key is split into classid (high 32 bits) and objid (low 32 bits).
+	var holder string
+	err = conn.QueryRow(ctx, `
+		SELECT a.application_name
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted
+		  AND l.classid = ($1::bigint >> 32)::oid
+		  AND l.objid = ($1::bigint & 4294967295)::oid
+		  AND l.objsubid = 1
+		LIMIT 1`, key).Scan(&holder)
+	if err != nil {
+		holder = "unknown"
+	}
+
+	conn.Close(ctx)
+	return nil, holder, nil
+}
+
+func (l *PostgresLocker) connect(ctx context.Context) (*pgx.Conn, error) {
+	cfg, err := pgx.ParseConfig("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create postgres connection config: %w", err)
+	}
+
+	cfg.Host = config.Loaded.Postgres.Host
+	if config.Loaded.Postgres.Port != nil {
+		cfg.Port = uint16(*config.Loaded.Postgres.Port) //nolint:gosec // ports are always within uint16
+	}
+	if config.Loaded.Postgres.User != nil {
+		cfg.User = *config.Loaded.Postgres.User
+	}
+	if config.Loaded.Postgres.Password != nil {
+		cfg.Password = *config.Loaded.Postgres.Password
+	}
+	if config.Loaded.Postgres.Database != nil {
+		cfg.Database = *config.Loaded.Postgres.Database
+	}
+	cfg.RuntimeParams["application_name"] = l.identity
+
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres for leader lock: %w", err)
+	}
+
+	return conn, nil
+}
+
+// advisoryKey derives a stable advisory lock key from a job name
+func advisoryKey(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte("postgres-backup:" + name))
+	return int64(hash.Sum64()) //nolint:gosec // wrapping into the signed key space is intended
+}
+
+// lease starts checking the session holding the lock in the background
+func (l *PostgresLocker) lease(conn *pgx.Conn, key int64) *postgresLease {
+	lease := &postgresLease{
+		locker:  l,
+		conn:    conn,
+		key:     key,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	go lease.ping()
+	return lease
+}
+
+type postgresLease struct {
+	locker *PostgresLocker
+	// conn is only used by ping until the lease is released
+	conn *pgx.Conn
+	key  int64
+
+	stop    chan struct{}
+	stopped chan struct{}
+	// lost is closed when the session holding the lock is gone, the server released the lock with it
+	lost chan struct{}
+}
+
+func (l *postgresLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// ping checks the session holding the lock until the lease is released or the session is gone
+func (l *postgresLease) ping() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(postgresLockPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), postgresLockPingInterval/2)
+		err := l.conn.Ping(ctx)
+		if err == nil {
+			cancel()
+			continue
+		}
+
+		// A session that can't be reached may already be closed by the server, which released the lock.
+		// A lost lease is never released, so the connection is closed here.
+		l.locker.logger.Error().Err(err).
+			Int64("key", l.key).
+			Str("identity", l.locker.identity).
+			Msg("lost the session holding the leader lock, another replica may take it over")
+		close(l.lost)
+		l.conn.Close(ctx)
+		cancel()
+		return
+	}
+}
+
+func (l *postgresLease) Release(ctx context.Context) error {
+	close(l.stop)
+	<-l.stopped
+
+	defer l.conn.Close(ctx)
+
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		return fmt.Errorf("failed to release advisory lock: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// S3Locker keeps a lock object per job in the backup bucket.
+// Locks are written with conditional requests and renewed while held, a lock that has not been
+// renewed within its ttl belongs to a replica that died and is taken over.
+type S3Locker struct {
+	identity string
+	ttl      time.Duration
+	logger   zerolog.Logger
+}
+
+// lockRecord is the content of a lock object
+type lockRecord struct {
+	Owner     string    `json:"owner"`
+	Acquired  time.Time `json:"acquired"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewS3Locker creates a locker that uses lock objects in the S3 bucket
+func NewS3Locker(identity string, ttl time.Duration) *S3Locker {
+	return &S3Locker{
+		identity: identity,
+		ttl:      ttl,
+		logger:   log.Logger.With().Str("caller", "s3_leader_lock").Logger(),
+	}
+}
+
+func (l *S3Locker) Identity() string {
+	return l.identity
+}
+
+func (l *S3Locker) TryLock(ctx context.Context, name string) (Lease, string, error) {
+	client, err := s3.CreateClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := lockKey(name)
+	bucket := config.Loaded.Storage.S3.Bucket
+
+	// Create the lock object only if it doesn't exist yet
+	etag, err := l.write(ctx, client, key, time.Now(), func(opts *minio.PutObjectOptions) {
+		opts.SetMatchETagExcept("*")
+	})
+	if err == nil {
+		return l.lease(client, key, etag), "", nil
+	}
+	if !isPreconditionFailed(err) {
+		return nil, "", fmt.Errorf("failed to create lock object: %w", err)
+	}
+
+	// The lock object exists, find out whether its owner is still alive
+	sse, err := s3.ReadEncryption()
+	if err != nil {
+		return nil, "", err
+	}
+
+	object, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lock object: %w", err)
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to stat lock object: %w", err)
+	}
+
+	var record lockRecord
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lock object: %w", err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		l.logger.Warn().Err(err).Str("key", key).Msg("lock object is corrupt, treating it as stale")
+	}
+
+	if time.Now().Before(record.ExpiresAt) {
+		return nil, record.Owner, nil
+	}
+
+	l.logger.Warn().
+		Str("key", key).
+		Str("stale_owner", record.Owner).
+		Time("expired_at", record.ExpiresAt).
+		Str("identity", l.identity).
+		Msg("taking over stale leader lock")
+
+	// Replace the stale lock only if nobody else replaced it in the meantime
+	etag, err = l.write(ctx, client, key, time.Now(), func(opts *minio.PutObjectOptions) {
+		opts.SetMatchETag(stat.ETag)
+	})
+	if isPreconditionFailed(err) {
+		return nil, "unknown", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to take over lock object: %w", err)
+	}
+
+	return l.lease(client, key, etag), "", nil
+}
+
+// write stores a lock record owned by this replica and returns the new ETag
+func (l *S3Locker) write(ctx context.Context, client *minio.Client, key string, acquired time.Time, condition func(*minio.PutObjectOptions)) (string, error) {
+	data, err := json.Marshal(lockRecord{
+		Owner:     l.identity,
+		Acquired:  acquired,
+		ExpiresAt: time.Now().Add(l.ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Lock objects are stored like backups, so bucket policies requiring encryption accept them
+	sse, err := s3.WriteEncryption()
+	if err != nil {
+		return "", err
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/json", ServerSideEncryption: sse}
+	condition(&opts)
+
+	info, err := client.PutObject(ctx, config.Loaded.Storage.S3.Bucket, key, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return "", err
+	}
+
+	return info.ETag, nil
+}
+
+// lease starts renewing the lock in the background
+func (l *S3Locker) lease(client *minio.Client, key, etag string) *s3Lease {
+	lease := &s3Lease{
+		locker:   l,
+		client:   client,
+		key:      key,
+		etag:     etag,
+		acquired: time.Now(),
+		renewed:  time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+
+	go lease.renew()
+	return lease
+}
+
+type s3Lease struct {
+	locker   *S3Locker
+	client   *minio.Client
+	key      string
+	acquired time.Time
+
+	mu   sync.Mutex
+	etag string
+	// renewed is when the lock was last written, it expires ttl after that
+	renewed time.Time
+
+	stop    chan struct{}
+	stopped chan struct{}
+	// lost is closed when another replica took the lock over or it expired without being renewed
+	lost chan struct{}
+}
+
+func (l *s3Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// renew extends the lock well before it expires until the lease is released or lost
+func (l *s3Lease) renew() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.locker.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		current := l.etag
+		l.mu.Unlock()
+
+		written := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl/3)
+		etag, err := l.locker.write(ctx, l.client, l.key, l.acquired, func(opts *minio.PutObjectOptions) {
+			opts.SetMatchETag(current)
+		})
+		cancel()
+
+		if err != nil {
+			if isPreconditionFailed(err) {
+				l.locker.logger.Error().Err(err).
+					Str("key", l.key).
+					Str("identity", l.locker.identity).
+					Msg("leader lock was taken over by another replica")
+				close(l.lost)
+				return
+			}
+
+			// Once the lock expired another replica may take it over at any moment
+			if time.Since(l.renewed) >= l.locker.ttl {
+				l.locker.logger.Error().Err(err).
+					Str("key", l.key).
+					Str("identity", l.locker.identity).
+					Msg("leader lock expired without being renewed")
+				close(l.lost)
+				return
+			}
+
+			l.locker.logger.Error().Err(err).
+				Str("key", l.key).
+				Str("identity", l.locker.identity).
+				Msg("failed to renew leader lock, another replica may take it over")
+			continue
+		}
+
+		l.mu.Lock()
+		l.etag = etag
+		l.mu.Unlock()
+		l.renewed = written
+	}
+}
+
+func (l *s3Lease) Release(ctx context.Context) error {
+	close(l.stop)
+	<-l.stopped
+
+	l.mu.Lock()
+	etag := l.etag
+	l.mu.Unlock()
+
+	// Don't remove a lock that another replica has taken over in the meantime
+	sse, err := s3.ReadEncryption()
+	if err != nil {
+		return err
+	}
+
+	stat, err := l.client.StatObject(ctx, config.Loaded.Storage.S3.Bucket, l.key, minio.StatObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		return fmt.Errorf("failed to stat lock object: %w", err)
+	}
+	if stat.ETag != etag {
+		return errors.New("lock object is owned by another replica")
+	}
+
+	if err := l.client.RemoveObject(ctx, config.Loaded.Storage.S3.Bucket, l.key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove lock object: %w", err)
+	}
+
+	return nil
+}
+
+// lockKey returns the key of the lock object for a job, next to the backups
+func lockKey(name string) string {
+	key := ".locks/" + name + ".lock"
+
+	if config.Loaded.Storage.S3.Prefix != nil {
+		key = strings.TrimSuffix(*config.Loaded.Storage.S3.Prefix, "/") + "/" + key
+	}
+
+	return key
+}
+
+func isPreconditionFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	response := minio.ToErrorResponse(err)
+	return response.StatusCode == http.StatusPreconditionFailed || response.Code == "PreconditionFailed"
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeLocker hands out lease, or reports holder or err like a lock held elsewhere or a failing backend
+type fakeLocker struct {
+	lease  *fakeLease
+	holder string
+	err    error
+}
+
+func (l *fakeLocker) TryLock(context.Context, string) (Lease, string, error) {
+	if l.err != nil {
+		return nil, "", l.err
+	}
+	if l.lease == nil {
+		return nil, l.holder, nil
+	}
+	return l.lease, "", nil
+}
+
+func (l *fakeLocker) Identity() string {
+	return "test"
+}
+
+type fakeLease struct {
+	lost     chan struct{}
+	released bool
+}
+
+func (l *fakeLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *fakeLease) Release(context.Context) error {
+	l.released = true
+	return nil
+}
+
+func TestLeaderLock(t *testing.T) {
+	slot := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		locker *fakeLocker
+		// loseLease closes the lease's lost channel while the run is in progress
+		loseLease    bool
+		wantRun      bool
+		wantCause    error
+		wantReleased bool
+		wantState    *JobState
+	}{
+		{
+			name:         "lock acquired",
+			locker:       &fakeLocker{lease: &fakeLease{lost: make(chan struct{})}},
+			wantRun:      true,
+			wantReleased: true,
+		},
+		{
+			name:      "lock held by another replica",
+			locker:    &fakeLocker{holder: "replica-1"},
+			wantState: &JobState{LastRun: slot, Outcome: OutcomeSkipped, Reason: "leader lock was held by replica-1"},
+		},
+		{
+			name:   "lock backend failing",
+			locker: &fakeLocker{err: errors.New("connection refused")},
+		},
+		{
+			name:      "lock lost during the run",
+			locker:    &fakeLocker{lease: &fakeLease{lost: make(chan struct{})}},
+			loseLease: true,
+			wantRun:   true,
+			wantCause: errLeaderLockLost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(context.Background())
+			s.UseLocker(tt.locker)
+			state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.UseState(state)
+
+			// Shutting down skips holding the lock for lockMinHold after the run
+			close(s.done)
+
+			ran := false
+			var cause error
+			run := s.leaderLock(Job{Name: "job"})(func(ctx context.Context, _ time.Time) {
+				ran = true
+				if tt.loseLease {
+					close(tt.locker.lease.lost)
+					select {
+					case <-ctx.Done():
+					case <-time.After(5 * time.Second):
+						t.Error("run was not cancelled after losing the lock")
+					}
+				}
+				cause = context.Cause(ctx)
+			})
+
+			run(context.Background(), slot)
+
+			if ran != tt.wantRun {
+				t.Errorf("ran = %v, want %v", ran, tt.wantRun)
+			}
+			if tt.wantRun && !errors.Is(cause, tt.wantCause) {
+				t.Errorf("run context cause = %v, want %v", cause, tt.wantCause)
+			}
+			if lease := tt.locker.lease; lease != nil && lease.released != tt.wantReleased {
+				t.Errorf("released = %v, want %v", lease.released, tt.wantReleased)
+			}
+
+			got, ok := state.Get("job")
+			switch {
+			case tt.wantState == nil && ok:
+				t.Errorf("state = %+v, want nothing recorded", got)
+			case tt.wantState != nil && !ok:
+				t.Errorf("state has no record, want %+v", *tt.wantState)
+			case tt.wantState != nil && (!got.LastRun.Equal(tt.wantState.LastRun) || got.Outcome != tt.wantState.Outcome || got.Reason != tt.wantState.Reason):
+				t.Errorf("state = %+v, want %+v", got, *tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal"
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/notify"
+)
+
+const (
+	TypeBackup    = "backup"
+	TypeRestore   = "restore"
+	TypeGC        = "gc"
+	TypeRetention = "retention"
+	TypeVerify    = "verify"
+)
+
+// Job describes a single scheduled job
+type Job struct {
+	Name    string
+	Type    string
+	Cron    string
+	Enabled bool
+	Overlap string
+	// Location is the time zone the cron expression is evaluated in, unless it sets CRON_TZ itself
+	Location *time.Location
+	// Jitter delays each run by a random duration up to this value
+	Jitter time.Duration
+	// Retry bounds each attempt of the job and retries failed attempts
+	Retry config.RetryPolicy
+	// Databases are locked while the job runs so that jobs touching the same database never run at once.
+	// Jobs that do not touch a database leave it empty.
+	Databases []string
+	// Ping is called when a run starts, succeeds and fails, it is nil for jobs without ping settings
+	Ping *config.PingConfig
+	Run  func(ctx context.Context) error
+	// NewRun starts a run of the job, for jobs whose retries depend on what the earlier attempts of the run did.
+	// Run is used when it is nil.
+	NewRun func() Run
+}
+
+// Run is a run of a job made of one or more attempts
+type Run interface {
+	// Attempt is called for every attempt of the run
+	Attempt(ctx context.Context) error
+	// Finish is called once after the last attempt
+	Finish()
+}
+
+// cancelTimeout bounds how long shutdown waits for jobs to return after their context was cancelled
+const cancelTimeout = 10 * time.Second
+
+// Scheduler runs jobs on their cron schedule with overlap protection and per-database locking
+type Scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	cron   *cron.Cron
+	logger zerolog.Logger
+
+	locks *databaseLocks
+	// done is closed when shutdown begins
+	done chan struct{}
+	// locker provides leader locks, it is nil when replicas don't coordinate
+	locker Locker
+	// state persists the outcome of every run, it is nil when no state file is configured
+	state *State
+	// entries holds every registered job with its parsed schedule and wrapped runner
+	entries []entry
+	// detached tracks runs started outside of cron, such as catch-up runs
+	detached sync.WaitGroup
+
+	mu       sync.Mutex
+	started  bool
+	skipped  map[string]int64
+	running  map[string]int
+	stopping bool
+	failed   int
+	// runs counts finished runs per job and keeps the result of the latest one
+	runs map[string]runResult
+}
+
+type runResult struct {
+	count int
+	err   error
+	last  JobState
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	run      runFunc
+}
+
+// ShutdownResult describes what happened to in-flight jobs during shutdown
+type ShutdownResult struct {
+	// InFlight is the number of jobs that were running when shutdown began
+	InFlight int
+	// Failed is the number of in-flight jobs that returned an error while draining
+	Failed int
+	// Cancelled is the number of in-flight jobs that did not finish within the grace period
+	Cancelled int
+	// Abandoned is the number of jobs that were still running after cancellation
+	Abandoned int
+}
+
+// ExitCode returns the process exit status for the shutdown outcome
+func (r ShutdownResult) ExitCode() int {
+	if r.Failed > 0 || r.Cancelled > 0 || r.Abandoned > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// New creates a scheduler whose jobs run with a context derived from ctx.
+// Cancelling ctx does not stop running jobs, use Shutdown for that.
+func New(ctx context.Context) *Scheduler {
+	logger := log.Logger.With().Str("caller", "scheduler").Logger()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	return &Scheduler{
+		ctx:     ctx,
+		cancel:  cancel,
+		cron:    cron.New(cron.WithLogger(cronLogger{logger: logger})),
+		logger:  logger,
+		locks:   newDatabaseLocks(),
+		done:    make(chan struct{}),
+		skipped: make(map[string]int64),
+		running: make(map[string]int),
+		runs:    make(map[string]runResult),
+	}
+}
+
+// Add registers a job with the scheduler
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := Parse(job)
+	if err != nil {
+		return err
+	}
+
+	run := s.wrap(job, true)
+	s.cron.Schedule(schedule, cron.FuncJob(func() {
+		// Cron fires on whole seconds, a timer firing a little late must not move the slot
+		run(s.ctx, time.Now().Truncate(time.Second))
+	}))
+	s.entries = append(s.entries, entry{job: job, schedule: schedule, run: run})
+	return nil
+}
+
+// Trigger runs a job right away through the same leader lock, overlap protection and database
+// locking as scheduled runs, but without jitter. It reports whether the job actually ran.
+// Overlap protection and database locking are kept in memory, so only the leader lock coordinates
+// a trigger with the runs of a scheduler in another process.
+func (s *Scheduler) Trigger(job Job) (bool, error) {
+	s.detached.Add(1)
+	defer s.detached.Done()
+
+	before := s.result(job.Name)
+	s.wrap(job, false)(s.ctx, time.Now())
+	after := s.result(job.Name)
+
+	if after.count == before.count {
+		return false, nil
+	}
+
+	return true, after.err
+}
+
+func (s *Scheduler) result(name string) runResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.runs[name]
+}
+
+// UseState records the outcome of every run in state
+func (s *Scheduler) UseState(state *State) {
+	s.state = state
+}
+
+// Parse parses the cron expression of a job in the job's time zone
+func Parse(job Job) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(job.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", job.Cron, err)
+	}
+
+	// An explicit CRON_TZ or TZ prefix in the expression wins over the configured time zone
+	explicit := strings.HasPrefix(job.Cron, "CRON_TZ=") || strings.HasPrefix(job.Cron, "TZ=")
+	if spec, ok := schedule.(*cron.SpecSchedule); ok && job.Location != nil && !explicit {
+		spec.Location = job.Location
+	}
+
+	return schedule, nil
+}
+
+// Start starts the scheduler in the background
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+
+	s.cron.Start()
+}
+
+// Shutdown stops scheduling new runs and waits up to grace for in-flight jobs to finish.
+// Jobs still running after the grace period, or once force is done, are cancelled.
+func (s *Scheduler) Shutdown(force context.Context, grace time.Duration) ShutdownResult {
+	s.mu.Lock()
+	s.stopping = true
+	close(s.done)
+	inFlight := make([]string, 0, len(s.running))
+	for name, count := range s.running {
+		for range count {
+			inFlight = append(inFlight, name)
+		}
+	}
+	s.mu.Unlock()
+
+	stopped := s.drained()
+	result := ShutdownResult{InFlight: len(inFlight)}
+
+	if len(inFlight) > 0 {
+		s.logger.Info().
+			Strs("jobs", inFlight).
+			Dur("grace_period", grace).
+			Msg("waiting for in-flight jobs to finish")
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+		result.Failed = s.failedCount()
+		return result
+	case <-timer.C:
+		s.logger.Warn().Dur("grace_period", grace).Msg("grace period expired, cancelling in-flight jobs")
+	case <-force.Done():
+		s.logger.Warn().Msg("forced shutdown requested, cancelling in-flight jobs")
+	}
+
+	result.Cancelled = s.runningCount()
+	s.cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(cancelTimeout):
+		result.Abandoned = s.runningCount()
+		s.logger.Error().
+			Int("jobs", result.Abandoned).
+			Msg("jobs did not return after cancellation, abandoning them")
+	}
+
+	result.Failed = s.failedCount()
+	return result
+}
+
+// drained stops cron and returns a channel that is closed once every cron and detached run has returned
+func (s *Scheduler) drained() <-chan struct{} {
+	stopped := s.cron.Stop()
+	drained := make(chan struct{})
+
+	go func() {
+		<-stopped.Done()
+		s.detached.Wait()
+		close(drained)
+	}()
+
+	return drained
+}
+
+// Skipped returns how many runs of the named job were skipped because a previous run was still in progress
+func (s *Scheduler) Skipped(name string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.skipped[name]
+}
+
+// wrap decorates a job with panic recovery, the leader lock, jitter, its overlap policy and database locking
+func (s *Scheduler) wrap(job Job, jitter bool) runFunc {
+	wrappers := []runWrapper{s.recoverPanic(job)}
+
+	// The leader lock is taken at the scheduled time, before jitter, so replicas compete for the same run
+	if s.locker != nil {
+		wrappers = append(wrappers, s.leaderLock(job))
+	}
+
+	if jitter && job.Jitter > 0 {
+		wrappers = append(wrappers, s.jitter(job))
+	}
+
+	switch job.Overlap {
+	case config.OverlapSkip:
+		wrappers = append(wrappers, s.skipIfStillRunning(job))
+	case config.OverlapQueue:
+		wrappers = append(wrappers, s.delayIfStillRunning(job))
+	}
+
+	if len(job.Databases) > 0 {
+		wrappers = append(wrappers, s.lockDatabase(job))
+	}
+
+	return chain(func(ctx context.Context, slot time.Time) {
+		// Runs that were queued behind another run must not start once shutdown has begun
+		if !s.begin(job) {
+			s.logger.Info().
+				Str("job", job.Name).
+				Str("type", job.Type).
+				Msg("scheduler is shutting down, not starting job")
+			return
+		}
+
+		// Recorded before the run starts, so that a run cut off by a restart is caught up
+		s.record(job, JobState{LastRun: slot, Outcome: OutcomeRunning})
+
+		ping := notify.StartPing(job.Name, job.Ping)
+		var err error
+		if job.NewRun != nil {
+			run := job.NewRun()
+			err = internal.Retry(ctx, job.Name, job.Retry, run.Attempt)
+			run.Finish()
+		} else {
+			err = internal.Retry(ctx, job.Name, job.Retry, job.Run)
+		}
+		if errors.Is(context.Cause(ctx), errLeaderLockLost) {
+			err = fmt.Errorf("%w: %w", errLeaderLockLost, err)
+		}
+		ping.Finish(err)
+		last := newJobState(slot, time.Now(), err)
+		s.finish(job, last, err)
+		s.record(job, last)
+
+		switch {
+		case err == nil:
+		case errors.Is(err, errLeaderLockLost):
+			s.logger.Warn().Err(err).
+				Str("job", job.Name).
+				Str("type", job.Type).
+				Msg("scheduled job cancelled after losing its leader lock")
+		case errors.Is(err, context.Canceled) && s.ctx.Err() != nil:
+			s.logger.Warn().Err(err).
+				Str("job", job.Name).
+				Str("type", job.Type).
+				Msg("scheduled job cancelled by shutdown")
+		default:
+			s.logger.Error().Err(err).
+				Str("job", job.Name).
+				Str("type", job.Type).
+				Msg("scheduled job failed")
+		}
+	}, wrappers...)
+}
+
+// record persists the state of a run of the job, a failure is logged since the run itself is not affected
+func (s *Scheduler) record(job Job, last JobState) {
+	if s.state == nil {
+		return
+	}
+
+	if err := s.state.Record(job.Name, last); err != nil {
+		s.logger.Error().Err(err).
+			Str("job", job.Name).
+			Msg("failed to persist scheduler state")
+	}
+}
+
+// skip records a slot that was skipped since another run covers it, so that it isn't caught up
+func (s *Scheduler) skip(job Job, slot time.Time, reason string) {
+	s.record(job, JobState{LastRun: slot, Outcome: OutcomeSkipped, Reason: reason})
+}
+
+// begin records a job as running unless the scheduler is shutting down
+func (s *Scheduler) begin(job Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return false
+	}
+
+	s.running[job.Name]++
+	return true
+}
+
+// finish records the end of a job run
+func (s *Scheduler) finish(job Job, last JobState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running[job.Name]--
+	if s.running[job.Name] == 0 {
+		delete(s.running, job.Name)
+	}
+
+	s.runs[job.Name] = runResult{count: s.runs[job.Name].count + 1, err: err, last: last}
+
+	if err != nil && s.stopping && s.ctx.Err() == nil {
+		s.failed++
+	}
+}
+
+func (s *Scheduler) runningCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, n := range s.running {
+		count += n
+	}
+	return count
+}
+
+func (s *Scheduler) failedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.failed
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	OutcomeSuccess   = "success"
+	OutcomeFailure   = "failure"
+	OutcomeCancelled = "cancelled"
+	// OutcomeRunning is recorded when a run starts, it is still there if the scheduler stopped before the run finished
+	OutcomeRunning = "running"
+	// OutcomeSkipped is recorded for a slot that was left to another run, by the overlap policy or the leader lock
+	OutcomeSkipped = "skipped"
+)
+
+// JobState is the persisted record of the last run of a job
+type JobState struct {
+	// LastRun is the scheduled time of the latest run that was started or skipped
+	LastRun      time.Time `json:"last_run"`
+	LastFinished time.Time `json:"last_finished,omitzero"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+	// Reason tells why a run was skipped
+	Reason string `json:"reason,omitempty"`
+}
+
+// State is the scheduler state persisted in a local JSON file
+type State struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string]JobState
+}
+
+// LoadState reads the state file at path, a missing file yields an empty state
+func LoadState(path string) (*State, error) {
+	state := &State{path: path, jobs: make(map[string]JobState)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state.jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// Get returns the state of the named job
+func (s *State) Get(name string) (JobState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[name]
+	return job, ok
+}
+
+// newJobState describes a run for the scheduled slot that finished at the given time and returned err
+func newJobState(slot, finished time.Time, err error) JobState {
+	job := JobState{
+		LastRun:      slot,
+		LastFinished: finished,
+		Outcome:      OutcomeSuccess,
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Outcome = OutcomeCancelled
+		job.Error = err.Error()
+	case err != nil:
+		job.Outcome = OutcomeFailure
+		job.Error = err.Error()
+	}
+
+	return job
+}
+
+// Record stores the state of a run and writes the state file. LastRun never moves back, and a slot
+// skipped while a run is in progress keeps that run recorded as running, so that it is still caught up
+// if the scheduler stops before it finishes.
+// `schedule trigger` writes the same file from another process, so the file is locked and the records
+// of other processes are read back before it is written.
+func (s *State) Record(name string, job JobState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock state file: %w", err)
+	}
+	defer unlock()
+
+	s.reload()
+
+	if previous, ok := s.jobs[name]; ok {
+		if previous.LastRun.After(job.LastRun) {
+			job.LastRun = previous.LastRun
+		}
+		if job.Outcome == OutcomeSkipped && previous.Outcome == OutcomeRunning {
+			previous.LastRun = job.LastRun
+			job = previous
+		}
+	}
+
+	s.jobs[name] = job
+	return s.save()
+}
+
+// reload replaces the records with those of the state file, which holds the records of every process.
+// The records are kept when the file can't be read, writing it repairs it.
+func (s *State) reload() {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+
+	jobs := make(map[string]JobState)
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return
+	}
+
+	s.jobs = jobs
+}
+
+// save writes the state to a temporary file of its own and renames it over the state file,
+// so a crash never leaves a truncated state behind
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package scheduler
+
+// lockFile is a no-op where flock is not available, each process still writes a temporary file of its own
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
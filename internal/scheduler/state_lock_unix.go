@@ -0,0 +1,27 @@
+//go:build unix
+
+package scheduler
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file at path, creating it when missing, and returns a function releasing it.
+// The lock is advisory and released by the kernel when the process dies.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN) //nolint:errcheck // closing the file releases the lock as well
+		file.Close()
+	}, nil
+}
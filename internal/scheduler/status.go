@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// JobStatus describes a registered job and the outcome of its last run
+type JobStatus struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Cron    string    `json:"cron"`
+	Running int       `json:"running"`
+	Runs    int       `json:"runs"`
+	Skipped int64     `json:"skipped"`
+	Next    time.Time `json:"next"`
+	// Last is the last run of this process, or the one recorded in the state file before it started
+	Last *JobState `json:"last,omitempty"`
+}
+
+// Status returns the status of every registered job
+func (s *Scheduler) Status() []JobStatus {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		status := JobStatus{
+			Name:    e.job.Name,
+			Type:    e.job.Type,
+			Cron:    e.job.Cron,
+			Running: s.running[e.job.Name],
+			Runs:    s.runs[e.job.Name].count,
+			Skipped: s.skipped[e.job.Name],
+		}
+
+		if !s.stopping {
+			status.Next = e.schedule.Next(now)
+		}
+
+		if result, ok := s.runs[e.job.Name]; ok {
+			last := result.last
+			status.Last = &last
+		} else if s.state != nil {
+			if last, ok := s.state.Get(e.job.Name); ok {
+				status.Last = &last
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// Alive reports whether the scheduler is running and its loop answers before ctx is done
+func (s *Scheduler) Alive(ctx context.Context) bool {
+	s.mu.Lock()
+	running := s.started && !s.stopping
+	s.mu.Unlock()
+
+	if !running {
+		return false
+	}
+
+	// Entries is answered by the scheduling loop while it runs, so a stuck loop never replies
+	answered := make(chan struct{})
+	go func() {
+		s.cron.Entries()
+		close(answered)
+	}()
+
+	select {
+	case <-answered:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// runFunc runs a job for the scheduled time it was started for, which is recorded in the state file.
+// Wrappers may cancel ctx for the runs they wrap, such as when the leader lock is lost.
+type runFunc func(ctx context.Context, slot time.Time)
+
+// runWrapper decorates a runFunc like a cron.JobWrapper decorates a cron.Job
+type runWrapper func(runFunc) runFunc
+
+// chain applies the wrappers to run, the first wrapper is the outermost one
+func chain(run runFunc, wrappers ...runWrapper) runFunc {
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		run = wrappers[i](run)
+	}
+
+	return run
+}
+
+// recoverPanic logs a panicking run instead of taking the scheduler down with it
+func (s *Scheduler) recoverPanic(job Job) runWrapper {
+	return func(run runFunc) runFunc {
+		return func(ctx context.Context, slot time.Time) {
+			defer func() {
+				if r := recover(); r != nil {
+					s.logger.Error().
+						Str("job", job.Name).
+						Str("panic", fmt.Sprint(r)).
+						Str("stack", string(debug.Stack())).
+						Msg("job panicked")
+				}
+			}()
+
+			run(ctx, slot)
+		}
+	}
+}
+
+// skipIfStillRunning skips a run while the previous run of the same job is in progress.
+// Unlike cron.SkipIfStillRunning it records the job name and keeps a count of skipped runs.
+// The skipped slot is recorded as handled, the run in progress covers it.
+func (s *Scheduler) skipIfStillRunning(job Job) runWrapper {
+	return func(run runFunc) runFunc {
+		running := make(chan struct{}, 1)
+
+		return func(ctx context.Context, slot time.Time) {
+			select {
+			case running <- struct{}{}:
+				defer func() { <-running }()
+				run(ctx, slot)
+			default:
+				s.mu.Lock()
+				s.skipped[job.Name]++
+				skipped := s.skipped[job.Name]
+				s.mu.Unlock()
+
+				s.logger.Warn().
+					Str("job", job.Name).
+					Str("type", job.Type).
+					Int64("skipped_total", skipped).
+					Msg("previous run is still in progress, skipping this run")
+				s.skip(job, slot, "previous run was still in progress")
+			}
+		}
+	}
+}
+
+// delayIfStillRunning queues a run until the previous run of the same job has finished
+func (s *Scheduler) delayIfStillRunning(job Job) runWrapper {
+	return func(run runFunc) runFunc {
+		var mu sync.Mutex
+
+		return func(ctx context.Context, slot time.Time) {
+			queued := time.Now()
+			mu.Lock()
+			defer mu.Unlock()
+
+			if delay := time.Since(queued); delay > time.Minute {
+				s.logger.Info().
+					Str("job", job.Name).
+					Dur("delay", delay).
+					Msg("run was delayed by the previous run")
+			}
+
+			run(ctx, slot)
+		}
+	}
+}
+
+// jitter delays each run by a random duration up to the job's jitter so that many instances
+// sharing a schedule don't hit the same endpoints at the same moment
+func (s *Scheduler) jitter(job Job) runWrapper {
+	return func(run runFunc) runFunc {
+		return func(ctx context.Context, slot time.Time) {
+			//nolint:gosec // jitter does not need a cryptographically secure source
+			delay := rand.N(job.Jitter)
+
+			s.logger.Debug().
+				Str("job", job.Name).
+				Dur("delay", delay).
+				Msg("delaying run by jitter")
+
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				run(ctx, slot)
+			case <-s.done:
+				s.logger.Info().
+					Str("job", job.Name).
+					Msg("scheduler is shutting down, dropping delayed run")
+			}
+		}
+	}
+}
+
+// lockDatabase prevents jobs that target the same database from running at once.
+// Databases are locked in sorted order so that jobs locking several of them can't deadlock.
+// A run waiting for a database is dropped when its context is cancelled or the scheduler shuts down.
+func (s *Scheduler) lockDatabase(job Job) runWrapper {
+	databases := slices.Clone(job.Databases)
+	slices.Sort(databases)
+	databases = slices.Compact(databases)
+
+	return func(run runFunc) runFunc {
+		return func(ctx context.Context, slot time.Time) {
+			for _, database := range databases {
+				if holder, ok := s.locks.tryLock(database, job.Name); !ok {
+					s.logger.Info().
+						Str("job", job.Name).
+						Str("database", database).
+						Str("held_by", holder).
+						Msg("database is busy with another job, waiting")
+					if err := s.locks.lock(ctx, s.done, database, job.Name); err != nil {
+						s.logger.Info().
+							Err(err).
+							Str("job", job.Name).
+							Str("database", database).
+							Msg("stopped waiting for the database, dropping run")
+						return
+					}
+				}
+				defer s.locks.unlock(database)
+			}
+
+			run(ctx, slot)
+		}
+	}
+}
+
+// errSchedulerStopping is returned by databaseLocks.lock when the scheduler shuts down during the wait
+var errSchedulerStopping = errors.New("scheduler is shutting down")
+
+// databaseLock is a held database lock, released is closed once it is unlocked
+type databaseLock struct {
+	job      string
+	released chan struct{}
+}
+
+// databaseLocks is a set of mutexes keyed by database name that remembers which job holds each lock
+type databaseLocks struct {
+	mu      sync.Mutex
+	holders map[string]*databaseLock
+}
+
+func newDatabaseLocks() *databaseLocks {
+	return &databaseLocks{holders: make(map[string]*databaseLock)}
+}
+
+// tryLock acquires the lock if it is free, otherwise it returns the name of the job holding it
+func (l *databaseLocks) tryLock(database, job string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if holder, ok := l.holders[database]; ok {
+		return holder.job, false
+	}
+
+	l.holders[database] = &databaseLock{job: job, released: make(chan struct{})}
+	return "", true
+}
+
+// lock waits until the lock is free and acquires it. It gives up when ctx is cancelled or done is closed.
+func (l *databaseLocks) lock(ctx context.Context, done <-chan struct{}, database, job string) error {
+	for {
+		l.mu.Lock()
+		holder, ok := l.holders[database]
+		if !ok {
+			l.holders[database] = &databaseLock{job: job, released: make(chan struct{})}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-holder.released:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return errSchedulerStopping
+		}
+	}
+}
+
+func (l *databaseLocks) unlock(database string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if holder, ok := l.holders[database]; ok {
+		close(holder.released)
+		delete(l.holders, database)
+	}
+}
+
+// cronLogger adapts zerolog to the logger interface used by cron
+type cronLogger struct {
+	logger zerolog.Logger
+}
+
+func (l cronLogger) Info(msg string, keysAndValues ...any) {
+	l.logger.Debug().Fields(keysAndValues).Msg(msg)
+}
+
+func (l cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	l.logger.Error().Err(err).Fields(keysAndValues).Msg(msg)
+}
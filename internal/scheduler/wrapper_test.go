@@ -0,0 +1,261 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+)
+
+// probe is a run that blocks until released and tracks how many of its runs are in progress at once
+type probe struct {
+	release chan struct{}
+	started chan struct{}
+
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	runs      int
+}
+
+func newProbe() *probe {
+	return &probe{release: make(chan struct{}), started: make(chan struct{}, 16)}
+}
+
+func (p *probe) run(context.Context, time.Time) {
+	p.mu.Lock()
+	p.active++
+	p.runs++
+	p.maxActive = max(p.maxActive, p.active)
+	p.mu.Unlock()
+
+	p.started <- struct{}{}
+	<-p.release
+
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+}
+
+func (p *probe) counts() (runs, maxActive int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.runs, p.maxActive
+}
+
+// startTwo starts run twice, the second time once the first run is in progress, and gives the second
+// run a moment to start before every run is released
+func startTwo(t *testing.T, p *probe, first, second runFunc) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		first(context.Background(), time.Now())
+	}()
+
+	select {
+	case <-p.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first run did not start")
+	}
+
+	go func() {
+		defer wg.Done()
+		second(context.Background(), time.Now())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(p.release)
+	wg.Wait()
+}
+
+func TestOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		overlap       string
+		wantRuns      int
+		wantMaxActive int
+		wantSkipped   int64
+	}{
+		{overlap: config.OverlapSkip, wantRuns: 1, wantMaxActive: 1, wantSkipped: 1},
+		{overlap: config.OverlapQueue, wantRuns: 2, wantMaxActive: 1, wantSkipped: 0},
+		{overlap: config.OverlapAllow, wantRuns: 2, wantMaxActive: 2, wantSkipped: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			s := New(context.Background())
+			job := Job{Name: "job", Overlap: tt.overlap}
+			p := newProbe()
+
+			var run runFunc = p.run
+			switch tt.overlap {
+			case config.OverlapSkip:
+				run = s.skipIfStillRunning(job)(run)
+			case config.OverlapQueue:
+				run = s.delayIfStillRunning(job)(run)
+			}
+
+			startTwo(t, p, run, run)
+
+			runs, maxActive := p.counts()
+			if runs != tt.wantRuns {
+				t.Errorf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+			if maxActive != tt.wantMaxActive {
+				t.Errorf("runs in progress at once = %d, want %d", maxActive, tt.wantMaxActive)
+			}
+			if skipped := s.Skipped(job.Name); skipped != tt.wantSkipped {
+				t.Errorf("Skipped() = %d, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSkipIfStillRunningRecordsSlot(t *testing.T) {
+	s := New(context.Background())
+	state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UseState(state)
+
+	job := Job{Name: "job", Overlap: config.OverlapSkip}
+	slot := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Skip the second slot while the first run is in progress
+	p := newProbe()
+	wrapped := s.skipIfStillRunning(job)(func(ctx context.Context, slot time.Time) {
+		s.record(job, JobState{LastRun: slot, Outcome: OutcomeRunning})
+		p.run(ctx, slot)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		wrapped(context.Background(), slot)
+	}()
+	<-p.started
+	wrapped(context.Background(), slot.Add(time.Hour))
+	close(p.release)
+	wg.Wait()
+
+	got, _ := state.Get(job.Name)
+	if !got.LastRun.Equal(slot.Add(time.Hour)) || got.Outcome != OutcomeRunning {
+		t.Errorf("state = %+v, want the skipped slot with the run still in progress", got)
+	}
+}
+
+func TestLockDatabase(t *testing.T) {
+	tests := []struct {
+		name          string
+		first         []string
+		second        []string
+		wantMaxActive int
+	}{
+		{name: "same database", first: []string{"app"}, second: []string{"app"}, wantMaxActive: 1},
+		{name: "different databases", first: []string{"app"}, second: []string{"billing"}, wantMaxActive: 2},
+		{name: "overlapping sets in any order", first: []string{"app", "billing"}, second: []string{"billing", "app"}, wantMaxActive: 1},
+		{name: "one shared database", first: []string{"app", "billing"}, second: []string{"billing", "audit"}, wantMaxActive: 1},
+		{name: "duplicates in a set", first: []string{"app", "app"}, second: []string{"audit"}, wantMaxActive: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(context.Background())
+			p := newProbe()
+
+			first := s.lockDatabase(Job{Name: "first", Databases: tt.first})(p.run)
+			second := s.lockDatabase(Job{Name: "second", Databases: tt.second})(p.run)
+
+			startTwo(t, p, first, second)
+
+			runs, maxActive := p.counts()
+			if runs != 2 {
+				t.Errorf("runs = %d, want 2", runs)
+			}
+			if maxActive != tt.wantMaxActive {
+				t.Errorf("runs in progress at once = %d, want %d", maxActive, tt.wantMaxActive)
+			}
+		})
+	}
+}
+
+func TestLockDatabaseStopsWaiting(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop ends the wait of the second run
+		stop func(s *Scheduler, cancel context.CancelFunc)
+	}{
+		{name: "run cancelled", stop: func(_ *Scheduler, cancel context.CancelFunc) { cancel() }},
+		{name: "scheduler shutting down", stop: func(s *Scheduler, _ context.CancelFunc) { close(s.done) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(context.Background())
+			p := newProbe()
+
+			first := s.lockDatabase(Job{Name: "first", Databases: []string{"app"}})(p.run)
+			second := s.lockDatabase(Job{Name: "second", Databases: []string{"app"}})(p.run)
+
+			firstDone := make(chan struct{})
+			go func() {
+				defer close(firstDone)
+				first(context.Background(), time.Now())
+			}()
+			<-p.started
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			secondDone := make(chan struct{})
+			go func() {
+				defer close(secondDone)
+				second(ctx, time.Now())
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			tt.stop(s, cancel)
+
+			select {
+			case <-secondDone:
+			case <-time.After(5 * time.Second):
+				t.Fatal("waiting run did not stop while the database was still locked")
+			}
+
+			close(p.release)
+			<-firstDone
+
+			if runs, _ := p.counts(); runs != 1 {
+				t.Errorf("runs = %d, want 1", runs)
+			}
+			if holder, ok := s.locks.tryLock("app", "third"); !ok {
+				t.Errorf("database is still locked by %q", holder)
+			}
+		})
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	s := New(context.Background())
+
+	ran := false
+	run := chain(func(context.Context, time.Time) {
+		ran = true
+		panic("boom")
+	}, s.recoverPanic(Job{Name: "job"}))
+
+	// A panic escaping the run fails the test
+	run(context.Background(), time.Now())
+
+	if !ran {
+		t.Error("run was not called")
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/freshness"
+	"github.com/DeltaLaboratory/postgres-backup/internal/scheduler"
+)
+
+// aliveTimeout bounds how long /healthz waits for the scheduling loop to answer
+const aliveTimeout = 2 * time.Second
+
+// health serves the health, readiness and status endpoints
+type health struct {
+	scheduler *scheduler.Scheduler
+	freshness *freshness.Tracker
+	maxAge    time.Duration
+}
+
+// healthz reports whether the scheduling loop is alive
+func (h *health) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), aliveTimeout)
+	defer cancel()
+
+	if !h.scheduler.Alive(ctx) {
+		http.Error(w, "scheduler is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readyz reports whether the newest backup of every scheduled database is younger than max_age
+func (h *health) readyz(w http.ResponseWriter, _ *http.Request) {
+	ready, databases := h.freshness.Check(time.Now(), h.maxAge)
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, map[string]any{
+		"ready":     ready,
+		"max_age":   h.maxAge.String(),
+		"databases": databases,
+	})
+}
+
+// status reports the last outcome of every job and the freshness of every database
+func (h *health) status(w http.ResponseWriter, _ *http.Request) {
+	ready, databases := h.freshness.Check(time.Now(), h.maxAge)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ready":     ready,
+		"jobs":      h.scheduler.Status(),
+		"databases": databases,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		log.Logger.Debug().Err(err).Str("caller", "http_server").Msg("failed to write response")
+	}
+}
@@ -0,0 +1,75 @@
+// Package server runs the HTTP listener of `schedule run`
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/freshness"
+	"github.com/DeltaLaboratory/postgres-backup/internal/metrics"
+	"github.com/DeltaLaboratory/postgres-backup/internal/scheduler"
+)
+
+// readHeaderTimeout protects the listener from clients that never finish sending their request
+const readHeaderTimeout = 10 * time.Second
+
+// Server serves metrics, health and status while the scheduler runs
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// Start listens on the configured address and serves requests in the background.
+// Readiness is judged from the backups known to tracker.
+func Start(cfg *config.HTTPConfig, s *scheduler.Scheduler, tracker *freshness.Tracker) (*Server, error) {
+	logger := log.Logger.With().Str("caller", "http_server").Logger()
+
+	metrics.Register()
+
+	h := &health{scheduler: s, freshness: tracker, maxAge: cfg.GetMaxAge()}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+cfg.GetMetricsPath(), metrics.Handler())
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
+	mux.HandleFunc("GET /status", h.status)
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+
+	server := &Server{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		listener: listener,
+	}
+
+	go func() {
+		if err := server.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Str("listen", cfg.Listen).Msg("HTTP server stopped unexpectedly")
+		}
+	}()
+
+	logger.Info().
+		Str("listen", listener.Addr().String()).
+		Str("metrics_path", cfg.GetMetricsPath()).
+		Dur("max_age", cfg.GetMaxAge()).
+		Msg("HTTP server started")
+
+	return server, nil
+}
+
+// Shutdown stops accepting requests and waits for active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
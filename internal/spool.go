@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// spoolFile is a temporary copy of a stored backup, it is removed when closed
+type spoolFile struct {
+	*os.File
+}
+
+// spool copies the stored backup, still compressed and encrypted, to a temporary file in TMPDIR
+func spool(reader io.Reader) (*spoolFile, error) {
+	file, err := os.CreateTemp("", "postgres-backup-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	spooled := &spoolFile{File: file}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		spooled.Close()
+		return nil, fmt.Errorf("failed to spool backup: %w", err)
+	}
+
+	if err := spooled.Rewind(); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+
+	return spooled, nil
+}
+
+// Rewind seeks back to the start of the copy
+func (f *spoolFile) Rewind() error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return nil
+}
+
+func (f *spoolFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	return err
+}
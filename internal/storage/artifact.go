@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestSuffix is appended to a backup name to form the name of its manifest sidecar
+const ManifestSuffix = ".manifest.json"
+
+// KeysSuffix is appended to a backup name to form the name of the sidecar holding its wrapped data keys
+const KeysSuffix = ".keys.json"
+
+// SidecarSuffixes lists every sidecar kind that is stored next to a backup
+var SidecarSuffixes = []string{
+	ManifestSuffix,
+	KeysSuffix,
+}
+
+// SidecarReader reads the sidecar with the given suffix of a backup.
+// Sidecars that don't exist yield an error matching fs.ErrNotExist.
+type SidecarReader func(ctx context.Context, suffix string) ([]byte, error)
+
+// GCOptions controls garbage collection of incomplete and orphaned artifacts
+type GCOptions struct {
+	// MinAge protects artifacts younger than this duration, which may still be in progress
+	MinAge time.Duration
+	// DryRun reports garbage without removing it
+	DryRun bool
+}
+
+// Object is a stored file or object considered during garbage collection
+type Object struct {
+	Name         string
+	LastModified time.Time
+	Size         int64
+}
+
+// Garbage is an artifact selected for removal along with the reason it was selected
+type Garbage struct {
+	Name   string
+	Reason string
+}
+
+// IsSidecar reports whether the name belongs to a sidecar rather than to backup data
+func IsSidecar(name string) bool {
+	for _, suffix := range SidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SidecarOwner returns the name of the backup a sidecar belongs to
+func SidecarOwner(name string) string {
+	for _, suffix := range SidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// BackupTimeFormat is the layout of the timestamp backup names start with
+const BackupTimeFormat = "2006-01-02T15:04:05"
+
+// IsBackupName reports whether the filename matches the backup naming pattern
+// Format: 2006-01-02T15:04:05 with optional compression extension
+func IsBackupName(filename string) bool {
+	if IsSidecar(filename) {
+		return false
+	}
+	return len(filename) >= len(BackupTimeFormat) && filename[4] == '-' && filename[7] == '-' && filename[10] == 'T' && filename[13] == ':' && filename[16] == ':'
+}
+
+// IsArtifactName reports whether the base name of the object belongs to a backup or one of its sidecars,
+// so objects of other tools sharing the bucket or directory are left alone
+func IsArtifactName(name string) bool {
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return IsBackupName(SidecarOwner(name))
+}
+
+// TemporaryPattern returns the os.CreateTemp pattern of a file that is written under a temporary name and
+// renamed to name once complete. The name is hidden, so that listings never mistake it for a backup.
+func TemporaryPattern(name string) string {
+	return "." + name + "-*"
+}
+
+// temporaryOwner returns the name of the backup or sidecar a temporary file created with TemporaryPattern
+// is written for, or false if the base name isn't one
+func temporaryOwner(base string) (string, bool) {
+	name, ok := strings.CutPrefix(base, ".")
+	if !ok {
+		return "", false
+	}
+
+	idx := strings.LastIndex(name, "-")
+	if idx < 0 || !IsArtifactName(name[:idx]) {
+		return "", false
+	}
+	return name[:idx], true
+}
+
+// FindGarbage selects zero-byte backups, incomplete backups, temporary files of interrupted writes and
+// sidecars without a backup. Objects modified after cutoff are never selected since they may belong
+// to a running backup.
+//
+// The manifest of a backup is stored once the backup is complete, so a backup without a manifest whose
+// older and newer neighbours in the same directory have one was cut short. Backups without a manifest
+// that were stored before or after manifests were signed are kept.
+func FindGarbage(objects []Object, cutoff time.Time) []Garbage {
+	backups := make(map[string]Object)
+	var sidecars, temporaries []Object
+
+	for _, object := range objects {
+		base := object.Name
+		if idx := strings.LastIndex(base, "/"); idx >= 0 {
+			base = base[idx+1:]
+		}
+
+		switch {
+		case IsSidecar(base):
+			sidecars = append(sidecars, object)
+		case IsBackupName(base):
+			backups[object.Name] = object
+		default:
+			if _, ok := temporaryOwner(base); ok {
+				temporaries = append(temporaries, object)
+			}
+		}
+	}
+
+	manifests := make(map[string]bool)
+	for _, sidecar := range sidecars {
+		if strings.HasSuffix(sidecar.Name, ManifestSuffix) {
+			manifests[SidecarOwner(sidecar.Name)] = true
+		}
+	}
+
+	var garbage []Garbage
+	removed := make(map[string]bool)
+
+	for _, name := range unmanifested(backups, manifests) {
+		if backups[name].LastModified.After(cutoff) || backups[name].Size == 0 {
+			continue
+		}
+		garbage = append(garbage, Garbage{Name: name, Reason: "incomplete backup without manifest"})
+		removed[name] = true
+	}
+
+	for name, backup := range backups {
+		if backup.LastModified.After(cutoff) {
+			continue
+		}
+
+		if backup.Size == 0 {
+			garbage = append(garbage, Garbage{Name: name, Reason: "zero-byte backup"})
+			removed[name] = true
+		}
+	}
+
+	for _, temporary := range temporaries {
+		if !temporary.LastModified.After(cutoff) {
+			garbage = append(garbage, Garbage{Name: temporary.Name, Reason: "temporary file of an interrupted write"})
+		}
+	}
+
+	for _, sidecar := range sidecars {
+		if sidecar.LastModified.After(cutoff) {
+			continue
+		}
+
+		owner := SidecarOwner(sidecar.Name)
+		if _, ok := backups[owner]; !ok || removed[owner] {
+			garbage = append(garbage, Garbage{Name: sidecar.Name, Reason: "sidecar without backup"})
+		}
+	}
+
+	sort.Slice(garbage, func(i, j int) bool {
+		return garbage[i].Name < garbage[j].Name
+	})
+
+	return garbage
+}
+
+// unmanifested returns the backups without a manifest that have an older and a newer backup
+// with a manifest in the same directory. Backup names start with their timestamp, so names
+// sort in the order the backups were taken.
+func unmanifested(backups map[string]Object, manifests map[string]bool) []string {
+	directories := make(map[string][]string)
+	for name := range backups {
+		directory := path.Dir(name)
+		directories[directory] = append(directories[directory], name)
+	}
+
+	var found []string
+	for _, names := range directories {
+		sort.Strings(names)
+
+		first, last := -1, -1
+		for i, name := range names {
+			if manifests[name] {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+
+		for i := first + 1; i < last; i++ {
+			if !manifests[names[i]] {
+				found = append(found, names[i])
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFindGarbage(t *testing.T) {
+	cutoff := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	old := cutoff.Add(-time.Hour)
+	recent := cutoff.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		objects []Object
+		want    []Garbage
+	}{
+		{
+			name:    "empty",
+			objects: nil,
+			want:    nil,
+		},
+		{
+			name: "complete backup",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T00:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: nil,
+		},
+		{
+			name: "backup missing its manifest is kept",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T01:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T01:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: nil,
+		},
+		{
+			name: "zero-byte backup and its sidecars",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst.enc", LastModified: old, Size: 0},
+				{Name: "2025-01-01T00:00:00.zst.enc" + KeysSuffix, LastModified: old, Size: 100},
+				{Name: "2025-01-01T00:00:00.zst.enc" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: []Garbage{
+				{Name: "2025-01-01T00:00:00.zst.enc", Reason: "zero-byte backup"},
+				{Name: "2025-01-01T00:00:00.zst.enc" + KeysSuffix, Reason: "sidecar without backup"},
+				{Name: "2025-01-01T00:00:00.zst.enc" + ManifestSuffix, Reason: "sidecar without backup"},
+			},
+		},
+		{
+			name: "orphaned sidecar",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst.enc" + KeysSuffix, LastModified: old, Size: 100},
+			},
+			want: []Garbage{
+				{Name: "2025-01-01T00:00:00.zst.enc" + KeysSuffix, Reason: "sidecar without backup"},
+			},
+		},
+		{
+			name: "artifacts modified after the cutoff",
+			objects: []Object{
+				{Name: "2025-01-02T01:00:00.zst", LastModified: recent, Size: 0},
+				{Name: "2025-01-02T02:00:00.zst" + KeysSuffix, LastModified: recent, Size: 100},
+			},
+			want: nil,
+		},
+		{
+			name: "recent sidecar of an old zero-byte backup",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst", LastModified: old, Size: 0},
+				{Name: "2025-01-01T00:00:00.zst" + ManifestSuffix, LastModified: recent, Size: 100},
+			},
+			want: []Garbage{
+				{Name: "2025-01-01T00:00:00.zst", Reason: "zero-byte backup"},
+			},
+		},
+		{
+			name: "backups in job directories",
+			objects: []Object{
+				{Name: "nightly/2025-01-01T00:00:00.zst", LastModified: old, Size: 0},
+				{Name: "nightly/2025-01-01T01:00:00.zst", LastModified: old, Size: 10},
+				{Name: "nightly/2025-01-01T01:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+				{Name: "2025-01-01T01:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: []Garbage{
+				{Name: "2025-01-01T01:00:00.zst" + ManifestSuffix, Reason: "sidecar without backup"},
+				{Name: "nightly/2025-01-01T00:00:00.zst", Reason: "zero-byte backup"},
+			},
+		},
+		{
+			name: "backup without manifest between backups with one",
+			objects: []Object{
+				{Name: "app/2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "app/2025-01-01T00:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+				{Name: "app/2025-01-01T01:00:00.zst.enc", LastModified: old, Size: 5},
+				{Name: "app/2025-01-01T01:00:00.zst.enc" + KeysSuffix, LastModified: old, Size: 100},
+				{Name: "app/2025-01-01T02:00:00.zst", LastModified: old, Size: 10},
+				{Name: "app/2025-01-01T02:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: []Garbage{
+				{Name: "app/2025-01-01T01:00:00.zst.enc", Reason: "incomplete backup without manifest"},
+				{Name: "app/2025-01-01T01:00:00.zst.enc" + KeysSuffix, Reason: "sidecar without backup"},
+			},
+		},
+		{
+			name: "backups without manifest before and after manifests were signed are kept",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T01:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T01:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+				{Name: "2025-01-01T02:00:00.zst", LastModified: old, Size: 10},
+			},
+			want: nil,
+		},
+		{
+			name: "neighbours with a manifest in another directory",
+			objects: []Object{
+				{Name: "app/2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "app/2025-01-01T00:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+				{Name: "billing/2025-01-01T01:00:00.zst", LastModified: old, Size: 10},
+				{Name: "app/2025-01-01T02:00:00.zst", LastModified: old, Size: 10},
+				{Name: "app/2025-01-01T02:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+			},
+			want: nil,
+		},
+		{
+			name: "recent backup without manifest between backups with one",
+			objects: []Object{
+				{Name: "2025-01-01T00:00:00.zst", LastModified: old, Size: 10},
+				{Name: "2025-01-01T00:00:00.zst" + ManifestSuffix, LastModified: old, Size: 100},
+				{Name: "2025-01-02T01:00:00.zst", LastModified: recent, Size: 10},
+				{Name: "2025-01-02T02:00:00.zst", LastModified: recent, Size: 10},
+				{Name: "2025-01-02T02:00:00.zst" + ManifestSuffix, LastModified: recent, Size: 100},
+			},
+			want: nil,
+		},
+		{
+			name: "temporary files of interrupted writes",
+			objects: []Object{
+				{Name: "nightly/.2025-01-01T00:00:00.zst-123456", LastModified: old, Size: 10},
+				{Name: ".2025-01-01T00:00:00.zst" + ManifestSuffix + "-654321", LastModified: old, Size: 50},
+				{Name: ".2025-01-02T01:00:00.zst-111111", LastModified: recent, Size: 10},
+			},
+			want: []Garbage{
+				{Name: ".2025-01-01T00:00:00.zst" + ManifestSuffix + "-654321", Reason: "temporary file of an interrupted write"},
+				{Name: "nightly/.2025-01-01T00:00:00.zst-123456", Reason: "temporary file of an interrupted write"},
+			},
+		},
+		{
+			name: "objects of other tools",
+			objects: []Object{
+				{Name: "README", LastModified: old, Size: 0},
+				{Name: ".locks/backup-0.lock", LastModified: old, Size: 0},
+				{Name: "other/data.json", LastModified: old, Size: 0},
+				{Name: ".cache-123", LastModified: old, Size: 10},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindGarbage(tt.objects, cutoff)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindGarbage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsArtifactName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "2025-01-01T00:00:00.zst", want: true},
+		{name: "prefix/nightly/2025-01-01T00:00:00.zst.enc", want: true},
+		{name: "2025-01-01T00:00:00.zst.enc" + KeysSuffix, want: true},
+		{name: "prefix/2025-01-01T00:00:00" + ManifestSuffix, want: true},
+		{name: ".locks/backup-0.lock", want: false},
+		{name: "2025-01-01T00:00:00/data.bin", want: false},
+		{name: "other-tool/archive.tar", want: false},
+		{name: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsArtifactName(tt.name); got != tt.want {
+				t.Errorf("IsArtifactName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
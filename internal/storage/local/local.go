@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"time"
@@ -15,94 +17,151 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
 )
 
-// Upload saves the backup to local storage
-func Upload(ctx context.Context, reader io.Reader) error {
+// Upload saves the backup to local storage under name, which is relative to the backend root
+// as returned by target.Name
+func Upload(ctx context.Context, reader io.Reader, target storage.Target, name string) error {
 	logger := log.Logger.With().Str("caller", "local_upload").Logger()
 
 	if config.Loaded.Storage.Local == nil {
 		return errors.New("local: config is not present")
 	}
 
+	directory := filepath.Join(config.Loaded.Storage.Local.Directory, filepath.FromSlash(path.Dir(name)))
+
 	// Ensure directory exists
-	if err := os.MkdirAll(config.Loaded.Storage.Local.Directory, 0755); err != nil {
+	if err := os.MkdirAll(directory, 0755); err != nil {
 		return fmt.Errorf("local: failed to create directory: %w", err)
 	}
 
 	logger.Info().
-		Str("directory", config.Loaded.Storage.Local.Directory).
+		Str("directory", directory).
 		Msg("starting upload to local storage")
 
-	filename := time.Now().Format("2006-01-02T15:04:05")
-
-	if config.Loaded.Compress != nil {
-		filename = fmt.Sprintf("%s.%s", filename, config.Loaded.Compress.Algorithm)
-	}
-	filepath := filepath.Join(config.Loaded.Storage.Local.Directory, filename)
+	filepath := filepath.Join(directory, path.Base(name))
 
-	file, err := os.Create(filepath)
+	// Written under a temporary name and renamed once complete, so that an interrupted upload never
+	// leaves a partial backup behind that looks like a complete one
+	file, err := os.CreateTemp(directory, storage.TemporaryPattern(path.Base(name)))
 	if err != nil {
 		return fmt.Errorf("local: failed to create file: %w", err)
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
-	bytesWritten, err := io.Copy(file, reader)
+	bytesWritten, err := io.Copy(file, contextReader{ctx: ctx, reader: reader})
 	if err != nil {
+		file.Close()
+		return fmt.Errorf("local: failed to write backup: %w", err)
+	}
+	if err := file.Close(); err != nil {
 		return fmt.Errorf("local: failed to write backup: %w", err)
 	}
 
+	if err := os.Rename(file.Name(), filepath); err != nil {
+		return fmt.Errorf("local: failed to store backup: %w", err)
+	}
+
 	logger.Info().
 		Str("file", filepath).
 		Str("directory", config.Loaded.Storage.Local.Directory).
 		Str("size", fmt.Sprintf("%d bytes", bytesWritten)).
 		Msg("backup successfully uploaded to local storage")
 
-	// Run retention cleanup after successful upload
-	if err := CleanupRetention(ctx); err != nil {
-		logger.Warn().Err(err).Msg("failed to cleanup old local backups during retention policy enforcement")
+	// Run retention cleanup after successful upload, unless a retention schedule takes care of it
+	if config.Loaded.Storage.Local.IsRetentionOnUpload() {
+		if err := CleanupRetention(ctx, target); err != nil {
+			logger.Warn().Err(err).Msg("failed to cleanup old local backups during retention policy enforcement")
+		}
 	}
 
 	return nil
 }
 
+// contextReader stops reading once the context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
 // BackupInfo represents a local backup file with its metadata
 type BackupInfo struct {
-	Path         string
+	Path string
+	// Name is the path of the backup relative to the storage directory, using forward slashes
+	Name         string
 	LastModified time.Time
 	Size         int64
 }
 
-// ListBackups lists all backup files in the local directory
+// ListBackups lists all backup files in the local directory, including those of backup jobs in subdirectories
 func ListBackups() ([]BackupInfo, error) {
+	return listBackups("", true)
+}
+
+// ListTargetBackups lists the backup files written to the target, newest first
+func ListTargetBackups(target storage.Target) ([]BackupInfo, error) {
+	// Only backups directly inside the target belong to it, nested directories belong to backup jobs
+	return listBackups(target.Path, false)
+}
+
+// listBackups lists the backup files in a subdirectory of the local directory.
+// Nested directories are only searched when recursive is set.
+func listBackups(subdirectory string, recursive bool) ([]BackupInfo, error) {
 	var backups []BackupInfo
 
-	entries, err := os.ReadDir(config.Loaded.Storage.Local.Directory)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
-	}
+	directory := config.Loaded.Storage.Local.Directory
+	root := filepath.Join(directory, filepath.FromSlash(subdirectory))
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// A target that has not been written to yet has no directory
+			if path == root && !recursive && errors.Is(err, os.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
 
-	for _, entry := range entries {
 		if entry.IsDir() {
-			continue
+			if path != root && !recursive {
+				return fs.SkipDir
+			}
+			return nil
 		}
 
 		// Only process files that match backup naming pattern (timestamp-based)
-		// Format: 2006-01-02T15:04:05 with optional compression extension
-		filename := entry.Name()
-		if len(filename) >= 19 && filename[4] == '-' && filename[7] == '-' && filename[10] == 'T' && filename[13] == ':' && filename[16] == ':' {
-			fullPath := filepath.Join(config.Loaded.Storage.Local.Directory, entry.Name())
-			info, err := entry.Info()
-			if err != nil {
-				continue // Skip files we can't stat
-			}
+		if !storage.IsBackupName(entry.Name()) {
+			return nil
+		}
 
-			backups = append(backups, BackupInfo{
-				Path:         fullPath,
-				LastModified: info.ModTime(),
-				Size:         info.Size(),
-			})
+		info, err := entry.Info()
+		if err != nil {
+			return nil // Skip files we can't stat
+		}
+
+		name, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
 		}
+
+		backups = append(backups, BackupInfo{
+			Path:         path,
+			Name:         filepath.ToSlash(name),
+			LastModified: info.ModTime(),
+			Size:         info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	// Sort by last modified time (newest first)
@@ -113,34 +172,43 @@ func ListBackups() ([]BackupInfo, error) {
 	return backups, nil
 }
 
-// CleanupRetention removes old backups based on retention policy
-func CleanupRetention(_ context.Context) error {
+// CleanupRetention removes old backups of the target based on its retention policy
+func CleanupRetention(ctx context.Context, target storage.Target) error {
+	deleted, err := cleanupRetention(ctx, target)
+	event.Publish(event.RetentionFinished{Backend: event.BackendLocal, Path: target.Path, Deleted: deleted, Err: err})
+	return err
+}
+
+// cleanupRetention applies the retention policy of the target and returns the number of deleted backups
+func cleanupRetention(_ context.Context, target storage.Target) (int, error) {
 	logger := log.Logger.With().Str("caller", "local_retention_cleanup").Logger()
 
 	if config.Loaded.Storage.Local == nil {
-		return nil // No local configuration
+		return 0, nil // No local configuration
 	}
 
+	retention := target.GetRetention(config.Loaded.Storage.Local.GetRetention())
+
 	// Check if any retention policy is configured
-	if !config.Loaded.Storage.Local.IsRetentionConfigured() {
-		logger.Debug().Msg("no local retention policy configured, skipping cleanup")
-		return nil // No retention policy configured
+	if !retention.IsRetentionConfigured() {
+		logger.Debug().Str("path", target.Path).Msg("no local retention policy configured, skipping cleanup")
+		return 0, nil // No retention policy configured
 	}
 
 	// Get effective retention days (handles both numeric and string periods)
-	effectiveRetentionDays, err := config.Loaded.Storage.Local.GetEffectiveRetentionDays()
+	effectiveRetentionDays, err := retention.GetEffectiveRetentionDays()
 	if err != nil {
-		return fmt.Errorf("failed to parse local retention period: %w", err)
+		return 0, fmt.Errorf("failed to parse local retention period: %w", err)
 	}
 
-	retentionCount := config.Loaded.Storage.Local.RetentionCount
+	retentionCount := retention.Count
 
 	// Log the retention policy being applied
-	logEvent := logger.Info().Str("directory", config.Loaded.Storage.Local.Directory)
+	logEvent := logger.Info().Str("directory", config.Loaded.Storage.Local.Directory).Str("path", target.Path)
 	if effectiveRetentionDays > 0 {
 		logEvent = logEvent.Int("retention_days", effectiveRetentionDays)
-		if config.Loaded.Storage.Local.RetentionPeriod != nil {
-			logEvent = logEvent.Str("retention_period", *config.Loaded.Storage.Local.RetentionPeriod)
+		if retention.Period != nil {
+			logEvent = logEvent.Str("retention_period", *retention.Period)
 		}
 	}
 	if retentionCount != nil {
@@ -148,9 +216,9 @@ func CleanupRetention(_ context.Context) error {
 	}
 	logEvent.Msg("starting local retention cleanup")
 
-	backups, err := ListBackups()
+	backups, err := ListTargetBackups(target)
 	if err != nil {
-		return fmt.Errorf("failed to list backups: %w", err)
+		return 0, fmt.Errorf("failed to list backups: %w", err)
 	}
 
 	var toDelete []string
@@ -183,6 +251,7 @@ func CleanupRetention(_ context.Context) error {
 	}
 
 	// Delete the marked backups
+	deleted := 0
 	for _, path := range toDelete {
 		err := os.Remove(path)
 		if err != nil {
@@ -195,6 +264,16 @@ func CleanupRetention(_ context.Context) error {
 				Str("path", path).
 				Str("directory", config.Loaded.Storage.Local.Directory).
 				Msg("deleted old local backup")
+			deleted++
+
+			// Sidecars are of no use without their backup
+			for _, suffix := range storage.SidecarSuffixes {
+				if err := RemoveSidecar(path, suffix); err != nil {
+					logger.Warn().Err(err).
+						Str("path", path).
+						Msg("failed to delete sidecar of old local backup, garbage collection removes it")
+				}
+			}
 		}
 	}
 
@@ -209,7 +288,97 @@ func CleanupRetention(_ context.Context) error {
 			Msg("local retention cleanup completed - no backups to delete")
 	}
 
-	return nil
+	return deleted, nil
+}
+
+// GarbageCollect removes incomplete, temporary and orphaned files left behind by interrupted backups
+func GarbageCollect(_ context.Context, opts storage.GCOptions) (int, error) {
+	logger := log.Logger.With().Str("caller", "local_garbage_collect").Logger()
+
+	if config.Loaded.Storage.Local == nil {
+		return 0, nil // No local configuration
+	}
+
+	directory := config.Loaded.Storage.Local.Directory
+
+	logger.Info().
+		Str("directory", directory).
+		Bool("dry_run", opts.DryRun).
+		Dur("min_age", opts.MinAge).
+		Msg("starting local garbage collection")
+
+	if _, err := os.Stat(directory); errors.Is(err, os.ErrNotExist) {
+		logger.Info().Str("directory", directory).Msg("local backup directory does not exist yet, nothing to collect")
+		return 0, nil
+	}
+
+	var objects []storage.Object
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil // Skip files we can't stat
+		}
+
+		name, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, storage.Object{
+			Name:         filepath.ToSlash(name),
+			LastModified: info.ModTime(),
+			Size:         info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	garbage := storage.FindGarbage(objects, time.Now().Add(-opts.MinAge))
+
+	removed := 0
+	for _, item := range garbage {
+		path := filepath.Join(directory, filepath.FromSlash(item.Name))
+
+		if opts.DryRun {
+			logger.Info().
+				Str("path", path).
+				Str("reason", item.Reason).
+				Msg("would remove local artifact (dry run)")
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			logger.Error().Err(err).
+				Str("path", path).
+				Str("reason", item.Reason).
+				Msg("failed to remove local artifact during garbage collection")
+			continue
+		}
+
+		logger.Info().
+			Str("path", path).
+			Str("reason", item.Reason).
+			Msg("removed local artifact")
+		removed++
+	}
+
+	logger.Info().
+		Int("found_count", len(garbage)).
+		Int("removed_count", removed).
+		Str("directory", directory).
+		Msg("local garbage collection completed")
+
+	return len(garbage), nil
 }
 
 // OpenBackup opens a local backup file and returns an io.ReadCloser
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+// BackupPath returns the path of the file holding the backup name, which is relative to the backend root
+func BackupPath(name string) string {
+	return filepath.Join(config.Loaded.Storage.Local.Directory, filepath.FromSlash(name))
+}
+
+// ReadSidecar reads the sidecar with the given suffix of the backup file at path
+func ReadSidecar(path, suffix string) ([]byte, error) {
+	data, err := os.ReadFile(path + suffix)
+	if err != nil {
+		return nil, fmt.Errorf("local: failed to read sidecar: %w", err)
+	}
+
+	return data, nil
+}
+
+// WriteSidecar stores the sidecar with the given suffix of the backup file at path. The sidecar is replaced
+// atomically, so an interrupted write never leaves a truncated sidecar behind.
+func WriteSidecar(path, suffix string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("local: failed to create directory: %w", err)
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(path), storage.TemporaryPattern(filepath.Base(path)+suffix))
+	if err != nil {
+		return fmt.Errorf("local: failed to create sidecar: %w", err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		return fmt.Errorf("local: failed to write sidecar: %w", err)
+	}
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("local: failed to write sidecar: %w", err)
+	}
+
+	if err := os.Rename(temporary.Name(), path+suffix); err != nil {
+		return fmt.Errorf("local: failed to store sidecar: %w", err)
+	}
+
+	return nil
+}
+
+// SidecarReader returns a reader for the sidecars of the backup file at path
+func SidecarReader(path string) storage.SidecarReader {
+	return func(_ context.Context, suffix string) ([]byte, error) {
+		return ReadSidecar(path, suffix)
+	}
+}
+
+// RemoveSidecar removes the sidecar with the given suffix of the backup file at path, a missing sidecar is not an error
+func RemoveSidecar(path, suffix string) error {
+	if err := os.Remove(path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("local: failed to remove sidecar: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// skipTLSVerifyWarning warns once per process, clients are created for every operation
+var skipTLSVerifyWarning sync.Once
+
+// CreateClient creates and configures an S3 client, every S3 client is created here
+func CreateClient() (*minio.Client, error) {
+	if config.Loaded.Storage.S3 == nil {
+		return nil, errors.New("s3: config is not present")
+	}
+
+	settings := config.Loaded.Storage.S3
+
+	transport, err := createTransport(settings)
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to create client: %w", err)
+	}
+
+	client, err := minio.New(settings.Endpoint, &minio.Options{
+		Creds:        getCredentials(),
+		Region:       settings.GetRegion(),
+		Secure:       !settings.IsInsecure(),
+		Transport:    transport,
+		BucketLookup: bucketLookup(settings.GetBucketLookup()),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to create client: %w", err)
+	}
+
+	if config.Loaded.IsVerbose() {
+		client.TraceOn(log.Logger)
+	}
+
+	return client, nil
+}
+
+// createTransport creates the transport of the client, it trusts ca_file and honours skip_tls_verify
+func createTransport(settings *configstorage.S3Storage) (http.RoundTripper, error) {
+	transport, err := minio.DefaultTransport(!settings.IsInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.IsInsecure() {
+		return transport, nil
+	}
+
+	rootCAs, err := settings.GetRootCAs()
+	if err != nil {
+		return nil, err
+	}
+	if rootCAs != nil {
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+
+	if settings.IsSkipTLSVerify() {
+		skipTLSVerifyWarning.Do(func() {
+			log.Logger.Warn().Str("caller", "s3_client").
+				Str("endpoint", settings.Endpoint).
+				Msg("TLS certificate verification of the S3 endpoint is disabled")
+		})
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	return transport, nil
+}
+
+func bucketLookup(lookup string) minio.BucketLookupType {
+	switch lookup {
+	case configstorage.BucketLookupPath:
+		return minio.BucketLookupPath
+	case configstorage.BucketLookupDNS:
+		return minio.BucketLookupDNS
+	default:
+		return minio.BucketLookupAuto
+	}
+}
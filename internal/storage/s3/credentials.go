@@ -0,0 +1,201 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// metadataTimeout bounds requests to the instance metadata endpoint, which doesn't answer outside of AWS
+const metadataTimeout = 2 * time.Second
+
+var (
+	// s3Credentials is shared by all clients, so providers are resolved once and refreshed when they expire
+	s3Credentials     *credentials.Credentials
+	s3CredentialsOnce sync.Once
+)
+
+// getCredentials returns the credentials of the configured provider
+func getCredentials() *credentials.Credentials {
+	s3CredentialsOnce.Do(func() {
+		settings := config.Loaded.Storage.S3
+
+		names := []string{settings.GetCredentialsProvider()}
+		if names[0] == configstorage.CredentialsChain {
+			names = configstorage.CredentialsChainOrder
+		}
+
+		chain := &providerChain{}
+		for _, name := range names {
+			chain.providers = append(chain.providers, namedProvider{name: name, provider: newProvider(name, settings)})
+		}
+		s3Credentials = credentials.New(chain)
+	})
+
+	return s3Credentials
+}
+
+// newProvider creates the credentials provider with the given name
+func newProvider(name string, settings *configstorage.S3Storage) credentials.Provider {
+	options := settings.Credentials
+	if options == nil {
+		options = &configstorage.S3Credentials{}
+	}
+
+	switch name {
+	case configstorage.CredentialsEnv:
+		return &credentials.EnvAWS{}
+	case configstorage.CredentialsFile:
+		return &credentials.FileAWSCredentials{
+			Filename: stringOrEmpty(options.SharedCredentialsFile),
+			Profile:  stringOrEmpty(options.Profile),
+		}
+	case configstorage.CredentialsWebIdentity:
+		return newWebIdentityProvider(settings, options)
+	case configstorage.CredentialsMetadata:
+		return &credentials.IAM{
+			Client:   &http.Client{Timeout: metadataTimeout},
+			Endpoint: stringOrEmpty(options.MetadataEndpoint),
+		}
+	default:
+		return &credentials.Static{Value: credentials.Value{
+			AccessKeyID:     settings.AccessKey,
+			SecretAccessKey: settings.SecretKey,
+			SignerType:      credentials.SignatureV4,
+		}}
+	}
+}
+
+// newWebIdentityProvider exchanges a web identity token, as mounted by EKS for IRSA, for credentials of a role
+func newWebIdentityProvider(settings *configstorage.S3Storage, options *configstorage.S3Credentials) credentials.Provider {
+	tokenFile := stringOrEmpty(options.WebIdentityTokenFile)
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	roleARN := stringOrEmpty(options.RoleARN)
+	if roleARN == "" {
+		roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+
+	endpoint := stringOrEmpty(options.STSEndpoint)
+	if endpoint == "" {
+		endpoint = stsEndpoint(settings.GetRegion())
+	}
+
+	return &credentials.STSWebIdentity{
+		STSEndpoint: endpoint,
+		RoleARN:     roleARN,
+		GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+			if tokenFile == "" {
+				return nil, errors.New("no web identity token file, set web_identity_token_file or AWS_WEB_IDENTITY_TOKEN_FILE")
+			}
+
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return nil, err
+			}
+
+			return &credentials.WebIdentityToken{Token: strings.TrimSpace(string(token))}, nil
+		},
+	}
+}
+
+// stsEndpoint returns the AWS STS endpoint of the region, AWS_REGION takes precedence like in the AWS SDKs
+func stsEndpoint(region string) string {
+	if env := os.Getenv("AWS_REGION"); env != "" {
+		region = env
+	}
+
+	switch {
+	case region == "" || region == "auto":
+		return credentials.DefaultSTSRoleEndpoint
+	case strings.HasPrefix(region, "cn-"):
+		return "https://sts." + region + ".amazonaws.com.cn"
+	default:
+		return "https://sts." + region + ".amazonaws.com"
+	}
+}
+
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+type namedProvider struct {
+	name     string
+	provider credentials.Provider
+}
+
+// providerChain uses the first provider that supplies credentials. Unlike the chain of minio-go it fails
+// instead of falling back to anonymous requests, and it logs which provider supplied the credentials.
+type providerChain struct {
+	providers []namedProvider
+
+	current *namedProvider
+	logged  string
+}
+
+func (c *providerChain) RetrieveWithCredContext(cc *credentials.CredContext) (credentials.Value, error) {
+	var errs []error
+	for i := range c.providers {
+		p := &c.providers[i]
+
+		value, err := p.provider.RetrieveWithCredContext(cc)
+		if err == nil && (value.AccessKeyID == "" || value.SecretAccessKey == "") {
+			err = errors.New("no credentials found")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+			continue
+		}
+
+		c.current = p
+		if c.logged != p.name {
+			c.logged = p.name
+			event := log.Logger.Info().Str("caller", "s3_credentials").
+				Str("provider", p.name)
+			if !value.Expiration.IsZero() {
+				event = event.Time("expiration", value.Expiration)
+			}
+			event.Msg("S3 credentials supplied by provider")
+		}
+
+		return value, nil
+	}
+
+	c.current = nil
+	return credentials.Value{}, fmt.Errorf("s3: no credentials provider supplied credentials: %w", errors.Join(errs...))
+}
+
+func (c *providerChain) Retrieve() (credentials.Value, error) {
+	return c.RetrieveWithCredContext(nil)
+}
+
+func (c *providerChain) IsExpired() bool {
+	return c.current == nil || c.current.provider.IsExpired()
+}
+
+// CheckCredentials resolves the S3 credentials, so a missing provider fails at startup and not at the first upload
+func CheckCredentials() error {
+	client, err := CreateClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = getCredentials().GetWithContext(client.CredContext())
+	return err
+}
@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// stubProvider supplies fixed credentials and records that it was asked for them
+type stubProvider struct {
+	name    string
+	value   credentials.Value
+	err     error
+	expired bool
+	calls   *[]string
+}
+
+func (p *stubProvider) RetrieveWithCredContext(*credentials.CredContext) (credentials.Value, error) {
+	*p.calls = append(*p.calls, p.name)
+	return p.value, p.err
+}
+
+func (p *stubProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithCredContext(nil)
+}
+
+func (p *stubProvider) IsExpired() bool {
+	return p.expired
+}
+
+func TestProviderChain(t *testing.T) {
+	supplied := credentials.Value{AccessKeyID: "access", SecretAccessKey: "secret"}
+
+	tests := []struct {
+		name      string
+		providers []stubProvider
+		want      credentials.Value
+		wantCalls []string
+		wantErr   []string
+	}{
+		{
+			name: "first provider supplies credentials",
+			providers: []stubProvider{
+				{name: "env", value: supplied},
+				{name: "file", value: credentials.Value{AccessKeyID: "other", SecretAccessKey: "other"}},
+			},
+			want:      supplied,
+			wantCalls: []string{"env"},
+		},
+		{
+			name: "providers are asked in order until one supplies credentials",
+			providers: []stubProvider{
+				{name: "env", err: errors.New("AWS_ACCESS_KEY_ID not set")},
+				{name: "file", err: errors.New("no such file")},
+				{name: "metadata", value: supplied},
+				{name: "static", value: supplied},
+			},
+			want:      supplied,
+			wantCalls: []string{"env", "file", "metadata"},
+		},
+		{
+			name: "empty credentials are skipped",
+			providers: []stubProvider{
+				{name: "env", value: credentials.Value{AccessKeyID: "access"}},
+				{name: "file", value: supplied},
+			},
+			want:      supplied,
+			wantCalls: []string{"env", "file"},
+		},
+		{
+			name: "fails instead of going anonymous",
+			providers: []stubProvider{
+				{name: "env", err: errors.New("AWS_ACCESS_KEY_ID not set")},
+				{name: "static", value: credentials.Value{SignerType: credentials.SignatureAnonymous}},
+			},
+			wantCalls: []string{"env", "static"},
+			wantErr:   []string{"no credentials provider supplied credentials", "env: AWS_ACCESS_KEY_ID not set", "static: no credentials found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			chain := &providerChain{}
+			for i := range tt.providers {
+				p := &tt.providers[i]
+				p.calls = &calls
+				chain.providers = append(chain.providers, namedProvider{name: p.name, provider: p})
+			}
+
+			got, err := chain.Retrieve()
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("providers asked = %v, want %v", calls, tt.wantCalls)
+			}
+
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("Retrieve() = %+v, want an error", got)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Retrieve() error = %v, want %q", err, want)
+					}
+				}
+				if !chain.IsExpired() {
+					t.Error("IsExpired() = false after no provider supplied credentials")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Retrieve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderChainExpiry(t *testing.T) {
+	var calls []string
+	env := &stubProvider{name: "env", err: errors.New("not set"), calls: &calls}
+	metadata := &stubProvider{name: "metadata", value: credentials.Value{AccessKeyID: "access", SecretAccessKey: "secret"}, calls: &calls}
+	chain := &providerChain{providers: []namedProvider{{name: "env", provider: env}, {name: "metadata", provider: metadata}}}
+
+	if !chain.IsExpired() {
+		t.Error("IsExpired() = false before credentials were retrieved")
+	}
+
+	if _, err := chain.Retrieve(); err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if chain.IsExpired() {
+		t.Error("IsExpired() = true while the supplying provider is not expired")
+	}
+
+	metadata.expired = true
+	if !chain.IsExpired() {
+		t.Error("IsExpired() = false while the supplying provider is expired")
+	}
+}
+
+func TestSTSEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		region    string
+		envRegion string
+		want      string
+	}{
+		{name: "no region", want: credentials.DefaultSTSRoleEndpoint},
+		{name: "auto region", region: "auto", want: credentials.DefaultSTSRoleEndpoint},
+		{name: "regional endpoint", region: "eu-west-1", want: "https://sts.eu-west-1.amazonaws.com"},
+		{name: "china region", region: "cn-north-1", want: "https://sts.cn-north-1.amazonaws.com.cn"},
+		{name: "AWS_REGION takes precedence", region: "eu-west-1", envRegion: "us-east-2", want: "https://sts.us-east-2.amazonaws.com"},
+		{name: "AWS_REGION without a configured region", envRegion: "cn-northwest-1", want: "https://sts.cn-northwest-1.amazonaws.com.cn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", tt.envRegion)
+
+			if got := stsEndpoint(tt.region); got != tt.want {
+				t.Errorf("stsEndpoint(%q) = %q, want %q", tt.region, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// applyObjectLock locks the object written with opts as configured, the object must be written in full
+// with a Content-MD5, which S3 requires for locked objects
+func applyObjectLock(opts *minio.PutObjectOptions, now time.Time) {
+	lock := config.Loaded.Storage.S3.ObjectLock
+	if lock == nil {
+		return
+	}
+
+	if retainUntil := lock.GetRetainUntil(now); !retainUntil.IsZero() {
+		opts.RetainUntilDate = retainUntil
+		if lock.GetMode() == configstorage.ObjectLockCompliance {
+			opts.Mode = minio.Compliance
+		} else {
+			opts.Mode = minio.Governance
+		}
+	}
+
+	if lock.IsLegalHold() {
+		opts.LegalHold = minio.LegalHoldEnabled
+	}
+}
+
+// objectLockStatus is the lock state of a stored object
+type objectLockStatus struct {
+	mode        string
+	retainUntil time.Time
+	legalHold   bool
+	versionID   string
+}
+
+// locked reports whether the object can't be deleted yet
+func (s objectLockStatus) locked(now time.Time) bool {
+	return s.legalHold || s.retainUntil.After(now)
+}
+
+// getObjectLock reads the lock state of the object stored under key
+// Without object_lock there is nothing to read, objects are stored unlocked.
+func getObjectLock(ctx context.Context, client *minio.Client, key string) (objectLockStatus, error) {
+	if config.Loaded.Storage.S3.ObjectLock == nil {
+		return objectLockStatus{}, nil
+	}
+
+	sse, err := ReadEncryption()
+	if err != nil {
+		return objectLockStatus{}, err
+	}
+
+	stat, err := client.StatObject(ctx, config.Loaded.Storage.S3.Bucket, key, minio.StatObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		return objectLockStatus{}, fmt.Errorf("s3: failed to stat %s: %w", key, err)
+	}
+
+	status := objectLockStatus{
+		mode:      strings.ToLower(stat.Metadata.Get("X-Amz-Object-Lock-Mode")),
+		legalHold: strings.EqualFold(stat.Metadata.Get("X-Amz-Object-Lock-Legal-Hold"), string(minio.LegalHoldEnabled)),
+		versionID: stat.VersionID,
+	}
+
+	if raw := stat.Metadata.Get("X-Amz-Object-Lock-Retain-Until-Date"); raw != "" {
+		status.retainUntil, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return objectLockStatus{}, fmt.Errorf("s3: %s has an invalid retain-until date '%s': %w", key, raw, err)
+		}
+	}
+
+	return status, nil
+}
+
+// removeOptions returns the options objects are removed with. With Object Lock the bucket is versioned,
+// so the version is removed for good instead of being hidden behind a delete marker.
+func removeOptions(status objectLockStatus) minio.RemoveObjectOptions {
+	if config.Loaded.Storage.S3.ObjectLock == nil {
+		return minio.RemoveObjectOptions{}
+	}
+
+	return minio.RemoveObjectOptions{VersionID: status.versionID}
+}
+
+// CheckObjectLock checks that the bucket has object locking enabled when backups are to be locked
+func CheckObjectLock(ctx context.Context) error {
+	logger := log.Logger.With().Str("caller", "s3_check_object_lock").Logger()
+
+	lock := config.Loaded.Storage.S3.ObjectLock
+	if lock == nil {
+		return nil
+	}
+
+	client, err := CreateClient()
+	if err != nil {
+		return err
+	}
+
+	bucket := config.Loaded.Storage.S3.Bucket
+
+	enabled, mode, validity, unit, err := client.GetObjectLockConfig(ctx, bucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+			return fmt.Errorf("s3: bucket %s does not have object locking enabled, which object_lock requires", bucket)
+		}
+		return fmt.Errorf("s3: failed to read object lock configuration of bucket %s: %w", bucket, err)
+	}
+	if enabled != "Enabled" {
+		return fmt.Errorf("s3: bucket %s does not have object locking enabled, which object_lock requires", bucket)
+	}
+
+	event := logger.Info().
+		Str("bucket", bucket).
+		Str("mode", lock.GetMode()).
+		Bool("legal_hold", lock.IsLegalHold())
+	if lock.Period != nil {
+		event = event.Str("period", *lock.Period)
+	}
+	if mode != nil && validity != nil && unit != nil {
+		event = event.
+			Str("bucket_default_mode", mode.String()).
+			Str("bucket_default_validity", fmt.Sprintf("%d %s", *validity, unit.String()))
+	}
+	event.Msg("backups are locked with S3 Object Lock")
+
+	return nil
+}
+
+// CheckBucket checks at startup that credentials are available and that the bucket accepts backups
+// written with the configured server-side encryption and object lock settings
+func CheckBucket(ctx context.Context) error {
+	if err := CheckCredentials(); err != nil {
+		return err
+	}
+
+	return errors.Join(CheckServerSideEncryption(ctx), CheckObjectLock(ctx))
+}
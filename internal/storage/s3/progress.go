@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// progressInterval is how often the progress of a running upload is logged
+const progressInterval = 30 * time.Second
+
+// progressReader counts the bytes the upload read, it is read from the goroutines of parallel uploads
+type progressReader struct {
+	reader  io.Reader
+	read    atomic.Int64
+	started time.Time
+}
+
+func newProgressReader(reader io.Reader) *progressReader {
+	return &progressReader{reader: reader, started: time.Now()}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+// throughput returns the average MiB per second since the upload started
+func (r *progressReader) throughput() float64 {
+	elapsed := time.Since(r.started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.read.Load()) / (1 << 20) / elapsed
+}
+
+// report logs the progress every progressInterval until ctx is done
+func (r *progressReader) report(ctx context.Context, logger zerolog.Logger) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logger.Info().
+				Int64("uploaded_bytes", r.read.Load()).
+				Dur("elapsed", time.Since(r.started)).
+				Float64("throughput_mib_s", r.throughput()).
+				Msg("S3 upload in progress")
+		}
+	}
+}
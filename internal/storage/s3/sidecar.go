@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+)
+
+// ReadSidecar reads the sidecar with the given suffix of the backup stored under key
+func ReadSidecar(ctx context.Context, client *minio.Client, key, suffix string) ([]byte, error) {
+	sse, err := ReadEncryption()
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(ctx, config.Loaded.Storage.S3.Bucket, key+suffix, minio.GetObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to get sidecar %s: %w", key+suffix, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("s3: sidecar %s: %w", key+suffix, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("s3: failed to read sidecar %s: %w", key+suffix, err)
+	}
+
+	return data, nil
+}
+
+// WriteSidecar stores the sidecar with the given suffix of the backup stored under key, replacing any previous one
+func WriteSidecar(ctx context.Context, client *minio.Client, key, suffix string, data []byte) error {
+	sse, err := WriteEncryption()
+	if err != nil {
+		return err
+	}
+
+	// Sidecars are locked like backups, a backup is of no use without its keys
+	opts := minio.PutObjectOptions{
+		ContentType:          "application/json",
+		SendContentMd5:       true,
+		ServerSideEncryption: sse,
+	}
+	applyObjectLock(&opts, time.Now())
+
+	_, err = client.PutObject(ctx, config.Loaded.Storage.S3.Bucket, key+suffix, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return fmt.Errorf("s3: failed to store sidecar %s: %w", key+suffix, err)
+	}
+
+	return nil
+}
+
+// RemoveSidecar removes the sidecar with the given suffix of the backup stored under key.
+// Sidecars still under an Object Lock retention can't be removed.
+func RemoveSidecar(ctx context.Context, client *minio.Client, key, suffix string) error {
+	if err := client.RemoveObject(ctx, config.Loaded.Storage.S3.Bucket, key+suffix, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("s3: failed to remove sidecar %s: %w", key+suffix, err)
+	}
+
+	return nil
+}
+
+// SidecarReader returns a reader for the sidecars of the backup stored under key
+func SidecarReader(key string) storage.SidecarReader {
+	return func(ctx context.Context, suffix string) ([]byte, error) {
+		client, err := CreateClient()
+		if err != nil {
+			return nil, err
+		}
+
+		return ReadSidecar(ctx, client, key, suffix)
+	}
+}
@@ -0,0 +1,294 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// Condition keys of bucket policies that describe how an upload is encrypted
+const (
+	conditionSSE            = "s3:x-amz-server-side-encryption"
+	conditionSSEKMSKeyID    = "s3:x-amz-server-side-encryption-aws-kms-key-id"
+	conditionSSECustomerAlg = "s3:x-amz-server-side-encryption-customer-algorithm"
+)
+
+// WriteEncryption returns the server-side encryption objects are stored with, nil when it is not configured
+func WriteEncryption() (encrypt.ServerSide, error) {
+	settings := config.Loaded.Storage.S3.ServerSideEncryption
+	if settings == nil {
+		return nil, nil
+	}
+
+	switch settings.Type {
+	case configstorage.SSES3:
+		return encrypt.NewSSE(), nil
+	case configstorage.SSEKMS:
+		var encryptionContext interface{}
+		if len(settings.KMSContext) > 0 {
+			encryptionContext = settings.KMSContext
+		}
+
+		sse, err := encrypt.NewSSEKMS(settings.GetKMSKeyID(), encryptionContext)
+		if err != nil {
+			return nil, fmt.Errorf("s3: invalid sse-kms settings: %w", err)
+		}
+		return sse, nil
+	case configstorage.SSEC:
+		key, err := settings.GetCustomerKey()
+		if err != nil {
+			return nil, fmt.Errorf("s3: server_side_encryption: %w", err)
+		}
+
+		sse, err := encrypt.NewSSEC(key)
+		if err != nil {
+			return nil, fmt.Errorf("s3: invalid sse-c key: %w", err)
+		}
+		return sse, nil
+	default:
+		// Unknown types are rejected when the config is loaded
+		return nil, fmt.Errorf("s3: unknown server-side encryption type '%s'", settings.Type)
+	}
+}
+
+// ReadEncryption returns what has to be sent to read objects back. Only SSE-C needs the key on reads,
+// S3 decrypts objects stored with SSE-S3 and SSE-KMS on its own.
+func ReadEncryption() (encrypt.ServerSide, error) {
+	settings := config.Loaded.Storage.S3.ServerSideEncryption
+	if settings == nil || settings.Type != configstorage.SSEC {
+		return nil, nil
+	}
+
+	return WriteEncryption()
+}
+
+// CheckServerSideEncryption compares the server-side encryption settings with the default encryption and the
+// policy of the bucket. It fails when the bucket policy denies uploads made with the settings.
+// Buckets whose policy can't be read are not checked.
+func CheckServerSideEncryption(ctx context.Context) error {
+	logger := log.Logger.With().Str("caller", "s3_check_encryption").Logger()
+
+	client, err := CreateClient()
+	if err != nil {
+		return err
+	}
+
+	bucket := config.Loaded.Storage.S3.Bucket
+	settings := config.Loaded.Storage.S3.ServerSideEncryption
+
+	configured := "none"
+	if settings != nil {
+		configured = settings.Type
+	}
+
+	defaults, err := client.GetBucketEncryption(ctx, bucket)
+	switch {
+	case err != nil && minio.ToErrorResponse(err).Code == "ServerSideEncryptionConfigurationNotFoundError":
+		logger.Debug().Str("bucket", bucket).Msg("bucket has no default encryption")
+	case err != nil:
+		logger.Warn().Err(err).Str("bucket", bucket).Msg("failed to read default encryption of bucket")
+	case len(defaults.Rules) > 0:
+		rule := defaults.Rules[0].Apply
+		logger.Info().
+			Str("bucket", bucket).
+			Str("bucket_algorithm", rule.SSEAlgorithm).
+			Str("bucket_kms_key_id", rule.KmsMasterKeyID).
+			Str("server_side_encryption", configured).
+			Msg("bucket encrypts objects by default")
+
+		if settings != nil && settings.Type == configstorage.SSEKMS && rule.KmsMasterKeyID != "" &&
+			settings.GetKMSKeyID() != "" && settings.GetKMSKeyID() != rule.KmsMasterKeyID {
+			logger.Warn().
+				Str("bucket", bucket).
+				Str("bucket_kms_key_id", rule.KmsMasterKeyID).
+				Str("kms_key_id", settings.GetKMSKeyID()).
+				Msg("backups are encrypted with a different KMS key than the bucket default")
+		}
+	}
+
+	raw, err := client.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		logger.Warn().Err(err).Str("bucket", bucket).Msg("failed to read bucket policy, server-side encryption settings are not checked against it")
+		return nil
+	}
+	if raw == "" {
+		logger.Debug().Str("bucket", bucket).Msg("bucket has no policy")
+		return nil
+	}
+
+	var policy bucketPolicy
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		logger.Warn().Err(err).Str("bucket", bucket).Msg("failed to parse bucket policy, server-side encryption settings are not checked against it")
+		return nil
+	}
+
+	headers := uploadHeaders(settings)
+	for i, statement := range policy.Statement {
+		if statement.denies(headers) {
+			sid := statement.Sid
+			if sid == "" {
+				sid = fmt.Sprintf("#%d", i)
+			}
+			return fmt.Errorf("s3: bucket policy statement %s of bucket %s denies uploads with server_side_encryption '%s'", sid, bucket, configured)
+		}
+	}
+
+	logger.Info().
+		Str("bucket", bucket).
+		Str("server_side_encryption", configured).
+		Msg("server-side encryption settings are allowed by the bucket policy")
+
+	return nil
+}
+
+// uploadHeaders returns the values of the encryption condition keys of an upload made with the settings
+func uploadHeaders(settings *configstorage.ServerSideEncryption) map[string]string {
+	headers := make(map[string]string)
+	if settings == nil {
+		return headers
+	}
+
+	switch settings.Type {
+	case configstorage.SSES3:
+		headers[conditionSSE] = "AES256"
+	case configstorage.SSEKMS:
+		headers[conditionSSE] = "aws:kms"
+		if settings.KMSKeyID != nil {
+			headers[conditionSSEKMSKeyID] = *settings.KMSKeyID
+		}
+	case configstorage.SSEC:
+		headers[conditionSSECustomerAlg] = "AES256"
+	}
+
+	return headers
+}
+
+type bucketPolicy struct {
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid       string                           `json:"Sid"`
+	Effect    string                           `json:"Effect"`
+	Action    stringList                       `json:"Action"`
+	Condition map[string]map[string]stringList `json:"Condition"`
+}
+
+// stringList is a policy value that may be a single value or a list of values.
+// Values are read as strings, so that booleans like those of Null conditions compare as "true" and "false".
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single interface{}
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		list = []interface{}{single}
+	}
+
+	*l = make(stringList, 0, len(list))
+	for _, value := range list {
+		*l = append(*l, fmt.Sprint(value))
+	}
+	return nil
+}
+
+// denies reports whether the statement denies an upload with the given encryption headers.
+// Only statements whose conditions all test encryption keys are evaluated, others are assumed not to apply.
+func (s policyStatement) denies(headers map[string]string) bool {
+	if s.Effect != "Deny" || len(s.Condition) == 0 || !s.appliesTo("s3:PutObject") {
+		return false
+	}
+
+	for operator, conditions := range s.Condition {
+		for key, values := range conditions {
+			key = strings.ToLower(key)
+			if key != conditionSSE && key != conditionSSEKMSKeyID && key != conditionSSECustomerAlg {
+				return false
+			}
+
+			value, present := headers[key]
+			matched, known := evaluateCondition(operator, value, present, values)
+			if !known || !matched {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// appliesTo reports whether the actions of the statement, which are case-insensitive, cover the action
+func (s policyStatement) appliesTo(action string) bool {
+	for _, pattern := range s.Action {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(action)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateCondition evaluates a single policy condition, known is false for operators it can't evaluate
+func evaluateCondition(operator, value string, present bool, values []string) (matched, known bool) {
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	operator = strings.TrimSuffix(operator, "IfExists")
+
+	if operator == "Null" {
+		for _, expected := range values {
+			if strings.EqualFold(expected, "true") != present {
+				return true, true
+			}
+		}
+		return false, true
+	}
+
+	if !present {
+		switch operator {
+		case "StringNotEquals", "StringNotEqualsIgnoreCase", "StringNotLike":
+			return true, true
+		case "StringEquals", "StringEqualsIgnoreCase", "StringLike":
+			return ifExists, true
+		default:
+			return false, false
+		}
+	}
+
+	switch operator {
+	case "StringEquals":
+		return slices.Contains(values, value), true
+	case "StringNotEquals":
+		return !slices.Contains(values, value), true
+	case "StringEqualsIgnoreCase":
+		return slices.ContainsFunc(values, func(expected string) bool { return strings.EqualFold(expected, value) }), true
+	case "StringNotEqualsIgnoreCase":
+		return !slices.ContainsFunc(values, func(expected string) bool { return strings.EqualFold(expected, value) }), true
+	case "StringLike":
+		return matchesAny(values, value), true
+	case "StringNotLike":
+		return !matchesAny(values, value), true
+	default:
+		return false, false
+	}
+}
+
+// matchesAny reports whether any of the policy patterns, which may contain wildcards, matches the value
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
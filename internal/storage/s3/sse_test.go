@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// useServerSideEncryption configures S3 storage with the server-side encryption settings
+func useServerSideEncryption(t *testing.T, settings *configstorage.ServerSideEncryption) {
+	t.Helper()
+
+	previous := config.Loaded
+	config.Loaded = &config.Config{Storage: configstorage.Storage{S3: &configstorage.S3Storage{ServerSideEncryption: settings}}}
+	t.Cleanup(func() { config.Loaded = previous })
+}
+
+func TestServerSideEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, configstorage.CustomerKeySize)
+	keyMD5 := md5.Sum(key)
+	t.Setenv("TEST_SSE_C_KEY", base64.StdEncoding.EncodeToString(key))
+	t.Setenv("TEST_SSE_C_SHORT_KEY", base64.StdEncoding.EncodeToString(key[:16]))
+
+	keyEnv := "TEST_SSE_C_KEY"
+	shortKeyEnv := "TEST_SSE_C_SHORT_KEY"
+	kmsKeyID := "arn:aws:kms:eu-west-1:123456789012:key/backup"
+
+	sseC := map[string]string{
+		"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+		"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(key),
+		"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   base64.StdEncoding.EncodeToString(keyMD5[:]),
+	}
+
+	tests := []struct {
+		name     string
+		settings *configstorage.ServerSideEncryption
+		// wantWrite and wantRead are the headers sent when objects are written and read, nil for none
+		wantWrite map[string]string
+		wantRead  map[string]string
+		wantErr   string
+	}{
+		{
+			name: "not configured",
+		},
+		{
+			name:      "sse-s3",
+			settings:  &configstorage.ServerSideEncryption{Type: configstorage.SSES3},
+			wantWrite: map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+		},
+		{
+			name:      "sse-kms with the default key",
+			settings:  &configstorage.ServerSideEncryption{Type: configstorage.SSEKMS},
+			wantWrite: map[string]string{"X-Amz-Server-Side-Encryption": "aws:kms"},
+		},
+		{
+			name: "sse-kms with a key and context",
+			settings: &configstorage.ServerSideEncryption{
+				Type:       configstorage.SSEKMS,
+				KMSKeyID:   &kmsKeyID,
+				KMSContext: map[string]string{"app": "backup"},
+			},
+			wantWrite: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": kmsKeyID,
+				"X-Amz-Server-Side-Encryption-Context":        base64.StdEncoding.EncodeToString([]byte(`{"app":"backup"}`)),
+			},
+		},
+		{
+			name:      "sse-c",
+			settings:  &configstorage.ServerSideEncryption{Type: configstorage.SSEC, CustomerKeyEnv: &keyEnv},
+			wantWrite: sseC,
+			wantRead:  sseC,
+		},
+		{
+			name:     "sse-c with a short key",
+			settings: &configstorage.ServerSideEncryption{Type: configstorage.SSEC, CustomerKeyEnv: &shortKeyEnv},
+			wantErr:  "customer key is 16 bytes, it must be 32 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServerSideEncryption(t, tt.settings)
+
+			write, writeErr := WriteEncryption()
+			read, readErr := ReadEncryption()
+			if tt.wantErr != "" {
+				if writeErr == nil || !strings.Contains(writeErr.Error(), tt.wantErr) {
+					t.Errorf("WriteEncryption() error = %v, want %q", writeErr, tt.wantErr)
+				}
+				if readErr == nil || !strings.Contains(readErr.Error(), tt.wantErr) {
+					t.Errorf("ReadEncryption() error = %v, want %q", readErr, tt.wantErr)
+				}
+				return
+			}
+			if writeErr != nil || readErr != nil {
+				t.Fatalf("WriteEncryption() error = %v, ReadEncryption() error = %v", writeErr, readErr)
+			}
+
+			checkHeaders(t, "WriteEncryption()", write, tt.wantWrite)
+			checkHeaders(t, "ReadEncryption()", read, tt.wantRead)
+		})
+	}
+}
+
+// checkHeaders checks that sse sends exactly the wanted headers, a nil sse sends none
+func checkHeaders(t *testing.T, name string, sse encrypt.ServerSide, want map[string]string) {
+	t.Helper()
+
+	if sse == nil {
+		if want != nil {
+			t.Errorf("%s = nil, want headers %v", name, want)
+		}
+		return
+	}
+
+	header := make(http.Header)
+	sse.Marshal(header)
+
+	if len(header) != len(want) {
+		t.Errorf("%s sends headers %v, want %v", name, header, want)
+	}
+	for key, value := range want {
+		if got := header.Get(key); got != value {
+			t.Errorf("%s sends %s = %q, want %q", name, key, got, value)
+		}
+	}
+}
@@ -10,78 +10,153 @@ import (
 	"time"
 
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/rs/zerolog/log"
 
 	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	configstorage "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+	"github.com/DeltaLaboratory/postgres-backup/internal/event"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
 )
 
-func Upload(ctx context.Context, reader io.Reader) error {
+// Upload stores the backup in the S3 bucket under name, which is relative to the backend root
+// as returned by target.Name
+func Upload(ctx context.Context, reader io.Reader, target storage.Target, name string) error {
 	logger := log.Logger.With().Str("caller", "s3_upload").Logger()
 
 	if config.Loaded.Storage.S3 == nil {
 		return errors.New("s3: config is not present")
 	}
 
-	client, err := minio.New(config.Loaded.Storage.S3.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.Loaded.Storage.S3.AccessKey, config.Loaded.Storage.S3.SecretKey, ""),
-		Region: config.Loaded.Storage.S3.GetRegion(),
-		Secure: true,
-	})
-
+	client, err := CreateClient()
 	if err != nil {
-		return fmt.Errorf("s3: failed to create client: %w", err)
+		return err
 	}
 
-	if config.Loaded.IsVerbose() {
-		client.TraceOn(log.Logger)
+	settings := config.Loaded.Storage.S3
+
+	starting := logger.Info().
+		Str("endpoint", settings.Endpoint).
+		Str("bucket", settings.Bucket).
+		Int("upload_concurrency", settings.GetUploadConcurrency())
+	if partSize := settings.GetPartSize(); partSize > 0 {
+		// The size of a backup isn't known upfront, so it is limited by the part size
+		starting = starting.
+			Uint64("part_size", partSize).
+			Uint64("buffer_bytes", partSize*uint64(settings.GetUploadConcurrency())).
+			Uint64("max_backup_bytes", partSize*configstorage.MaxParts)
 	}
+	if settings.StorageClass != nil {
+		starting = starting.Str("storage_class", settings.GetStorageClass())
+	}
+	starting.Msg("starting upload to S3")
 
-	logger.Info().
-		Str("endpoint", config.Loaded.Storage.S3.Endpoint).
-		Str("bucket", config.Loaded.Storage.S3.Bucket).
-		Msg("starting upload to S3")
-
-	objectName := time.Now().Format("2006-01-02T15:04:05")
+	objectName := ObjectKey(name)
 
-	if config.Loaded.Storage.S3.Prefix != nil {
-		objectName = fmt.Sprintf("%s/%s", *config.Loaded.Storage.S3.Prefix, objectName)
+	sse, err := WriteEncryption()
+	if err != nil {
+		return err
 	}
 
-	if config.Loaded.Compress != nil {
-		objectName = fmt.Sprintf("%s.%s", objectName, config.Loaded.Compress.Algorithm)
+	opts := minio.PutObjectOptions{
+		SendContentMd5:       true,
+		ServerSideEncryption: sse,
+		PartSize:             settings.GetPartSize(),
+		StorageClass:         settings.GetStorageClass(),
+		ContentType:          settings.GetContentType(),
+		UserMetadata:         settings.Metadata,
+	}
+	if concurrency := settings.GetUploadConcurrency(); concurrency > 1 {
+		opts.NumThreads = uint(concurrency)
+		opts.ConcurrentStreamParts = true
 	}
+	applyObjectLock(&opts, time.Now())
 
-	info, err := client.PutObject(ctx, config.Loaded.Storage.S3.Bucket, objectName, reader, -1, minio.PutObjectOptions{
-		SendContentMd5: true,
-	})
+	progress := newProgressReader(reader)
+	reportCtx, stopReport := context.WithCancel(ctx)
+	go progress.report(reportCtx, logger)
+
+	info, err := client.PutObject(ctx, settings.Bucket, objectName, progress, -1, opts)
+	stopReport()
 	if err != nil {
+		abortUpload(ctx, client, objectName)
 		return fmt.Errorf("s3: failed to store backup: %w", err)
 	}
 
 	logger.Info().
 		Str("key", info.Key).
-		Str("bucket", config.Loaded.Storage.S3.Bucket).
+		Str("bucket", settings.Bucket).
 		Str("size", fmt.Sprintf("%d bytes", info.Size)).
+		Dur("duration", time.Since(progress.started)).
+		Float64("throughput_mib_s", progress.throughput()).
 		Msg("backup successfully uploaded to S3")
 
-	// Run retention cleanup after successful upload
-	if err := CleanupRetention(ctx); err != nil {
-		logger.Warn().Err(err).Msg("failed to cleanup old S3 backups during retention policy enforcement")
+	// Run retention cleanup after successful upload, unless a retention schedule takes care of it
+	if config.Loaded.Storage.S3.IsRetentionOnUpload() {
+		if err := CleanupRetention(ctx, target); err != nil {
+			logger.Warn().Err(err).Msg("failed to cleanup old S3 backups during retention policy enforcement")
+		}
 	}
 
 	return nil
 }
 
+// ObjectKey returns the key of the object holding the backup name, which is relative to the backend root
+func ObjectKey(name string) string {
+	if config.Loaded.Storage.S3.Prefix != nil {
+		return fmt.Sprintf("%s/%s", *config.Loaded.Storage.S3.Prefix, name)
+	}
+
+	return name
+}
+
+// abortTimeout bounds how long aborting an interrupted multipart upload may take
+const abortTimeout = 30 * time.Second
+
+// abortUpload removes the parts of an interrupted multipart upload.
+// minio-go aborts failed uploads itself, but not when the failure was caused by a cancelled context.
+func abortUpload(ctx context.Context, client *minio.Client, objectName string) {
+	logger := log.Logger.With().Str("caller", "s3_abort_upload").Logger()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+
+	if err := client.RemoveIncompleteUpload(ctx, config.Loaded.Storage.S3.Bucket, objectName); err != nil {
+		logger.Warn().Err(err).
+			Str("key", objectName).
+			Str("bucket", config.Loaded.Storage.S3.Bucket).
+			Msg("failed to abort incomplete multipart upload, it can be removed with `retention gc`")
+		return
+	}
+
+	logger.Info().
+		Str("key", objectName).
+		Str("bucket", config.Loaded.Storage.S3.Bucket).
+		Msg("aborted incomplete multipart upload")
+}
+
 // BackupInfo represents a backup file with its metadata
 type BackupInfo struct {
-	Key          string
+	Key string
+	// Name is the key of the backup relative to the prefix
+	Name         string
 	LastModified time.Time
 	Size         int64
 }
 
-// ListBackups lists all backup files in the S3 bucket
+// ListBackups lists all backup files in the S3 bucket, including those of backup jobs
 func ListBackups(ctx context.Context, client *minio.Client) ([]BackupInfo, error) {
+	return listBackups(ctx, client, "", true)
+}
+
+// ListTargetBackups lists the backup files written to the target, newest first
+func ListTargetBackups(ctx context.Context, client *minio.Client, target storage.Target) ([]BackupInfo, error) {
+	// Only backups directly below the target belong to it, nested paths belong to backup jobs
+	return listBackups(ctx, client, target.Path, false)
+}
+
+// listBackups lists the backup files below a path inside the prefix.
+// Nested paths are only searched when recursive is set.
+func listBackups(ctx context.Context, client *minio.Client, subpath string, recursive bool) ([]BackupInfo, error) {
 	var backups []BackupInfo
 	prefix := ""
 
@@ -92,9 +167,14 @@ func ListBackups(ctx context.Context, client *minio.Client) ([]BackupInfo, error
 		}
 	}
 
+	root := prefix
+	if subpath != "" {
+		prefix += strings.TrimSuffix(subpath, "/") + "/"
+	}
+
 	opts := minio.ListObjectsOptions{
 		Prefix:    prefix,
-		Recursive: true,
+		Recursive: recursive,
 	}
 
 	for object := range client.ListObjects(ctx, config.Loaded.Storage.S3.Bucket, opts) {
@@ -114,10 +194,10 @@ func ListBackups(ctx context.Context, client *minio.Client) ([]BackupInfo, error
 		}
 
 		// Only process files that match backup naming pattern (timestamp-based)
-		// Format: 2006-01-02T15:04:05 with optional compression extension
-		if len(filename) >= 19 && filename[4] == '-' && filename[7] == '-' && filename[10] == 'T' && filename[13] == ':' && filename[16] == ':' {
+		if storage.IsBackupName(filename) {
 			backups = append(backups, BackupInfo{
 				Key:          object.Key,
+				Name:         strings.TrimPrefix(object.Key, root),
 				LastModified: object.LastModified,
 				Size:         object.Size,
 			})
@@ -132,34 +212,71 @@ func ListBackups(ctx context.Context, client *minio.Client) ([]BackupInfo, error
 	return backups, nil
 }
 
-// CleanupRetention removes old backups based on retention policy
-func CleanupRetention(ctx context.Context) error {
+// removeSidecars removes the sidecars of a backup deleted by retention. Sidecars that are missing are skipped,
+// sidecars that are still locked or fail to be removed are left to garbage collection.
+func removeSidecars(ctx context.Context, client *minio.Client, key string) {
+	logger := log.Logger.With().Str("caller", "s3_retention_cleanup").Logger()
+
+	for _, suffix := range storage.SidecarSuffixes {
+		lock, err := getObjectLock(ctx, client, key+suffix)
+		if minio.ToErrorResponse(errors.Unwrap(err)).Code == "NoSuchKey" {
+			continue
+		}
+		if err != nil {
+			logger.Warn().Err(err).
+				Str("key", key+suffix).
+				Msg("failed to read lock of sidecar of old S3 backup, garbage collection removes it")
+			continue
+		}
+		if lock.locked(time.Now()) {
+			continue
+		}
+
+		if err := client.RemoveObject(ctx, config.Loaded.Storage.S3.Bucket, key+suffix, removeOptions(lock)); err != nil {
+			logger.Warn().Err(err).
+				Str("key", key+suffix).
+				Msg("failed to delete sidecar of old S3 backup, garbage collection removes it")
+		}
+	}
+}
+
+// CleanupRetention removes old backups of the target based on its retention policy
+func CleanupRetention(ctx context.Context, target storage.Target) error {
+	deleted, err := cleanupRetention(ctx, target)
+	event.Publish(event.RetentionFinished{Backend: event.BackendS3, Path: target.Path, Deleted: deleted, Err: err})
+	return err
+}
+
+// cleanupRetention applies the retention policy of the target and returns the number of deleted backups
+func cleanupRetention(ctx context.Context, target storage.Target) (int, error) {
 	logger := log.Logger.With().Str("caller", "s3_retention_cleanup").Logger()
 
 	if config.Loaded.Storage.S3 == nil {
-		return nil // No S3 configuration
+		return 0, nil // No S3 configuration
 	}
 
+	retention := target.GetRetention(config.Loaded.Storage.S3.GetRetention())
+
 	// Check if any retention policy is configured
-	if !config.Loaded.Storage.S3.IsRetentionConfigured() {
-		logger.Debug().Msg("no S3 retention policy configured, skipping cleanup")
-		return nil // No retention policy configured
+	if !retention.IsRetentionConfigured() {
+		logger.Debug().Str("path", target.Path).Msg("no S3 retention policy configured, skipping cleanup")
+		return 0, nil // No retention policy configured
 	}
 
 	// Get effective retention days (handles both numeric and string periods)
-	effectiveRetentionDays, err := config.Loaded.Storage.S3.GetEffectiveRetentionDays()
+	effectiveRetentionDays, err := retention.GetEffectiveRetentionDays()
 	if err != nil {
-		return fmt.Errorf("failed to parse S3 retention period: %w", err)
+		return 0, fmt.Errorf("failed to parse S3 retention period: %w", err)
 	}
 
-	retentionCount := config.Loaded.Storage.S3.RetentionCount
+	retentionCount := retention.Count
 
 	// Log the retention policy being applied
-	logEvent := logger.Info().Str("bucket", config.Loaded.Storage.S3.Bucket)
+	logEvent := logger.Info().Str("bucket", config.Loaded.Storage.S3.Bucket).Str("path", target.Path)
 	if effectiveRetentionDays > 0 {
 		logEvent = logEvent.Int("retention_days", effectiveRetentionDays)
-		if config.Loaded.Storage.S3.RetentionPeriod != nil {
-			logEvent = logEvent.Str("retention_period", *config.Loaded.Storage.S3.RetentionPeriod)
+		if retention.Period != nil {
+			logEvent = logEvent.Str("retention_period", *retention.Period)
 		}
 	}
 	if retentionCount != nil {
@@ -167,18 +284,14 @@ func CleanupRetention(ctx context.Context) error {
 	}
 	logEvent.Msg("starting S3 retention cleanup")
 
-	client, err := minio.New(config.Loaded.Storage.S3.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.Loaded.Storage.S3.AccessKey, config.Loaded.Storage.S3.SecretKey, ""),
-		Region: config.Loaded.Storage.S3.GetRegion(),
-		Secure: true,
-	})
+	client, err := CreateClient()
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return 0, err
 	}
 
-	backups, err := ListBackups(ctx, client)
+	backups, err := ListTargetBackups(ctx, client, target)
 	if err != nil {
-		return fmt.Errorf("failed to list backups: %w", err)
+		return 0, fmt.Errorf("failed to list backups: %w", err)
 	}
 
 	var toDelete []string
@@ -210,9 +323,29 @@ func CleanupRetention(ctx context.Context) error {
 		}
 	}
 
-	// Delete the marked backups
+	// Delete the marked backups, backups that are still locked are kept until their lock expires
+	deleted, locked := 0, 0
 	for _, key := range toDelete {
-		err := client.RemoveObject(ctx, config.Loaded.Storage.S3.Bucket, key, minio.RemoveObjectOptions{})
+		lock, err := getObjectLock(ctx, client, key)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("key", key).
+				Str("bucket", config.Loaded.Storage.S3.Bucket).
+				Msg("failed to read lock of S3 backup during retention cleanup")
+			continue
+		}
+		if lock.locked(time.Now()) {
+			logger.Info().
+				Str("key", key).
+				Str("mode", lock.mode).
+				Time("retain_until", lock.retainUntil).
+				Bool("legal_hold", lock.legalHold).
+				Msg("keeping locked S3 backup until its lock expires")
+			locked++
+			continue
+		}
+
+		err = client.RemoveObject(ctx, config.Loaded.Storage.S3.Bucket, key, removeOptions(lock))
 		if err != nil {
 			logger.Error().Err(err).
 				Str("key", key).
@@ -223,12 +356,16 @@ func CleanupRetention(ctx context.Context) error {
 				Str("key", key).
 				Str("bucket", config.Loaded.Storage.S3.Bucket).
 				Msg("deleted old S3 backup")
+			deleted++
+
+			removeSidecars(ctx, client, key)
 		}
 	}
 
 	if len(toDelete) > 0 {
 		logger.Info().
-			Int("deleted_count", len(toDelete)).
+			Int("deleted_count", deleted).
+			Int("locked_count", locked).
 			Str("bucket", config.Loaded.Storage.S3.Bucket).
 			Msg("S3 retention cleanup completed successfully")
 	} else {
@@ -237,30 +374,144 @@ func CleanupRetention(ctx context.Context) error {
 			Msg("S3 retention cleanup completed - no backups to delete")
 	}
 
-	return nil
+	return deleted, nil
 }
 
-// CreateClient creates and configures an S3 client
-func CreateClient() (*minio.Client, error) {
+// GarbageCollect removes incomplete multipart uploads, incomplete backups and orphaned sidecars
+func GarbageCollect(ctx context.Context, opts storage.GCOptions) (int, error) {
+	logger := log.Logger.With().Str("caller", "s3_garbage_collect").Logger()
+
 	if config.Loaded.Storage.S3 == nil {
-		return nil, errors.New("s3: config is not present")
+		return 0, nil // No S3 configuration
 	}
 
-	client, err := minio.New(config.Loaded.Storage.S3.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.Loaded.Storage.S3.AccessKey, config.Loaded.Storage.S3.SecretKey, ""),
-		Region: config.Loaded.Storage.S3.GetRegion(),
-		Secure: true,
-	})
+	bucket := config.Loaded.Storage.S3.Bucket
+
+	logger.Info().
+		Str("bucket", bucket).
+		Bool("dry_run", opts.DryRun).
+		Dur("min_age", opts.MinAge).
+		Msg("starting S3 garbage collection")
 
+	client, err := CreateClient()
 	if err != nil {
-		return nil, fmt.Errorf("s3: failed to create client: %w", err)
+		return 0, err
+	}
+
+	prefix := ""
+	if config.Loaded.Storage.S3.Prefix != nil {
+		prefix = *config.Loaded.Storage.S3.Prefix
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.MinAge)
+	found, removed := 0, 0
+
+	// Incomplete multipart uploads are left behind when an upload is interrupted. The bucket may be shared,
+	// so only uploads of backups and sidecars are aborted.
+	for upload := range client.ListIncompleteUploads(ctx, bucket, prefix, true) {
+		if upload.Err != nil {
+			return found, fmt.Errorf("failed to list incomplete uploads: %w", upload.Err)
+		}
+
+		if upload.Initiated.After(cutoff) || !storage.IsArtifactName(upload.Key) {
+			continue
+		}
+
+		found++
+
+		if opts.DryRun {
+			logger.Info().
+				Str("key", upload.Key).
+				Str("upload_id", upload.UploadID).
+				Time("initiated", upload.Initiated).
+				Msg("would abort incomplete S3 upload (dry run)")
+			continue
+		}
+
+		if err := client.RemoveIncompleteUpload(ctx, bucket, upload.Key); err != nil {
+			logger.Error().Err(err).
+				Str("key", upload.Key).
+				Str("bucket", bucket).
+				Msg("failed to abort incomplete S3 upload during garbage collection")
+			continue
+		}
+
+		logger.Info().
+			Str("key", upload.Key).
+			Str("upload_id", upload.UploadID).
+			Msg("aborted incomplete S3 upload")
+		removed++
+	}
+
+	var objects []storage.Object
+	for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return found, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+
+		objects = append(objects, storage.Object{
+			Name:         object.Key,
+			LastModified: object.LastModified,
+			Size:         object.Size,
+		})
 	}
 
-	if config.Loaded.IsVerbose() {
-		client.TraceOn(log.Logger)
+	garbage := storage.FindGarbage(objects, cutoff)
+	found += len(garbage)
+
+	for _, item := range garbage {
+		if opts.DryRun {
+			logger.Info().
+				Str("key", item.Name).
+				Str("reason", item.Reason).
+				Msg("would remove S3 artifact (dry run)")
+			continue
+		}
+
+		lock, err := getObjectLock(ctx, client, item.Name)
+		if err != nil {
+			logger.Error().Err(err).
+				Str("key", item.Name).
+				Str("bucket", bucket).
+				Msg("failed to read lock of S3 artifact during garbage collection")
+			continue
+		}
+		if lock.locked(time.Now()) {
+			logger.Info().
+				Str("key", item.Name).
+				Str("reason", item.Reason).
+				Time("retain_until", lock.retainUntil).
+				Bool("legal_hold", lock.legalHold).
+				Msg("keeping locked S3 artifact until its lock expires")
+			continue
+		}
+
+		if err := client.RemoveObject(ctx, bucket, item.Name, removeOptions(lock)); err != nil {
+			logger.Error().Err(err).
+				Str("key", item.Name).
+				Str("bucket", bucket).
+				Str("reason", item.Reason).
+				Msg("failed to remove S3 artifact during garbage collection")
+			continue
+		}
+
+		logger.Info().
+			Str("key", item.Name).
+			Str("reason", item.Reason).
+			Msg("removed S3 artifact")
+		removed++
 	}
 
-	return client, nil
+	logger.Info().
+		Int("found_count", found).
+		Int("removed_count", removed).
+		Str("bucket", bucket).
+		Msg("S3 garbage collection completed")
+
+	return found, nil
 }
 
 // DownloadBackup downloads a backup file from S3 and returns an io.ReadCloser
@@ -281,7 +532,13 @@ func DownloadBackup(ctx context.Context, backupKey string) (io.ReadCloser, error
 		Str("bucket", config.Loaded.Storage.S3.Bucket).
 		Msg("downloading backup from S3")
 
-	object, err := client.GetObject(ctx, config.Loaded.Storage.S3.Bucket, backupKey, minio.GetObjectOptions{})
+	// Objects stored with SSE-C can only be read with their key
+	sse, err := ReadEncryption()
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(ctx, config.Loaded.Storage.S3.Bucket, backupKey, minio.GetObjectOptions{ServerSideEncryption: sse})
 	if err != nil {
 		return nil, fmt.Errorf("s3: failed to get backup object: %w", err)
 	}
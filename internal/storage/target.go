@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"path"
+
+	storageconfig "github.com/DeltaLaboratory/postgres-backup/internal/config/storage"
+)
+
+// Target is the place inside a storage backend that a backup job writes to
+type Target struct {
+	// Path is appended to the prefix or directory of the backend, it is empty for the backend root
+	Path string
+	// Extension is appended to backup names, such as "zstd.age", it is empty when backups are neither compressed nor encrypted
+	Extension string
+	// Retention overrides the retention settings of the backend when set
+	Retention *storageconfig.Retention
+}
+
+// Name returns the name of a new backup taken at the given timestamp, relative to the backend root
+func (t Target) Name(timestamp string) string {
+	name := timestamp
+	if t.Extension != "" {
+		name += "." + t.Extension
+	}
+
+	return path.Join(t.Path, name)
+}
+
+// GetRetention returns the retention policy of the target, falling back to the backend's own settings
+func (t Target) GetRetention(backend *storageconfig.Retention) *storageconfig.Retention {
+	if t.Retention != nil {
+		return t.Retention
+	}
+
+	return backend
+}
@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/DeltaLaboratory/postgres-backup/internal/config"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/local"
+	"github.com/DeltaLaboratory/postgres-backup/internal/storage/s3"
+)
+
+// archiveMagic starts every archive written by pg_dump --format custom
+var archiveMagic = []byte("PGDMP")
+
+// VerifyOptions controls which backups are verified
+type VerifyOptions struct {
+	// Count is the number of newest backups verified per job, database and storage backend
+	Count int
+}
+
+// Verify reads the newest backups of every backup job end to end. A backup passes when it matches its signed
+// manifest if manifests are checked, decompresses without checksum errors and holds a pg_dump custom format archive.
+func Verify(ctx context.Context, opts VerifyOptions) error {
+	logger := log.Logger.With().Str("caller", "verify").Logger()
+
+	logger.Info().Int("count", opts.Count).Msg("starting backup verification")
+
+	var errs []error
+	verified := 0
+
+	for _, job := range BackupJobs() {
+		for _, database := range job.databases() {
+			target := job.Target(database)
+
+			if job.S3 {
+				count, err := verifyS3(ctx, target, opts)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("s3: %w", err))
+				}
+				verified += count
+			}
+
+			if job.Local {
+				count, err := verifyLocal(ctx, target, opts)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("local: %w", err))
+				}
+				verified += count
+			}
+		}
+	}
+
+	event := logger.Info()
+	if len(errs) > 0 {
+		event = logger.Error()
+	}
+	event.
+		Int("verified_count", verified).
+		Int("failed_targets", len(errs)).
+		Msg("backup verification finished")
+
+	return errors.Join(errs...)
+}
+
+// verifyS3 verifies the newest backups of the target in S3 and returns how many passed
+func verifyS3(ctx context.Context, target storage.Target, opts VerifyOptions) (int, error) {
+	logger := log.Logger.With().Str("caller", "verify_s3").Logger()
+
+	client, err := s3.CreateClient()
+	if err != nil {
+		return 0, err
+	}
+
+	backups, err := s3.ListTargetBackups(ctx, client, target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	if len(backups) == 0 {
+		logger.Warn().
+			Str("bucket", config.Loaded.Storage.S3.Bucket).
+			Str("path", target.Path).
+			Msg("no S3 backups to verify")
+		return 0, nil
+	}
+
+	var errs []error
+	verified := 0
+
+	for _, backup := range backups[:min(opts.Count, len(backups))] {
+		reader, err := s3.DownloadBackup(ctx, backup.Key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Key, err))
+			continue
+		}
+
+		size, err := verifyArchive(ctx, reader, backup.Name, s3.SidecarReader(backup.Key))
+		reader.Close()
+		if err != nil {
+			logger.Error().Err(err).
+				Str("key", backup.Key).
+				Str("bucket", config.Loaded.Storage.S3.Bucket).
+				Msg("S3 backup failed verification")
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Key, err))
+			continue
+		}
+
+		logger.Info().
+			Str("key", backup.Key).
+			Str("bucket", config.Loaded.Storage.S3.Bucket).
+			Int64("archive_size", size).
+			Msg("S3 backup verified")
+		verified++
+	}
+
+	return verified, errors.Join(errs...)
+}
+
+// verifyLocal verifies the newest backups of the target in local storage and returns how many passed
+func verifyLocal(ctx context.Context, target storage.Target, opts VerifyOptions) (int, error) {
+	logger := log.Logger.With().Str("caller", "verify_local").Logger()
+
+	backups, err := local.ListTargetBackups(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	if len(backups) == 0 {
+		logger.Warn().
+			Str("directory", config.Loaded.Storage.Local.Directory).
+			Str("path", target.Path).
+			Msg("no local backups to verify")
+		return 0, nil
+	}
+
+	var errs []error
+	verified := 0
+
+	for _, backup := range backups[:min(opts.Count, len(backups))] {
+		reader, err := local.OpenBackup(backup.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Name, err))
+			continue
+		}
+
+		size, err := verifyArchive(ctx, reader, backup.Name, local.SidecarReader(backup.Path))
+		reader.Close()
+		if err != nil {
+			logger.Error().Err(err).
+				Str("path", backup.Path).
+				Msg("local backup failed verification")
+			errs = append(errs, fmt.Errorf("%s: %w", backup.Name, err))
+			continue
+		}
+
+		logger.Info().
+			Str("path", backup.Path).
+			Int64("archive_size", size).
+			Msg("local backup verified")
+		verified++
+	}
+
+	return verified, errors.Join(errs...)
+}
+
+// verifyArchive reads a backup to the end and returns the size of the archive inside it
+func verifyArchive(ctx context.Context, reader io.Reader, name string, sidecars storage.SidecarReader) (int64, error) {
+	reader, err := verifyManifest(ctx, reader, name, sidecars)
+	if err != nil {
+		return 0, err
+	}
+
+	decompressed, err := Open(ctx, reader, name, sidecars)
+	if err != nil {
+		return 0, err
+	}
+	if closer, ok := decompressed.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+
+	header := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(decompressed, header); err != nil {
+		return 0, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	if !bytes.Equal(header, archiveMagic) {
+		return 0, errors.New("backup is not a pg_dump custom format archive")
+	}
+
+	// Reading to the end makes the decompressor check the checksum of the stream
+	size, err := io.Copy(io.Discard, decompressed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	return size + int64(len(header)), nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	// Embed the time zone database so schedule time zones work in minimal container images
+	_ "time/tzdata"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"